@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/msgpack"
+)
+
+const imgPrefix = "data:image/png;base64,"
+
+// encodeMsgpack encodes a request in MessagePack with the image as raw bytes.
+func encodeMsgpack(event oapi.WsEvent, body interface{}) ([]byte, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode body as JSON: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	if m, ok := v.(map[string]interface{}); ok {
+		if img, ok := m["img"].(string); ok && strings.HasPrefix(img, imgPrefix) {
+			b, err := base64.StdEncoding.DecodeString(img[len(imgPrefix):])
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode img: %w", err)
+			}
+			m["img"] = b
+		}
+	}
+
+	return msgpack.Marshal(map[string]interface{}{"type": string(event), "body": v})
+}
+
+// msgpackToJSON converts a binary frame to JSON to decode it in the same way as a text frame.
+// 画像のバイト列は base64 の文字列になる
+func msgpackToJSON(data []byte) ([]byte, error) {
+	v, err := msgpack.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
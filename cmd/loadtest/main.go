@@ -0,0 +1,118 @@
+// Command loadtest plays full games against a running server with many
+// concurrent rooms and reports latencies, errors and phase-completion stats.
+//
+//	go run ./cmd/loadtest -u http://localhost:3000 -rooms 50 -players 4
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+)
+
+type config struct {
+	baseURL      string
+	rooms        int
+	players      int
+	games        int
+	rounds       int
+	fogRadius    int
+	areaOrder    string
+	board        string
+	palette      string
+	mode         string
+	timeLimit    int
+	think        time.Duration
+	thinkJitter  time.Duration
+	disconnect   float64
+	reconnect    time.Duration
+	imgSize      int
+	noise        bool
+	ramp         time.Duration
+	timeout      time.Duration
+	seed         int64
+	capacity     int
+	skipSendRate float64
+	features     string
+}
+
+// hasFeature reports whether the players announce the feature on connect.
+func (c *config) hasFeature(f oapi.WsFeature) bool {
+	for _, s := range strings.Split(c.features, ",") {
+		if strings.TrimSpace(s) == string(f) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func main() {
+	cfg := config{}
+	flag.StringVar(&cfg.baseURL, "u", "http://localhost:3000", "Base URL of the server including the base endpoint .e.g \"http://localhost:3000/api\"")
+	flag.IntVar(&cfg.rooms, "rooms", 10, "Number of concurrent rooms")
+	flag.IntVar(&cfg.players, "players", 4, "Number of players in each room")
+	flag.IntVar(&cfg.games, "games", 1, "Number of games played in each room")
+	flag.IntVar(&cfg.rounds, "rounds", 1, "Number of rounds in each game")
+	flag.IntVar(&cfg.fogRadius, "fog", 0, "Fog radius of the draw phases (0 to show the whole canvas)")
+	flag.StringVar(&cfg.areaOrder, "area-order", "random", "Order of the areas drawn in the grid mode (random, raster, spiral, grow or region)")
+	flag.StringVar(&cfg.board, "board", "", "Board of the grid mode .e.g \"5x5\" or \"hex19\" (needs the boards feature unless it is a grid)")
+	flag.StringVar(&cfg.palette, "palette", "free", "Colors the drawers can use (free, monochrome, four or player, needs the palette feature unless it is free)")
+	flag.StringVar(&cfg.mode, "mode", "grid", "Game mode (grid or relay)")
+	flag.IntVar(&cfg.timeLimit, "time-limit", 10, "Time limit of each phase in seconds")
+	flag.DurationVar(&cfg.think, "think", 500*time.Millisecond, "Time a player takes before sending its input")
+	flag.DurationVar(&cfg.thinkJitter, "think-jitter", 500*time.Millisecond, "Random time added to the think time")
+	flag.Float64Var(&cfg.disconnect, "disconnect", 0, "Probability that a guest disconnects at the start of each phase (the host never disconnects)")
+	flag.DurationVar(&cfg.reconnect, "reconnect", time.Second, "Time a disconnected player waits before reconnecting (0 to stay disconnected)")
+	flag.Float64Var(&cfg.skipSendRate, "skip-send", 0, "Probability that a player never sends its input after the FINISH event")
+	flag.IntVar(&cfg.imgSize, "img", 128, "Side length in pixels of the synthetic PNGs")
+	flag.BoolVar(&cfg.noise, "noise", true, "Fill the synthetic PNGs with noise so that they do not compress")
+	flag.StringVar(&cfg.features, "features", "compression,relayMode,teamMode,rounds,bots,batch", "Comma separated features announced on connect (empty to connect as a legacy client)")
+	flag.DurationVar(&cfg.ramp, "ramp", 50*time.Millisecond, "Interval between creating rooms")
+	flag.DurationVar(&cfg.timeout, "timeout", 10*time.Minute, "Time limit of the whole test")
+	flag.Int64Var(&cfg.seed, "seed", time.Now().UnixNano(), "Random seed")
+	flag.Parse()
+
+	if cfg.players < 2 {
+		fmt.Fprintln(os.Stderr, "players must be at least 2")
+		os.Exit(2)
+	}
+	cfg.capacity = cfg.players
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+
+	stats := newStats()
+	rng := rand.New(rand.NewSource(cfg.seed))
+
+	start := time.Now()
+	wg := sync.WaitGroup{}
+	for i := 0; i < cfg.rooms; i++ {
+		r := &room{
+			cfg:   &cfg,
+			stats: stats,
+			seed:  rng.Int63(),
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.run(ctx)
+		}()
+
+		select {
+		case <-time.After(cfg.ramp):
+		case <-ctx.Done():
+		}
+	}
+	wg.Wait()
+
+	stats.report(os.Stdout, time.Since(start))
+}
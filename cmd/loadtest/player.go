@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/gorilla/websocket"
+)
+
+// protocolVersion is the version of the WebSocket protocol announced when features are enabled.
+const protocolVersion = 2
+
+// responses lists the events which answer each request, to measure the round trip time.
+var responses = map[oapi.WsEvent][]oapi.WsEvent{
+	oapi.WsEventROOMSETOPTION:    {oapi.WsEventROOMUPDATEOPTION},
+	oapi.WsEventREQUESTGAMESTART: {oapi.WsEventGAMESTART},
+	oapi.WsEventODAIREADY:        {oapi.WsEventODAIINPUT, oapi.WsEventODAIFINISH},
+	oapi.WsEventDRAWREADY:        {oapi.WsEventDRAWINPUT, oapi.WsEventDRAWFINISH},
+	oapi.WsEventANSWERREADY:      {oapi.WsEventANSWERINPUT, oapi.WsEventANSWERFINISH},
+	oapi.WsEventSHOWNEXT:         {oapi.WsEventSHOWODAI, oapi.WsEventSHOWCANVAS, oapi.WsEventSHOWANSWER},
+	oapi.WsEventRETURNROOM:       {oapi.WsEventNEXTROOM},
+}
+
+// phaseOf maps the events starting a phase to the name of the phase.
+var phaseOf = map[oapi.WsEvent]string{
+	oapi.WsEventGAMESTART:   "odai",
+	oapi.WsEventDRAWSTART:   "draw",
+	oapi.WsEventANSWERSTART: "answer",
+	oapi.WsEventSHOWSTART:   "show",
+	oapi.WsEventNEXTROOM:    "room",
+}
+
+type message struct {
+	Type oapi.WsEvent    `json:"type"`
+	Body json.RawMessage `json:"body"`
+}
+
+// player is a synthetic client playing through every event of the game.
+type player struct {
+	room   *room
+	userId string
+	host   bool
+	rng    *rand.Rand
+
+	mux  sync.Mutex // conn への書き込みと pending を守る
+	conn *websocket.Conn
+	// 送信したリクエストとその時刻
+	pending map[oapi.WsEvent]time.Time
+
+	// 入力を送る必要があるフェーズ
+	drawing   bool
+	answering bool
+	// 描いている DRAW_START のターン (遅れた絵をサーバーが捨てられるように DRAW_SEND で返す)
+	drawPhaseNum int
+
+	// ホストのみ
+	gamesLeft  int
+	phase      string
+	phaseStart time.Time
+}
+
+func newPlayer(r *room, userId string, host bool, seed int64) *player {
+	return &player{
+		room:      r,
+		userId:    userId,
+		host:      host,
+		rng:       rand.New(rand.NewSource(seed)),
+		pending:   make(map[oapi.WsEvent]time.Time),
+		gamesLeft: r.cfg.games,
+	}
+}
+
+func (p *player) connect(ctx context.Context) error {
+	u, err := url.Parse(p.room.cfg.baseURL + "/ws")
+	if err != nil {
+		return fmt.Errorf("failed to parse url: %w", err)
+	}
+
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	q := url.Values{"user": {p.userId}}
+	if len(p.room.cfg.features) > 0 {
+		q.Set("protocolVersion", strconv.Itoa(protocolVersion))
+		q.Set("features", p.room.cfg.features)
+	}
+	u.RawQuery = q.Encode()
+
+	start := time.Now()
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = p.room.cfg.hasFeature(oapi.WsFeatureCompression)
+	conn, _, err := dialer.DialContext(ctx, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to dial: %w", err)
+	}
+	p.room.stats.observe("ws_connect", time.Since(start))
+
+	p.mux.Lock()
+	p.conn = conn
+	p.mux.Unlock()
+
+	return nil
+}
+
+// play reads the events until the games end and reports whether all games were completed.
+func (p *player) play(ctx context.Context) bool {
+	go func() {
+		<-ctx.Done()
+		p.mux.Lock()
+		p.conn.Close()
+		p.mux.Unlock()
+	}()
+
+	if p.host {
+		p.startGame()
+	}
+
+	for {
+		msgs, err := p.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+
+			if p.host || p.room.cfg.reconnect == 0 {
+				p.room.stats.addError("ws_read", err)
+				return false
+			}
+
+			// 切断されたゲストは再接続する
+			if !sleep(ctx, p.room.cfg.reconnect) {
+				return false
+			}
+			if err := p.connect(ctx); err != nil {
+				p.room.stats.addError("ws_reconnect", err)
+				return false
+			}
+			p.room.stats.count("reconnect")
+
+			continue
+		}
+
+		for _, msg := range msgs {
+			if done := p.handle(ctx, msg); done {
+				return true
+			}
+		}
+	}
+}
+
+// read reads a frame, which may contain several messages.
+func (p *player) read() ([]*message, error) {
+	p.mux.Lock()
+	conn := p.conn
+	p.mux.Unlock()
+
+	frameType, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	p.room.stats.observeSize("frame_bytes", len(data))
+
+	if frameType == websocket.BinaryMessage {
+		data, err = msgpackToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode MessagePack: %w", err)
+		}
+	}
+
+	// batch が有効なときはフレームがメッセージの配列になる
+	msgs := make([]*message, 0, 1)
+	if p.room.cfg.hasFeature(oapi.WsFeatureBatch) {
+		err = json.Unmarshal(data, &msgs)
+	} else {
+		msg := new(message)
+		err = json.Unmarshal(data, msg)
+		msgs = append(msgs, msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode message: %w", err)
+	}
+
+	p.mux.Lock()
+	for _, msg := range msgs {
+		for req, sentAt := range p.pending {
+			// フレームを受け取った後に送ったリクエストへの応答ではない
+			if sentAt.After(now) {
+				continue
+			}
+
+			for _, res := range responses[req] {
+				if res == msg.Type {
+					p.room.stats.observe("rtt_"+string(req), now.Sub(sentAt))
+					delete(p.pending, req)
+				}
+			}
+		}
+	}
+	p.mux.Unlock()
+
+	return msgs, nil
+}
+
+// handle reacts to the message and reports whether the player has finished.
+func (p *player) handle(ctx context.Context, msg *message) bool {
+	stats := p.room.stats
+	stats.count("event_" + string(msg.Type))
+
+	if p.host {
+		p.trackPhase(msg.Type)
+	}
+
+	if _, ok := phaseOf[msg.Type]; ok && !p.host && p.rng.Float64() < p.room.cfg.disconnect {
+		stats.count("disconnect")
+		p.mux.Lock()
+		p.conn.Close()
+		p.mux.Unlock()
+
+		return false
+	}
+
+	switch msg.Type {
+	case oapi.WsEventERROR:
+		body := new(oapi.WsErrorBody)
+		_ = json.Unmarshal(msg.Body, body)
+		stats.addError("ws_event", fmt.Errorf("%s: %s", body.Code, body.Content))
+	case oapi.WsEventGAMESTART:
+		p.thinkAndSend(ctx, oapi.WsEventODAIREADY, struct{}{})
+	case oapi.WsEventODAIFINISH:
+		p.sendInput(oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{Odai: fmt.Sprintf("odai-%d", p.rng.Intn(1000))})
+	case oapi.WsEventDRAWSTART:
+		body := new(oapi.WsDrawStartEventBody)
+		_ = json.Unmarshal(msg.Body, body)
+		p.drawing = true
+		p.drawPhaseNum = body.DrawPhaseNum
+		p.thinkAndSend(ctx, oapi.WsEventDRAWREADY, struct{}{})
+	case oapi.WsEventDRAWFINISH:
+		if p.drawing {
+			p.drawing = false
+			p.sendInput(oapi.WsEventDRAWSEND, &oapi.WsDrawSendEventBody{Img: p.syntheticPNG(), DrawPhaseNum: &p.drawPhaseNum})
+		}
+	case oapi.WsEventANSWERSTART:
+		p.answering = true
+		p.thinkAndSend(ctx, oapi.WsEventANSWERREADY, struct{}{})
+	case oapi.WsEventANSWERFINISH:
+		if p.answering {
+			p.answering = false
+			p.sendInput(oapi.WsEventANSWERSEND, &oapi.WsAnswerSendEventBody{Answer: fmt.Sprintf("answer-%d", p.rng.Intn(1000))})
+		}
+	case oapi.WsEventSHOWSTART, oapi.WsEventSHOWODAI:
+		if p.host {
+			p.thinkAndSend(ctx, oapi.WsEventSHOWNEXT, struct{}{})
+		}
+	case oapi.WsEventSHOWCANVAS, oapi.WsEventSHOWANSWER:
+		body := new(struct {
+			Next oapi.WsNextShowStatus `json:"next"`
+		})
+		_ = json.Unmarshal(msg.Body, body)
+		if p.host && body.Next != oapi.WsNextShowStatusEnd {
+			p.thinkAndSend(ctx, oapi.WsEventSHOWNEXT, struct{}{})
+		}
+		// ROUND_FINISH が届かない古いクライアントは見せ終わったらすぐにルームに戻る
+		if p.host && body.Next == oapi.WsNextShowStatusEnd && !p.room.cfg.hasFeature(oapi.WsFeatureRounds) {
+			p.send(oapi.WsEventRETURNROOM, struct{}{})
+		}
+	case oapi.WsEventROUNDFINISH:
+		body := new(oapi.WsRoundFinishEventBody)
+		_ = json.Unmarshal(msg.Body, body)
+		if p.host && body.NextRoundIn == 0 {
+			p.send(oapi.WsEventRETURNROOM, struct{}{})
+		}
+	case oapi.WsEventNEXTROOM:
+		if !p.host {
+			return false
+		}
+
+		stats.count("game_completed")
+		p.gamesLeft--
+		if p.gamesLeft <= 0 {
+			return true
+		}
+
+		p.startGame()
+	case oapi.WsEventBREAKROOM, oapi.WsEventMAINTENANCE:
+		stats.count("room_closed_by_server")
+		return true
+	}
+
+	return false
+}
+
+func (p *player) startGame() {
+	timeLimit := p.room.cfg.timeLimit
+	gameMode := oapi.GameMode(p.room.cfg.mode)
+	roundNum := p.room.cfg.rounds
+	fogRadius := p.room.cfg.fogRadius
+	areaOrder := oapi.AreaOrder(p.room.cfg.areaOrder)
+	palette := oapi.Palette(p.room.cfg.palette)
+	var boardName *string
+	if len(p.room.cfg.board) > 0 {
+		boardName = &p.room.cfg.board
+	}
+
+	p.send(oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{
+		TimeLimit: &timeLimit,
+		GameMode:  &gameMode,
+		RoundNum:  &roundNum,
+		FogRadius: &fogRadius,
+		AreaOrder: &areaOrder,
+		BoardName: boardName,
+		Palette:   &palette,
+	})
+	p.send(oapi.WsEventREQUESTGAMESTART, struct{}{})
+}
+
+// trackPhase records how long each phase took, from the host's point of view.
+func (p *player) trackPhase(event oapi.WsEvent) {
+	phase, ok := phaseOf[event]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if p.phase != "" && p.phase != "room" {
+		p.room.stats.observe("phase_"+p.phase, now.Sub(p.phaseStart))
+		p.room.stats.count("phase_completed_" + p.phase)
+	}
+
+	p.phase = phase
+	p.phaseStart = now
+}
+
+func (p *player) sendInput(event oapi.WsEvent, body interface{}) {
+	if p.rng.Float64() < p.room.cfg.skipSendRate {
+		p.room.stats.count("skipped_" + string(event))
+		return
+	}
+
+	p.send(event, body)
+}
+
+// thinkAndSend sends the request after the think time without blocking the reader.
+func (p *player) thinkAndSend(ctx context.Context, event oapi.WsEvent, body interface{}) {
+	think := p.room.cfg.think
+	if j := p.room.cfg.thinkJitter; j > 0 {
+		think += time.Duration(p.rng.Int63n(int64(j)))
+	}
+
+	go func() {
+		if sleep(ctx, think) {
+			p.send(event, body)
+		}
+	}()
+}
+
+func (p *player) send(event oapi.WsEvent, body interface{}) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		p.room.stats.addError("ws_write", err)
+		return
+	}
+
+	frameType := websocket.TextMessage
+	if p.room.cfg.hasFeature(oapi.WsFeatureMsgpack) {
+		frameType = websocket.BinaryMessage
+		buf, err = encodeMsgpack(event, body)
+	} else {
+		buf, err = json.Marshal(&oapi.WsReceiveMessage{Type: event, Body: buf})
+	}
+	if err != nil {
+		p.room.stats.addError("ws_write", err)
+		return
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if err := p.conn.WriteMessage(frameType, buf); err != nil {
+		p.room.stats.addError("ws_write", err)
+		return
+	}
+
+	p.room.stats.count("sent_" + string(event))
+	if len(responses[event]) > 0 {
+		p.pending[event] = time.Now()
+	}
+}
+
+func (p *player) syntheticPNG() string {
+	size := p.room.cfg.imgSize
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	base := color.NRGBA{uint8(p.rng.Intn(256)), uint8(p.rng.Intn(256)), uint8(p.rng.Intn(256)), 0xff}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c := base
+			if p.room.cfg.noise {
+				c.R, c.G, c.B = uint8(p.rng.Intn(256)), uint8(p.rng.Intn(256)), uint8(p.rng.Intn(256))
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		p.room.stats.addError("png_encode", err)
+		return ""
+	}
+	p.room.stats.observeSize("png_bytes", buf.Len())
+
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
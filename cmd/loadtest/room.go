@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+)
+
+// room creates a room, lets the players join and plays the games.
+type room struct {
+	cfg   *config
+	stats *stats
+	seed  int64
+}
+
+func (r *room) run(ctx context.Context) {
+	rng := rand.New(rand.NewSource(r.seed))
+
+	res, err := r.post(ctx, "/rooms/new", "create_room", &oapi.CreateRoomRequest{
+		Username: "host",
+		Capacity: r.cfg.capacity,
+		Avatar:   oapi.Avatar{Type: 0, Color: "#ffffff"},
+	})
+	if err != nil {
+		r.stats.addError("create_room", err)
+		return
+	}
+
+	players := []*player{newPlayer(r, res.UserId.String(), true, rng.Int63())}
+	for i := 1; i < r.cfg.players; i++ {
+		jr, err := r.post(ctx, "/rooms/join", "join_room", &oapi.JoinRoomRequest{
+			Username: fmt.Sprintf("guest%d", i),
+			RoomId:   res.RoomId,
+			Avatar:   oapi.Avatar{Type: 0, Color: "#000000"},
+		})
+		if err != nil {
+			r.stats.addError("join_room", err)
+			return
+		}
+
+		players = append(players, newPlayer(r, jr.UserId.String(), false, rng.Int63()))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wg := sync.WaitGroup{}
+	for _, p := range players {
+		if err := p.connect(ctx); err != nil {
+			r.stats.addError("ws_connect", err)
+			return
+		}
+	}
+
+	for _, p := range players[1:] {
+		wg.Add(1)
+		go func(p *player) {
+			defer wg.Done()
+			p.play(ctx)
+		}(p)
+	}
+
+	// ホストの終了でルームの終了とする
+	host := players[0]
+	if host.play(ctx) {
+		r.stats.count("room_completed")
+	} else {
+		r.stats.count("room_incomplete")
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func (r *room) post(ctx context.Context, path string, metric string, body interface{}) (*oapi.Room, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.baseURL+path, bytes.NewReader(buf))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer res.Body.Close()
+	r.stats.observe(metric, time.Since(start))
+
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+
+	room := new(oapi.Room)
+	if err := json.NewDecoder(res.Body).Decode(room); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return room, nil
+}
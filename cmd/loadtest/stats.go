@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stats collects the results from all rooms.
+type stats struct {
+	mux       sync.Mutex
+	durations map[string][]time.Duration
+	sizes     map[string][]int
+	counts    map[string]int
+	errors    map[string]map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		durations: make(map[string][]time.Duration),
+		sizes:     make(map[string][]int),
+		counts:    make(map[string]int),
+		errors:    make(map[string]map[string]int),
+	}
+}
+
+func (s *stats) observe(metric string, d time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.durations[metric] = append(s.durations[metric], d)
+}
+
+func (s *stats) observeSize(metric string, n int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.sizes[metric] = append(s.sizes[metric], n)
+}
+
+func (s *stats) count(name string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.counts[name]++
+}
+
+func (s *stats) addError(metric string, err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if _, ok := s.errors[metric]; !ok {
+		s.errors[metric] = make(map[string]int)
+	}
+	s.errors[metric][err.Error()]++
+}
+
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	fmt.Fprintf(w, "elapsed: %s\n\n", elapsed.Round(time.Millisecond))
+
+	fmt.Fprintf(w, "%-32s %8s %10s %10s %10s %10s %10s\n", "latency", "count", "min", "p50", "p90", "p99", "max")
+	for _, metric := range sortedKeys(s.durations) {
+		ds := s.durations[metric]
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		fmt.Fprintf(w, "%-32s %8d %10s %10s %10s %10s %10s\n",
+			metric, len(ds),
+			round(ds[0]), round(percentile(ds, 50)), round(percentile(ds, 90)), round(percentile(ds, 99)), round(ds[len(ds)-1]),
+		)
+	}
+
+	if len(s.sizes) > 0 {
+		fmt.Fprintf(w, "\n%-32s %8s %10s %10s %10s\n", "size (bytes)", "count", "min", "p50", "max")
+		for _, metric := range sortedKeys(s.sizes) {
+			ns := s.sizes[metric]
+			sort.Ints(ns)
+			fmt.Fprintf(w, "%-32s %8d %10d %10d %10d\n", metric, len(ns), ns[0], ns[len(ns)*50/100], ns[len(ns)-1])
+		}
+	}
+
+	fmt.Fprintln(w)
+	printCounts(w, "events received", "event_", s.counts)
+	printCounts(w, "requests sent", "sent_", s.counts)
+	printCounts(w, "inputs skipped", "skipped_", s.counts)
+	printCounts(w, "phases completed", "phase_completed_", s.counts)
+
+	fmt.Fprintln(w, "summary")
+	for _, name := range []string{"room_completed", "room_incomplete", "game_completed", "room_closed_by_server", "disconnect", "reconnect"} {
+		fmt.Fprintf(w, "  %-30s %8d\n", name, s.counts[name])
+	}
+
+	if len(s.errors) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, "\nerrors")
+	for _, metric := range sortedKeys(s.errors) {
+		for _, msg := range sortedKeys(s.errors[metric]) {
+			fmt.Fprintf(w, "  %-16s %6d  %s\n", metric, s.errors[metric][msg], msg)
+		}
+	}
+}
+
+func printCounts(w io.Writer, title string, prefix string, counts map[string]int) {
+	names := make([]string, 0)
+	for _, name := range sortedKeys(counts) {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, title)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-30s %8d\n", strings.TrimPrefix(name, prefix), counts[name])
+	}
+	fmt.Fprintln(w)
+}
+
+func percentile(ds []time.Duration, p int) time.Duration {
+	return ds[(len(ds)-1)*p/100]
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(100 * time.Microsecond)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -1,18 +1,38 @@
 package infrastructure
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
 	"github.com/21hack02win/nascalay-backend/interfaces/handler"
 	"github.com/21hack02win/nascalay-backend/interfaces/repository"
+	"github.com/21hack02win/nascalay-backend/interfaces/storage"
 	"github.com/21hack02win/nascalay-backend/oapi"
+	usecasesbroker "github.com/21hack02win/nascalay-backend/usecases/broker"
+	usecases "github.com/21hack02win/nascalay-backend/usecases/repository"
 	"github.com/21hack02win/nascalay-backend/usecases/service/ws"
+	usecasesstorage "github.com/21hack02win/nascalay-backend/usecases/storage"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func Setup(e *echo.Echo, baseEndpoint string) {
+// imageTTL is how long the images are kept after they were sent last.
+// 送ったURLの有効期限より長くする
+const imageTTL = 30 * time.Minute
+
+// Setup registers the handlers and returns a function which gracefully
+// shuts down the WebSocket hub and persists the rooms to snapshotPath (if any).
+// If redisAddr is given, rooms are shared with the other instances via Redis.
+// batchWindow is the time to wait for more messages to send in a WebSocket frame.
+// Images sent by URL are saved in imagesDir (in memory if empty) and served under imageBaseURL (baseEndpoint if empty).
+// With Redis, imagesDir and imageSecret must be shared by all the instances.
+func Setup(e *echo.Echo, baseEndpoint string, snapshotPath string, redisAddr string, batchWindow time.Duration, imagesDir string, imageSecret string, imageBaseURL string) (func(ctx context.Context) error, error) {
 	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
 		Skipper: func(c echo.Context) bool {
 			return strings.HasPrefix(c.Request().URL.String(), "/assets")
@@ -24,8 +44,96 @@ func Setup(e *echo.Echo, baseEndpoint string) {
 	}))
 
 	repo := repository.NewRepository()
-	hub := ws.InitHub(repo)
+	if len(snapshotPath) > 0 {
+		if err := restoreSnapshot(repo, snapshotPath); err != nil {
+			e.Logger.Error(err.Error())
+		}
+	}
+
+	var b usecasesbroker.Broker
+	if len(redisAddr) > 0 {
+		// 画像の保存先か署名の鍵がインスタンスごとに違うと，他のインスタンスが送った画像のURLを開けない
+		if len(imagesDir) == 0 || len(imageSecret) == 0 {
+			return nil, errors.New("-images shared between instances and -image-secret are required to share rooms via Redis")
+		}
+
+		rb, err := broker.NewRedisBroker(redisAddr)
+		if err != nil {
+			return nil, err
+		}
+		b = rb
+	} else {
+		b = broker.NewLocalBroker()
+	}
+
+	var images usecasesstorage.ImageStore
+	if len(imagesDir) > 0 {
+		fs, err := storage.NewFileImageStore(imagesDir, imageTTL)
+		if err != nil {
+			return nil, err
+		}
+		images = fs
+	} else {
+		images = storage.NewMemoryImageStore(imageTTL)
+	}
+
+	if len(imageBaseURL) == 0 {
+		imageBaseURL = baseEndpoint
+	}
+
+	hub, err := ws.InitHub(repo, b, batchWindow, ws.ImageOptions{
+		Store:   images,
+		Secret:  []byte(imageSecret),
+		BaseURL: imageBaseURL,
+	})
+	if err != nil {
+		return nil, err
+	}
 	s := handler.NewHandler(repo, hub)
 
 	oapi.RegisterHandlersWithBaseURL(e, s, baseEndpoint)
+
+	return func(ctx context.Context) error {
+		if err := hub.Shutdown(ctx); err != nil {
+			e.Logger.Error(err.Error())
+		}
+
+		if len(snapshotPath) > 0 {
+			if err := saveSnapshot(repo, snapshotPath); err != nil {
+				return err
+			}
+		}
+
+		return b.Close()
+	}, nil
+}
+
+func restoreSnapshot(repo usecases.SnapshotRepository, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	if err := repo.LoadSnapshot(f); err != nil {
+		return fmt.Errorf("failed to restore rooms: %w", err)
+	}
+
+	return nil
+}
+
+func saveSnapshot(repo usecases.SnapshotRepository, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer f.Close()
+
+	if err := repo.SaveSnapshot(f); err != nil {
+		return fmt.Errorf("failed to persist rooms: %w", err)
+	}
+
+	return nil
 }
@@ -0,0 +1,192 @@
+package broker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/usecases/broker"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestBroker(t *testing.T) {
+	tests := []struct {
+		name      string
+		newBroker func(t *testing.T) broker.Broker
+	}{
+		{
+			name: "local",
+			newBroker: func(t *testing.T) broker.Broker {
+				return NewLocalBroker()
+			},
+		},
+		{
+			name: "redis",
+			newBroker: func(t *testing.T) broker.Broker {
+				s := miniredis.RunT(t)
+				b, err := NewRedisBroker(s.Addr())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return b
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.newBroker(t)
+			defer b.Close()
+
+			const n = 100
+			got := make(chan string, 2*n)
+			unsubscribe, err := b.Subscribe("room.test", func(payload []byte) {
+				got <- string(payload)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			other := make(chan string, n)
+			if _, err := b.Subscribe("room.other", func(payload []byte) {
+				other <- string(payload)
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			// Wait until the subscription becomes active
+			waitFor(t, func() bool {
+				if err := b.Publish("room.test", []byte("ping")); err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-got:
+					return true
+				case <-time.After(10 * time.Millisecond):
+					return false
+				}
+			})
+			drain(got)
+
+			for i := 0; i < n; i++ {
+				if err := b.Publish("room.test", []byte(fmt.Sprint(i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < n; i++ {
+				select {
+				case v := <-got:
+					if v != fmt.Sprint(i) {
+						t.Fatalf("message %d: got %q, want %q", i, v, fmt.Sprint(i))
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("message %d was not delivered", i)
+				}
+			}
+			if len(other) != 0 {
+				t.Errorf("messages leaked to another topic: %d", len(other))
+			}
+
+			unsubscribe()
+			if err := b.Publish("room.test", []byte("after unsubscribe")); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case v := <-got:
+				t.Errorf("message delivered after unsubscribe: %q", v)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestPublishRightAfterSubscribe(t *testing.T) {
+	s := miniredis.RunT(t)
+	b, err := NewRedisBroker(s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// Subscribe から戻った時点で購読が有効になっている
+	for i := 0; i < 20; i++ {
+		topic := fmt.Sprintf("room.%d", i)
+		got := make(chan string, 1)
+		if _, err := b.Subscribe(topic, func(payload []byte) {
+			got <- string(payload)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Publish(topic, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-got:
+		case <-time.After(time.Second):
+			t.Fatalf("message published right after subscribing to %s was lost", topic)
+		}
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	b := NewLocalBroker()
+
+	// ハンドラが止まったままバッファが埋まる
+	block := make(chan struct{})
+	defer close(block)
+	unsubscribe, err := b.Subscribe("room.slow", func(_ []byte) {
+		<-block
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < subscriptionBufferSize+2; i++ {
+			_ = b.Publish("room.slow", []byte(fmt.Sprint(i)))
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	unsubscribed := make(chan struct{})
+	go func() {
+		unsubscribe()
+		close(unsubscribed)
+	}()
+	select {
+	case <-unsubscribed:
+	case <-time.After(time.Second):
+		t.Fatal("unsubscribe is blocked by a slow subscriber")
+	}
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publisher is still blocked after unsubscribe")
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func drain(ch chan string) {
+	for {
+		select {
+		case <-ch:
+		case <-time.After(20 * time.Millisecond):
+			return
+		}
+	}
+}
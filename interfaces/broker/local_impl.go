@@ -0,0 +1,72 @@
+package broker
+
+import (
+	"sync"
+
+	"github.com/21hack02win/nascalay-backend/usecases/broker"
+)
+
+const subscriptionBufferSize = 256
+
+type localBroker struct {
+	mux           sync.RWMutex
+	subscriptions map[string]map[*subscription]struct{}
+}
+
+// NewLocalBroker returns a broker which only delivers messages within the process.
+func NewLocalBroker() broker.Broker {
+	return &localBroker{
+		subscriptions: make(map[string]map[*subscription]struct{}),
+	}
+}
+
+func (b *localBroker) Publish(topic string, payload []byte) error {
+	b.mux.RLock()
+	subs := make([]*subscription, 0, len(b.subscriptions[topic]))
+	for sub := range b.subscriptions[topic] {
+		subs = append(subs, sub)
+	}
+	b.mux.RUnlock()
+
+	for _, sub := range subs {
+		sub.deliver(payload)
+	}
+
+	return nil
+}
+
+func (b *localBroker) Subscribe(topic string, handler func(payload []byte)) (func(), error) {
+	sub := newSubscription(handler)
+
+	b.mux.Lock()
+	if _, ok := b.subscriptions[topic]; !ok {
+		b.subscriptions[topic] = make(map[*subscription]struct{})
+	}
+	b.subscriptions[topic][sub] = struct{}{}
+	b.mux.Unlock()
+
+	return func() {
+		b.mux.Lock()
+		delete(b.subscriptions[topic], sub)
+		if len(b.subscriptions[topic]) == 0 {
+			delete(b.subscriptions, topic)
+		}
+		b.mux.Unlock()
+
+		sub.close()
+	}, nil
+}
+
+func (b *localBroker) Close() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	for topic, subs := range b.subscriptions {
+		for sub := range subs {
+			sub.close()
+		}
+		delete(b.subscriptions, topic)
+	}
+
+	return nil
+}
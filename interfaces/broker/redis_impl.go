@@ -0,0 +1,155 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/usecases/broker"
+	"github.com/redis/go-redis/v9"
+)
+
+// subscribeTimeout is how long Subscribe waits for Redis to confirm the subscription.
+const subscribeTimeout = 5 * time.Second
+
+// redisBroker shares a single Redis Pub/Sub connection between all subscriptions.
+type redisBroker struct {
+	client        *redis.Client
+	pubsub        *redis.PubSub
+	mux           sync.RWMutex
+	subscriptions map[string]map[*subscription]struct{}
+	// confirmed は Redis が購読を確認したときに閉じる (確認済みのトピックは消す)
+	confirmMux sync.Mutex
+	confirmed  map[string]chan struct{}
+}
+
+// NewRedisBroker returns a broker which delivers messages via Redis Pub/Sub.
+func NewRedisBroker(addr string) (broker.Broker, error) {
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	b := &redisBroker{
+		client:        client,
+		pubsub:        client.Subscribe(ctx),
+		subscriptions: make(map[string]map[*subscription]struct{}),
+		confirmed:     make(map[string]chan struct{}),
+	}
+
+	go b.run()
+
+	return b, nil
+}
+
+func (b *redisBroker) run() {
+	for v := range b.pubsub.ChannelWithSubscriptions() {
+		switch msg := v.(type) {
+		case *redis.Subscription:
+			if msg.Kind == "subscribe" {
+				b.confirm(msg.Channel)
+			}
+		case *redis.Message:
+			b.mux.RLock()
+			subs := make([]*subscription, 0, len(b.subscriptions[msg.Channel]))
+			for sub := range b.subscriptions[msg.Channel] {
+				subs = append(subs, sub)
+			}
+			b.mux.RUnlock()
+
+			for _, sub := range subs {
+				sub.deliver([]byte(msg.Payload))
+			}
+		}
+	}
+}
+
+func (b *redisBroker) confirm(topic string) {
+	b.confirmMux.Lock()
+	defer b.confirmMux.Unlock()
+
+	// 再接続したときにも確認が届くので，待っているものがあるときだけ閉じる
+	if ch, ok := b.confirmed[topic]; ok {
+		close(ch)
+		delete(b.confirmed, topic)
+	}
+}
+
+func (b *redisBroker) Publish(topic string, payload []byte) error {
+	if err := b.client.Publish(context.Background(), topic, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+
+	return nil
+}
+
+func (b *redisBroker) Subscribe(topic string, handler func(payload []byte)) (func(), error) {
+	sub := newSubscription(handler)
+	unsubscribe := func() {
+		b.mux.Lock()
+		delete(b.subscriptions[topic], sub)
+		if len(b.subscriptions[topic]) == 0 {
+			delete(b.subscriptions, topic)
+			_ = b.pubsub.Unsubscribe(context.Background(), topic)
+		}
+		b.mux.Unlock()
+
+		sub.close()
+	}
+
+	b.mux.Lock()
+	_, subscribed := b.subscriptions[topic]
+	if !subscribed {
+		b.subscriptions[topic] = make(map[*subscription]struct{})
+	}
+	b.subscriptions[topic][sub] = struct{}{}
+
+	// 同じトピックを購読中の他の呼び出しも，確認が届くまで待つ (確認済みのときは nil)
+	b.confirmMux.Lock()
+	confirmed := b.confirmed[topic]
+	if !subscribed {
+		confirmed = make(chan struct{})
+		b.confirmed[topic] = confirmed
+	}
+	b.confirmMux.Unlock()
+	b.mux.Unlock()
+
+	if !subscribed {
+		if err := b.pubsub.Subscribe(context.Background(), topic); err != nil {
+			unsubscribe()
+			return nil, fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+		}
+	}
+
+	// 確認が届く前に Publish されたメッセージは届かないので，確認を待ってから返す
+	// run がメッセージを配るのにロックを取るので，ロックを放してから待つ
+	if confirmed != nil {
+		select {
+		case <-confirmed:
+		case <-time.After(subscribeTimeout):
+			unsubscribe()
+			return nil, fmt.Errorf("failed to subscribe to %s: no confirmation from redis", topic)
+		}
+	}
+
+	return unsubscribe, nil
+}
+
+func (b *redisBroker) Close() error {
+	b.mux.Lock()
+	for topic, subs := range b.subscriptions {
+		for sub := range subs {
+			sub.close()
+		}
+		delete(b.subscriptions, topic)
+	}
+	b.mux.Unlock()
+
+	if err := b.pubsub.Close(); err != nil {
+		return fmt.Errorf("failed to close pubsub: %w", err)
+	}
+
+	return b.client.Close()
+}
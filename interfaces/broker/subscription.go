@@ -0,0 +1,51 @@
+package broker
+
+import "sync"
+
+// subscription calls its handler from a dedicated goroutine so that a slow
+// subscriber does not block the publisher, while keeping messages in order.
+// バッファが埋まったときは送信側を待たせるが，close すればすぐに抜ける
+type subscription struct {
+	ch        chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSubscription(handler func(payload []byte)) *subscription {
+	sub := &subscription{
+		ch:   make(chan []byte, subscriptionBufferSize),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		for {
+			select {
+			case payload := <-sub.ch:
+				handler(payload)
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+
+	return sub
+}
+
+// deliver queues the payload for the handler.
+// ロックを取らずに送るので，遅いハンドラが close や他の購読を止めることはない
+func (s *subscription) deliver(payload []byte) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+
+	select {
+	case s.ch <- payload:
+	case <-s.done:
+	}
+}
+
+func (s *subscription) close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
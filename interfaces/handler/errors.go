@@ -4,20 +4,36 @@ import (
 	"errors"
 	"net/http"
 
+	"github.com/21hack02win/nascalay-backend/oapi"
 	"github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/usecases/service/ws"
+	"github.com/21hack02win/nascalay-backend/util/errcode"
 	"github.com/labstack/echo/v4"
 )
 
+var errServerClosing = errors.New("server is shutting down")
+
 func newEchoHTTPError(err error, c echo.Context) error {
 	switch {
 	case errors.Is(err, repository.ErrNotFound):
-		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		return newCodedHTTPError(c, http.StatusNotFound, ws.ErrorCodeOf(err), err)
 	case errors.Is(err, repository.ErrAlreadyExists):
-		return echo.NewHTTPError(http.StatusConflict, err.Error())
+		return newCodedHTTPError(c, http.StatusConflict, ws.ErrorCodeOf(err), err)
 	case errors.Is(err, repository.ErrForbidden):
-		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		return newCodedHTTPError(c, http.StatusForbidden, ws.ErrorCodeOf(err), err)
 	default:
 		c.Logger().Error(err.Error())
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return newCodedHTTPError(c, http.StatusInternalServerError, ws.ErrorCodeOf(err), err)
 	}
 }
+
+// newCodedHTTPError returns an error whose body has the same code as the ERROR event of WebSocket.
+func newCodedHTTPError(c echo.Context, status int, code oapi.ErrorCode, err error) error {
+	lang := errcode.LangOf(c.Request().Header.Get("Accept-Language"))
+
+	return echo.NewHTTPError(status, &oapi.Error{
+		Code:    code,
+		Message: errcode.Message(code, lang),
+		Content: err.Error(),
+	})
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/usecases/service/ws"
+	"github.com/21hack02win/nascalay-backend/usecases/storage"
+	"github.com/labstack/echo/v4"
+)
+
+func (h *handler) GetImage(c echo.Context, imageKey oapi.ImageKeyInPath, params oapi.GetImageParams) error {
+	key := string(imageKey)
+	data, err := h.ws.Image(key, int64(params.Expires), string(params.Signature))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			return newCodedHTTPError(c, http.StatusNotFound, oapi.ErrorCodeNOTFOUND, err)
+		case ws.ErrorCodeOf(err) == oapi.ErrorCodeINVALIDIMAGEURL:
+			return newCodedHTTPError(c, http.StatusForbidden, oapi.ErrorCodeINVALIDIMAGEURL, err)
+		default:
+			return newEchoHTTPError(err, c)
+		}
+	}
+
+	// 画像は内容のハッシュで保存しているので，キーが同じなら内容も変わらない
+	// URLの有効期限より長くはキャッシュさせない
+	etag := fmt.Sprintf("%q", key)
+	maxAge := time.Until(time.Unix(int64(params.Expires), 0)) / time.Second
+	c.Response().Header().Set("ETag", etag)
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", maxAge))
+
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.Blob(http.StatusOK, "image/png", data)
+}
@@ -11,9 +11,13 @@ import (
 )
 
 func (h *handler) JoinRoom(c echo.Context) error {
+	if h.ws.IsClosing() {
+		return newCodedHTTPError(c, http.StatusServiceUnavailable, oapi.ErrorCodeSERVERCLOSING, errServerClosing)
+	}
+
 	req := new(oapi.JoinRoomJSONRequestBody)
 	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return newCodedHTTPError(c, http.StatusBadRequest, oapi.ErrorCodeINVALIDBODY, err)
 	}
 
 	room, uid, err := h.r.JoinRoom(&repository.JoinRoomArgs{
@@ -39,9 +43,13 @@ func (h *handler) JoinRoom(c echo.Context) error {
 }
 
 func (h *handler) CreateRoom(c echo.Context) error {
+	if h.ws.IsClosing() {
+		return newCodedHTTPError(c, http.StatusServiceUnavailable, oapi.ErrorCodeSERVERCLOSING, errServerClosing)
+	}
+
 	req := new(oapi.CreateRoomJSONRequestBody)
 	if err := c.Bind(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return newCodedHTTPError(c, http.StatusBadRequest, oapi.ErrorCodeINVALIDBODY, err)
 	}
 
 	room, err := h.r.CreateRoom(&repository.CreateRoomArgs{
@@ -56,6 +64,9 @@ func (h *handler) CreateRoom(c echo.Context) error {
 		return newEchoHTTPError(err, c)
 	}
 
+	// Share the room with the other instances
+	h.ws.NotifyOfNewRoom(room)
+
 	c.Logger().Infof("%s(userId:%s) created the room", req.Username, room.HostId.UUID().String())
 
 	return c.JSON(http.StatusCreated, oapi.RefillRoom(room, room.HostId))
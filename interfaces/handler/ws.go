@@ -6,17 +6,30 @@ import (
 
 	"github.com/21hack02win/nascalay-backend/oapi"
 	"github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/usecases/service/ws"
 	"github.com/labstack/echo/v4"
 )
 
 func (h *handler) Ws(c echo.Context, params oapi.WsParams) error {
+	if h.ws.IsClosing() {
+		return newCodedHTTPError(c, http.StatusServiceUnavailable, oapi.ErrorCodeSERVERCLOSING, errServerClosing)
+	}
+
 	uid, err := params.User.Refill()
 	if err != nil {
 		// Invalid uuid
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return newCodedHTTPError(c, http.StatusBadRequest, oapi.ErrorCodeINVALIDBODY, err)
+	}
+
+	hs := ws.Handshake{}
+	if params.ProtocolVersion != nil {
+		hs.ProtocolVersion = int(*params.ProtocolVersion)
+	}
+	if params.Features != nil {
+		hs.Features = *params.Features
 	}
 
-	err = h.ws.ServeWS(c.Response().Writer, c.Request(), uid)
+	err = h.ws.ServeWS(c.Response().Writer, c.Request(), uid, hs)
 	if err != nil && !errors.Is(err, repository.ErrNotFound) {
 		return newEchoHTTPError(err, c)
 	}
@@ -1,11 +1,16 @@
 package repository
 
 import (
+	"sync"
+
 	"github.com/21hack02win/nascalay-backend/model"
 	"github.com/21hack02win/nascalay-backend/usecases/repository"
 )
 
+// storeRepository keeps the rooms in memory.
+// HTTP のハンドラと他のインスタンスからの複製が別の goroutine から書き込むので，mu で守る
 type storeRepository struct {
+	mu             sync.RWMutex
 	room           map[model.RoomId]*model.Room
 	userIdToRoomId map[model.UserId]model.RoomId
 }
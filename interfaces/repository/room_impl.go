@@ -7,6 +7,9 @@ import (
 )
 
 func (r *storeRepository) JoinRoom(jr *repository.JoinRoomArgs) (*model.Room, model.UserId, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	room, ok := r.room[jr.RoomId]
 	if !ok {
 		return nil, model.UserId{}, repository.ErrNotFound
@@ -23,12 +26,16 @@ func (r *storeRepository) JoinRoom(jr *repository.JoinRoomArgs) (*model.Room, mo
 		Id:     uid,
 		Name:   jr.Username,
 		Avatar: jr.Avatar,
+		Bot:    jr.Bot,
 	})
 
 	return room, uid, nil
 }
 
 func (r *storeRepository) CreateRoom(cr *repository.CreateRoomArgs) (*model.Room, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	rid := random.RoomId()
 	if _, ok := r.room[rid]; ok {
 		return nil, repository.ErrAlreadyExists
@@ -57,6 +64,9 @@ func (r *storeRepository) CreateRoom(cr *repository.CreateRoomArgs) (*model.Room
 }
 
 func (r *storeRepository) GetRoom(rid model.RoomId) (*model.Room, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	room, ok := r.room[rid]
 	if !ok {
 		return nil, repository.ErrNotFound
@@ -66,6 +76,9 @@ func (r *storeRepository) GetRoom(rid model.RoomId) (*model.Room, error) {
 }
 
 func (r *storeRepository) GetRoomFromUserId(uid model.UserId) (*model.Room, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	rid, ok := r.userIdToRoomId[uid]
 	if !ok {
 		return nil, repository.ErrNotFound
@@ -80,6 +93,9 @@ func (r *storeRepository) GetRoomFromUserId(uid model.UserId) (*model.Room, erro
 }
 
 func (r *storeRepository) DeleteRoom(rid model.RoomId) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if _, ok := r.room[rid]; !ok {
 		return repository.ErrNotFound
 	}
@@ -88,3 +104,59 @@ func (r *storeRepository) DeleteRoom(rid model.RoomId) error {
 
 	return nil
 }
+
+func (r *storeRepository) RestoreRoom(room *model.Room) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.room[room.Id]; ok {
+		return repository.ErrAlreadyExists
+	}
+
+	for _, m := range room.Members {
+		r.userIdToRoomId[m.Id] = room.Id
+	}
+
+	if room.Game == nil {
+		room.Game = model.InitGame()
+	}
+
+	r.room[room.Id] = room
+
+	return nil
+}
+
+func (r *storeRepository) AddRoomMember(rid model.RoomId, user model.User) (*model.Room, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	room, ok := r.room[rid]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+
+	for _, m := range room.Members {
+		if m.Id == user.Id {
+			return nil, repository.ErrAlreadyExists
+		}
+	}
+
+	r.userIdToRoomId[user.Id] = rid
+	room.Members = append(room.Members, user)
+
+	return room, nil
+}
+
+func (r *storeRepository) SetRoomHost(rid model.RoomId, uid model.UserId) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	room, ok := r.room[rid]
+	if !ok {
+		return repository.ErrNotFound
+	}
+
+	room.HostId = uid
+
+	return nil
+}
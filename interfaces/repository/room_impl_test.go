@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/util/random"
+)
+
+// TestConcurrentAccess runs the HTTP handlers and the replication from the other instances at the same time.
+// go test -race で競合がないことを確かめる
+func TestConcurrentAccess(t *testing.T) {
+	r := NewRepository()
+	room, err := r.CreateRoom(&repository.CreateRoomArgs{Capacity: 100, Username: "host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			if _, _, err := r.JoinRoom(&repository.JoinRoomArgs{RoomId: room.Id, Username: "guest"}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := r.AddRoomMember(room.Id, model.User{Id: random.UserId(), Name: "replica"}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := r.RestoreRoom(&model.Room{Id: random.RoomId(), Capacity: 4, HostId: random.UserId()}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := r.SetRoomHost(room.Id, random.UserId()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := r.GetRoom(room.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Members) != 1+2*n {
+		t.Errorf("%d members, want %d", len(got.Members), 1+2*n)
+	}
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/gofrs/uuid"
+)
+
+// NOTE: ゲームの進行状況(タイマーなど)は復元できないため，ルームとメンバーの情報のみ保存する
+type roomSnapshot struct {
+	Id       string         `json:"id"`
+	Capacity int            `json:"capacity"`
+	HostId   uuid.UUID      `json:"hostId"`
+	Members  []userSnapshot `json:"members"`
+	Teams    []teamSnapshot `json:"teams,omitempty"`
+}
+
+type userSnapshot struct {
+	Id          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	AvatarType  int       `json:"avatarType"`
+	AvatarColor string    `json:"avatarColor"`
+	Bot         bool      `json:"bot,omitempty"`
+}
+
+type teamSnapshot struct {
+	Id        int         `json:"id"`
+	MemberIds []uuid.UUID `json:"memberIds"`
+}
+
+func (r *storeRepository) SaveSnapshot(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rooms := make([]roomSnapshot, 0, len(r.room))
+	for _, room := range r.room {
+		members := make([]userSnapshot, len(room.Members))
+		for i, m := range room.Members {
+			members[i] = userSnapshot{
+				Id:          m.Id.UUID(),
+				Name:        m.Name.String(),
+				AvatarType:  m.Avatar.Type.Int(),
+				AvatarColor: m.Avatar.Color.String(),
+				Bot:         m.Bot,
+			}
+		}
+
+		teams := make([]teamSnapshot, len(room.Teams))
+		for i, t := range room.Teams {
+			memberIds := make([]uuid.UUID, len(t.MemberIds))
+			for j, m := range t.MemberIds {
+				memberIds[j] = m.UUID()
+			}
+			teams[i] = teamSnapshot{
+				Id:        t.Id.Int(),
+				MemberIds: memberIds,
+			}
+		}
+
+		rooms = append(rooms, roomSnapshot{
+			Id:       room.Id.String(),
+			Capacity: room.Capacity.Int(),
+			HostId:   room.HostId.UUID(),
+			Members:  members,
+			Teams:    teams,
+		})
+	}
+
+	if err := json.NewEncoder(w).Encode(rooms); err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func (r *storeRepository) LoadSnapshot(rd io.Reader) error {
+	rooms := make([]roomSnapshot, 0)
+	if err := json.NewDecoder(rd).Decode(&rooms); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	for _, rs := range rooms {
+		members := make([]model.User, len(rs.Members))
+		for i, m := range rs.Members {
+			members[i] = model.User{
+				Id:   model.UserId(m.Id),
+				Name: model.Username(m.Name),
+				Avatar: model.Avatar{
+					Type:  model.AvatarType(m.AvatarType),
+					Color: model.AvatarColor(m.AvatarColor),
+				},
+				Bot: m.Bot,
+			}
+		}
+
+		var teams []model.Team
+		for _, t := range rs.Teams {
+			memberIds := make([]model.UserId, len(t.MemberIds))
+			for j, m := range t.MemberIds {
+				memberIds[j] = model.UserId(m)
+			}
+			teams = append(teams, model.Team{
+				Id:        model.TeamId(t.Id),
+				MemberIds: memberIds,
+			})
+		}
+
+		if err := r.RestoreRoom(&model.Room{
+			Id:       model.RoomId(rs.Id),
+			Capacity: model.Capacity(rs.Capacity),
+			HostId:   model.UserId(rs.HostId),
+			Members:  members,
+			Teams:    teams,
+		}); err != nil {
+			return fmt.Errorf("failed to restore room(roomId:%s): %w", rs.Id, err)
+		}
+	}
+
+	return nil
+}
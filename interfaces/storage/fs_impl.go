@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/usecases/storage"
+)
+
+// sweepInterval is how often the stores delete the expired images.
+const sweepInterval = time.Minute
+
+type fileImageStore struct {
+	dir       string
+	ttl       time.Duration
+	mux       sync.Mutex
+	lastSweep time.Time
+}
+
+// NewFileImageStore returns a store which saves the images as files in the directory.
+// Images are deleted when ttl passes since they were saved last.
+// 複数インスタンスで動かすときは，同じディレクトリを共有すればどのインスタンスからも配信できる
+func NewFileImageStore(dir string, ttl time.Duration) (storage.ImageStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	return &fileImageStore{
+		dir:       dir,
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}, nil
+}
+
+func (s *fileImageStore) path(key string) string {
+	return filepath.Join(s.dir, key+".png")
+}
+
+func (s *fileImageStore) Put(data []byte) (string, error) {
+	key := storage.KeyOf(data)
+	path := s.path(key)
+	now := time.Now()
+
+	// 保存済みなら更新日時だけ延ばす
+	if err := os.Chtimes(path, now, now); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to touch image: %w", err)
+		}
+
+		// 書きかけのファイルを読まれないように，一時ファイルに書いてから置き換える
+		tmp, err := os.CreateTemp(s.dir, key+".*.tmp")
+		if err != nil {
+			return "", fmt.Errorf("failed to create image: %w", err)
+		}
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", fmt.Errorf("failed to write image: %w", err)
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return "", fmt.Errorf("failed to write image: %w", err)
+		}
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			os.Remove(tmp.Name())
+			return "", fmt.Errorf("failed to save image: %w", err)
+		}
+	}
+
+	s.sweep(now)
+
+	return key, nil
+}
+
+func (s *fileImageStore) Get(key string) ([]byte, error) {
+	if !storage.IsKey(key) {
+		return nil, storage.ErrNotFound
+	}
+
+	path := s.path(key)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to stat image: %w", err)
+	}
+
+	if time.Since(info.ModTime()) > s.ttl {
+		return nil, storage.ErrNotFound
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, storage.ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	return data, nil
+}
+
+// sweep deletes the images which have not been saved for ttl, at most once in sweepInterval.
+func (s *fileImageStore) sweep(now time.Time) {
+	s.mux.Lock()
+	if now.Sub(s.lastSweep) < sweepInterval {
+		s.mux.Unlock()
+		return
+	}
+	s.lastSweep = now
+	s.mux.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || e.IsDir() {
+			continue
+		}
+
+		if now.Sub(info.ModTime()) > s.ttl {
+			os.Remove(filepath.Join(s.dir, e.Name()))
+		}
+	}
+}
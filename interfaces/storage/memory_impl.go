@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/usecases/storage"
+)
+
+type memoryEntry struct {
+	data  []byte
+	putAt time.Time
+}
+
+type memoryImageStore struct {
+	mux       sync.Mutex
+	images    map[string]*memoryEntry
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+// NewMemoryImageStore returns a store which keeps the images in the process
+// until ttl passes since they were saved last.
+func NewMemoryImageStore(ttl time.Duration) storage.ImageStore {
+	return &memoryImageStore{
+		images:    make(map[string]*memoryEntry),
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryImageStore) Put(data []byte) (string, error) {
+	key := storage.KeyOf(data)
+	now := time.Now()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if e, ok := s.images[key]; ok {
+		e.putAt = now
+	} else {
+		// 呼び出し元がバッファを使い回してもよいようにコピーする
+		s.images[key] = &memoryEntry{data: append([]byte(nil), data...), putAt: now}
+	}
+
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		for k, e := range s.images {
+			if now.Sub(e.putAt) > s.ttl {
+				delete(s.images, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	return key, nil
+}
+
+func (s *memoryImageStore) Get(key string) ([]byte, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	e, ok := s.images[key]
+	if !ok || time.Since(e.putAt) > s.ttl {
+		return nil, storage.ErrNotFound
+	}
+
+	return e.data, nil
+}
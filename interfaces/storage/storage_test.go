@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/usecases/storage"
+)
+
+func TestImageStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		newStore func(t *testing.T, ttl time.Duration) storage.ImageStore
+	}{
+		{
+			name: "memory",
+			newStore: func(t *testing.T, ttl time.Duration) storage.ImageStore {
+				return NewMemoryImageStore(ttl)
+			},
+		},
+		{
+			name: "file",
+			newStore: func(t *testing.T, ttl time.Duration) storage.ImageStore {
+				s, err := NewFileImageStore(filepath.Join(t.TempDir(), "images"), ttl)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return s
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.newStore(t, time.Hour)
+
+			data := []byte("\x89PNG image")
+			key, err := s.Put(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != storage.KeyOf(data) || !storage.IsKey(key) {
+				t.Fatalf("Put() = %s, want the key of the content", key)
+			}
+
+			// 同じ内容は同じキーになる
+			if again, err := s.Put(append([]byte(nil), data...)); err != nil || again != key {
+				t.Fatalf("Put() again = %s, %v, want %s", again, err, key)
+			}
+
+			got, err := s.Get(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Get() = %q, want %q", got, data)
+			}
+
+			for _, k := range []string{storage.KeyOf([]byte("other")), "../images", ""} {
+				if _, err := s.Get(k); !errors.Is(err, storage.ErrNotFound) {
+					t.Errorf("Get(%q) error = %v, want ErrNotFound", k, err)
+				}
+			}
+
+			expired := tt.newStore(t, time.Millisecond)
+			key, err = expired.Put(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			if _, err := expired.Get(key); !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("Get() after ttl error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFileImageStoreSweep(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileImageStore(dir, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := s.Put([]byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, old+".png"), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	s.(*fileImageStore).lastSweep = past
+	if _, err := s.Put([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, old+".png")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired image is not deleted: %v", err)
+	}
+}
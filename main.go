@@ -1,25 +1,48 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/21hack02win/nascalay-backend/infrastructure"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
 	"github.com/21hack02win/nascalay-backend/util/logger"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 var (
 	baseEndpoint string
 	isDebugMode  bool
+	snapshotPath string
+	redisAddr    string
+	batchWindow  time.Duration
+	boardsDir    string
+	imagesDir    string
+	imageSecret  string
+	imageBaseURL string
 )
 
 func main() {
 	flag.StringVar(&baseEndpoint, "b", "", "Custom base endpoint .e.g \"/api\"")
 	flag.BoolVar(&isDebugMode, "d", false, "Debug mode")
+	flag.StringVar(&snapshotPath, "s", "", "File to persist rooms on shutdown and restore them on startup")
+	flag.StringVar(&redisAddr, "r", os.Getenv("REDIS_ADDR"), "Redis address to share rooms between instances .e.g \"localhost:6379\"")
+	flag.DurationVar(&batchWindow, "w", 0, "Time to wait for more messages to batch into a WebSocket frame .e.g \"5ms\"")
+	flag.StringVar(&boardsDir, "boards", "", "Directory of additional boards defined by polygons (.json) or colored areas (.png)")
+	flag.StringVar(&imagesDir, "images", "", "Directory to save the images sent by URL (in memory if empty, required with -r and shared between instances)")
+	flag.StringVar(&imageSecret, "image-secret", os.Getenv("IMAGE_SECRET"), "Secret to sign the image URLs (random if empty, required with -r and shared between instances)")
+	flag.StringVar(&imageBaseURL, "image-url", "", "Base URL of the image URLs .e.g \"https://api.example.com/api\" (the base endpoint if empty)")
 	flag.Parse()
 
 	e := echo.New()
@@ -32,9 +55,37 @@ func main() {
 
 	logger.Echo = e.Logger
 
-	infrastructure.Setup(e, baseEndpoint)
+	if len(boardsDir) > 0 {
+		if err := canvas.LoadBoards(os.DirFS(boardsDir)); err != nil {
+			e.Logger.Fatal(err)
+		}
+	}
+
+	shutdown, err := infrastructure.Setup(e, baseEndpoint, snapshotPath, redisAddr, batchWindow, imagesDir, imageSecret, imageBaseURL)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	go func() {
+		if err := e.Start(port()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	e.Logger.Fatal(e.Start(port()))
+	if err := shutdown(ctx); err != nil {
+		e.Logger.Error(err)
+	}
+
+	if err := e.Shutdown(ctx); err != nil {
+		e.Logger.Fatal(err)
+	}
 }
 
 func port() string {
@@ -1,11 +1,13 @@
 package model
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
 
 type Game struct {
+	Mode          GameMode
 	Status        GameStatus
 	Ready         sync.Map
 	Odais         []*Odai
@@ -17,8 +19,50 @@ type Game struct {
 	NextShowPhase GameNextShowPhase
 	Canvas        Canvas
 	BreakTimer    *time.Timer
+	Seed          int64 // 役割決めに使う乱数のシード
+	StepCount     StepCount
+	ShowStep      StepCount
+	Teams         []Team         // ゲーム開始時のチーム分け
+	Round         int            // 現在のラウンド (0-indexed)
+	RoundNum      int            // ラウンド数
+	History       [][]*Odai      // 終了したラウンドのお題
+	Paused        bool           // ホストが一時停止しているか
+	Remaining     time.Duration  // 一時停止したときのフェーズの残り時間
+	FogRadius     int            // DRAWフェーズで見えるエリアの範囲 (0のときは全体が見える)
+	AreaOrder     AreaOrder      // DRAWフェーズでエリアを埋める順番
+	Template      Img            // ホストが設定した全お題の下絵
+	OdaiTemplates map[UserId]Img // お題の送信者ごとの下絵 (Template より優先する)
+	Palette       Palette        // DRAWフェーズで使える色
 }
 
+type GameMode int
+
+const (
+	GameModeGrid  GameMode = iota // みんなでマスごとに描いて，最後に1人が回答する
+	GameModeRelay                 // 描く人と回答する人が交互にお題をつないでいく
+)
+
+// AreaOrder is the way to choose the area drawn on each turn.
+type AreaOrder int
+
+const (
+	AreaOrderRandom AreaOrder = iota // ランダムな順番
+	AreaOrderRaster                  // 左上から1行ずつ
+	AreaOrderSpiral                  // 外側から渦巻き状に
+	AreaOrderGrow                    // 中央から，描いたエリアに隣り合うように広げる
+	AreaOrderRegion                  // 描く人ごとにひとつながりの領域を描く
+)
+
+// Palette is the restriction of the colors used in the draw phases.
+type Palette int
+
+const (
+	PaletteFree       Palette = iota // 色を制限しない
+	PaletteMonochrome                // 白と黒
+	PaletteFour                      // 4色と背景の白
+	PalettePlayer                    // 描く人ごとに割り当てた1色
+)
+
 type GameStatus int
 
 const (
@@ -35,8 +79,30 @@ type Odai struct {
 	SenderId   UserId
 	AnswererId UserId
 	DrawerSeq  []Drawer
-	Img        Img
+	Img        *Raster // 描いた絵 (まだ誰も描いていないときは nil)
 	ImgUpdated bool
+	Chain      []RelayStep // GameModeRelayのときのみ
+	TeamId     TeamId      // チーム戦のときのみ
+	Template   Img         // 下絵 (描いた絵とは別に持つ)
+}
+
+// RelayStep is a step of the chain starting from an odai in the relay mode.
+// Even steps are drawings and odd steps are answers.
+type RelayStep struct {
+	UserId UserId
+	Img    *Raster // 描いた絵 (まだ描いていないときは nil)
+	Answer *OdaiAnswer
+}
+
+type StepCount int
+
+func (s StepCount) Int() int {
+	return int(s)
+}
+
+// IsDraw reports whether the step is a drawing in the relay mode.
+func (s StepCount) IsDraw() bool {
+	return s%2 == 0
 }
 
 type OdaiTitle string
@@ -54,7 +120,7 @@ func (o OdaiAnswer) String() string {
 type Img string
 
 func (i Img) AddPrefix() string {
-	return "data:image/png;base64," + string(i)
+	return imgPrefix + string(i)
 }
 
 type Drawer struct {
@@ -70,10 +136,16 @@ func (i AreaId) Int() int {
 
 type TimeLimit int
 
-const DefaultTimeLimit = TimeLimit(30) // Default time limit is 30 seconds
+const (
+	DefaultTimeLimit = TimeLimit(30)  // Default time limit is 30 seconds
+	MaxTimeLimit     = TimeLimit(300) // 5分より長いフェーズは想定しない
+)
 
 type Timeout time.Time
 
+// MaxFogRadius is the radius which shows the whole of the largest board from any area.
+const MaxFogRadius = 4
+
 type DrawCount int
 
 func (d DrawCount) Int() int {
@@ -104,12 +176,25 @@ const (
 	BoardName4x4 = "4x4" // default
 	BoardName5x5 = "5x5"
 	BoardName4x3 = "4x3"
+	BoardName1x1 = "1x1" // relay mode
 )
 
 var boardNameToAllArea = map[string]int{
 	BoardName4x4: 16,
 	BoardName5x5: 25,
 	BoardName4x3: 12,
+	BoardName1x1: 1,
+}
+
+// Size returns the number of the columns and the rows of the board.
+// マスクで定義されたボードなど，ボード名が読めないときは AllArea 個のエリアが1行に並んでいるとみなす
+func (c Canvas) Size() (int, int) {
+	var cols, rows int
+	if _, err := fmt.Sscanf(c.BoardName, "%dx%d", &cols, &rows); err != nil || cols <= 0 || rows <= 0 || cols*rows != c.AllArea {
+		return c.AllArea, 1
+	}
+
+	return cols, rows
 }
 
 func InitGame() *Game {
@@ -128,17 +213,95 @@ func InitGame() *Game {
 			AllArea:   boardNameToAllArea[BoardName4x4],
 		},
 		BreakTimer: time.NewTimer(0),
+		Seed:       time.Now().UnixNano(),
+		RoundNum:   DefaultRoundNum,
 	}
 }
 
+// SetMode changes the game mode and the board for the mode.
+func (g *Game) SetMode(mode GameMode) {
+	g.Mode = mode
+
+	boardName := DefaultBoardNameOf(mode)
+	g.Canvas = Canvas{
+		BoardName: boardName,
+		AllArea:   boardNameToAllArea[boardName],
+	}
+}
+
+// DefaultBoardNameOf returns the board which SetMode sets for the mode.
+func DefaultBoardNameOf(mode GameMode) string {
+	if mode == GameModeRelay {
+		return BoardName1x1
+	}
+
+	return BoardName4x4
+}
+
+// SetBoard changes the board of the grid mode.
+// エリアの数はボードの定義 (util/canvas) から渡す
+func (g *Game) SetBoard(boardName string, allArea int) {
+	g.Canvas = Canvas{
+		BoardName: boardName,
+		AllArea:   allArea,
+	}
+}
+
+// MinRelayMembers is the number of the members needed to play the relay mode.
+// 2人では自分以外に回答する人がいないので，回答で終わるチェーンを作れない
+const MinRelayMembers = 3
+
+// RelayStepNum returns the number of the steps of each chain in the relay mode.
+func (g *Game) RelayStepNum() int {
+	if len(g.Odais) == 0 {
+		return 0
+	}
+
+	return len(g.Odais[0].Chain)
+}
+
 func (g *Game) AddOdai(uid UserId, title OdaiTitle) {
 	g.Odais = append(g.Odais, &Odai{
 		Title:     title,
 		SenderId:  uid,
 		DrawerSeq: []Drawer{},
+		Template:  g.TemplateOf(uid),
 	})
 }
 
+// TemplateOf returns the template for the odai written by the member.
+func (g *Game) TemplateOf(uid UserId) Img {
+	if t, ok := g.OdaiTemplates[uid]; ok {
+		return t
+	}
+
+	return g.Template
+}
+
+// SetTemplate sets the template of all odais, or of the odai written by the member when uid is not nil.
+// 空の下絵を渡したときは消す
+func (g *Game) SetTemplate(uid *UserId, img Img) {
+	if uid == nil {
+		g.Template = img
+		return
+	}
+
+	if len(img) == 0 {
+		delete(g.OdaiTemplates, *uid)
+		return
+	}
+
+	if g.OdaiTemplates == nil {
+		g.OdaiTemplates = make(map[UserId]Img)
+	}
+	g.OdaiTemplates[*uid] = img
+}
+
+// HasTemplate reports whether the host has set any template.
+func (g *Game) HasTemplate() bool {
+	return len(g.Template) > 0 || len(g.OdaiTemplates) > 0
+}
+
 func (g *Game) ReadyCount() int {
 	count := 0
 	g.Ready.Range(func(_, _ interface{}) bool {
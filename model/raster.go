@@ -0,0 +1,118 @@
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/draw"
+	"image/png"
+	"sync"
+)
+
+const imgPrefix = "data:image/png;base64,"
+
+// pngEncoder reuses the buffers for compression between the rasters.
+var pngEncoder = png.Encoder{BufferPool: new(pngBufferPool)}
+
+type pngBufferPool sync.Pool
+
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	b, _ := (*sync.Pool)(p).Get().(*png.EncoderBuffer)
+	return b
+}
+
+func (p *pngBufferPool) Put(b *png.EncoderBuffer) {
+	(*sync.Pool)(p).Put(b)
+}
+
+// Raster is a drawing kept decoded in memory.
+// 描き足すたびにデコードし直さないように RGBA のまま持ち，
+// PNG のデータURLは送るときに一度だけ作って描き変えるまで使い回す
+type Raster struct {
+	mu      sync.Mutex
+	rgba    *image.RGBA
+	dataURL string // エンコードのキャッシュ (描き変えたら空にする)
+}
+
+// NewRaster returns a raster with a copy of the image.
+func NewRaster(img image.Image) *Raster {
+	r := new(Raster)
+	r.Draw(img)
+
+	return r
+}
+
+// IsEmpty reports whether nothing has been drawn yet.
+func (r *Raster) IsEmpty() bool {
+	if r == nil {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rgba == nil
+}
+
+// Draw composites the image over the raster.
+// 最初に描いた画像の大きさをキャンバスの大きさにする
+func (r *Raster) Draw(src image.Image) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rgba == nil {
+		r.rgba = image.NewRGBA(image.Rectangle{Max: src.Bounds().Size()})
+	}
+
+	draw.Draw(r.rgba, r.rgba.Bounds(), src, src.Bounds().Min, draw.Over)
+	r.dataURL = ""
+}
+
+// Image returns a copy of the pixels of the raster, or nil if nothing has been drawn.
+// 返した後に Draw されても変わらないように，ロックを取ったままコピーする
+func (r *Raster) Image() image.Image {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rgba == nil {
+		return nil
+	}
+
+	img := image.NewRGBA(r.rgba.Rect)
+	copy(img.Pix, r.rgba.Pix)
+
+	return img
+}
+
+// DataURL returns the raster as a PNG data URL, which is empty after the prefix if nothing has been drawn.
+func (r *Raster) DataURL() string {
+	if r == nil {
+		return imgPrefix
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rgba == nil {
+		return imgPrefix
+	}
+
+	if len(r.dataURL) == 0 {
+		buf := new(bytes.Buffer)
+		// 大きさが0でない RGBA のエンコードは失敗しない
+		if err := pngEncoder.Encode(buf, r.rgba); err != nil {
+			return imgPrefix
+		}
+
+		url := make([]byte, len(imgPrefix)+base64.StdEncoding.EncodedLen(buf.Len()))
+		copy(url, imgPrefix)
+		base64.StdEncoding.Encode(url[len(imgPrefix):], buf.Bytes())
+		r.dataURL = string(url)
+	}
+
+	return r.dataURL
+}
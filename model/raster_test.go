@@ -0,0 +1,158 @@
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const (
+	testWidth  = 640
+	testHeight = 480
+	testCols   = 4
+	testRows   = 4
+)
+
+// testDrawings returns a base64 encoded PNG for each area of a 4x4 board,
+// which is transparent outside of the area like the drawings sent in DRAW_SEND.
+func testDrawings(tb testing.TB) []string {
+	tb.Helper()
+
+	rng := rand.New(rand.NewSource(1))
+	w, h := testWidth/testCols, testHeight/testRows
+	drawings := make([]string, testCols*testRows)
+	for i := range drawings {
+		img := image.NewRGBA(image.Rect(0, 0, testWidth, testHeight))
+		area := image.Rect(i%testCols*w, i/testCols*h, (i%testCols+1)*w, (i/testCols+1)*h)
+		// 線画らしく，少ない色の横線を並べる
+		for y := area.Min.Y; y < area.Max.Y; y += 4 {
+			c := color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 0xff}
+			draw.Draw(img, image.Rect(area.Min.X+rng.Intn(w/2), y, area.Max.X-rng.Intn(w/2), y+2), image.NewUniform(c), image.Point{}, draw.Src)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := png.Encode(buf, img); err != nil {
+			tb.Fatal(err)
+		}
+		drawings[i] = base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+
+	return drawings
+}
+
+func decodeTestImage(tb testing.TB, b64 string) image.Image {
+	tb.Helper()
+
+	img, _, err := image.Decode(base64.NewDecoder(base64.StdEncoding, strings.NewReader(b64)))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return img
+}
+
+// mergeEncoded is how the drawings were merged before Raster: both images are decoded and encoded again on every DRAW_SEND.
+func mergeEncoded(tb testing.TB, a, b string) string {
+	tb.Helper()
+
+	ai, bi := decodeTestImage(tb, a), decodeTestImage(tb, b)
+	rect := image.Rectangle{Max: ai.Bounds().Size()}
+	rgba := image.NewRGBA(rect)
+	draw.Draw(rgba, rect, ai, image.Point{}, draw.Src)
+	draw.Draw(rgba, rect, bi, image.Point{}, draw.Over)
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, rgba); err != nil {
+		tb.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestRaster(t *testing.T) {
+	var empty *Raster
+	if !empty.IsEmpty() || empty.DataURL() != imgPrefix || empty.Image() != nil {
+		t.Fatal("nil raster is not empty")
+	}
+
+	drawings := testDrawings(t)
+	r := NewRaster(decodeTestImage(t, drawings[0]))
+	first := r.DataURL()
+	if r.DataURL() != first {
+		t.Fatal("DataURL() is not cached")
+	}
+
+	r.Draw(decodeTestImage(t, drawings[1]))
+	second := r.DataURL()
+	if second == first {
+		t.Fatal("DataURL() is not invalidated by Draw()")
+	}
+
+	// 重ね方が前と同じなので，画素は文字列のまま重ねた結果と一致する
+	want := decodeTestImage(t, mergeEncoded(t, drawings[0], drawings[1]))
+	got := decodeTestImage(t, strings.TrimPrefix(second, imgPrefix))
+	for y := 0; y < testHeight; y++ {
+		for x := 0; x < testWidth; x++ {
+			if got.At(x, y) != want.At(x, y) {
+				t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, got.At(x, y), want.At(x, y))
+			}
+		}
+	}
+
+	// 返した画像は後から描き足しても変わらない
+	img := r.Image()
+	r.Draw(image.NewUniform(color.Black))
+	if color.RGBAModel.Convert(img.At(0, 0)) != color.RGBAModel.Convert(want.At(0, 0)) {
+		t.Errorf("Image() = %v at (0, 0) after Draw(), want %v", img.At(0, 0), want.At(0, 0))
+	}
+}
+
+// The benchmarks play the draw phases of an odai on a 4x4 board: every phase merges a drawing
+// and builds the data URL sent in DRAW_START, and ANSWER_START and SHOW_CANVAS send it once more at the end.
+// ns/op と allocs/op は 1 お題 (16 フェーズ) あたり
+func BenchmarkDrawPhasesEncoded(b *testing.B) {
+	drawings := testDrawings(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var img Img
+		for _, d := range drawings {
+			if len(img) > 0 {
+				img = Img(mergeEncoded(b, string(img), d))
+			} else {
+				img = Img(d)
+			}
+			_ = img.AddPrefix()
+		}
+		_ = img.AddPrefix()
+		_ = img.AddPrefix()
+	}
+}
+
+func BenchmarkDrawPhasesRaster(b *testing.B) {
+	drawings := testDrawings(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var r *Raster
+		for _, d := range drawings {
+			src := decodeTestImage(b, d)
+			if r == nil {
+				r = NewRaster(src)
+			} else {
+				r.Draw(src)
+			}
+			_ = r.DataURL()
+		}
+		_ = r.DataURL()
+		_ = r.DataURL()
+	}
+}
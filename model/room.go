@@ -5,6 +5,7 @@ type Room struct {
 	Capacity Capacity
 	HostId   UserId
 	Members  []User
+	Teams    []Team
 	Game     *Game
 }
 
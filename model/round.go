@@ -0,0 +1,118 @@
+package model
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+const (
+	DefaultRoundNum = 1
+	MaxRoundNum     = 10
+)
+
+type MemberScore struct {
+	UserId UserId
+	Score  int
+}
+
+func (g *Game) IsFinalRound() bool {
+	return g.Round+1 >= g.RoundNum
+}
+
+// NextRound keeps the odais of the current round in the history
+// and resets the progress of the game for the next round.
+func (g *Game) NextRound() {
+	g.History = append(g.History, g.Odais)
+	g.Round++
+
+	g.Odais = make([]*Odai, 0, len(g.Odais))
+	g.ResetReady()
+	g.DrawCount = 0
+	g.ShowCount = 0
+	g.NextShowPhase = GameShowPhaseOdai
+	g.StepCount = 0
+	g.ShowStep = 0
+	// 次のラウンドのシードは今のシードから決めるので，最初のシードからゲーム全体を再現できる
+	g.Seed = rand.New(rand.NewSource(g.Seed)).Int63()
+}
+
+// IsCorrect reports whether the last answer for the odai matches its title.
+func (o *Odai) IsCorrect() bool {
+	answer := o.Answer
+	if len(o.Chain) > 0 {
+		answer = o.Chain[len(o.Chain)-1].Answer
+	}
+
+	if answer == nil {
+		return false
+	}
+
+	return strings.EqualFold(strings.TrimSpace(answer.String()), strings.TrimSpace(o.Title.String()))
+}
+
+// Participants returns the members who drew or answered the odai.
+func (o *Odai) Participants() []UserId {
+	seen := make(map[UserId]struct{})
+	uids := make([]UserId, 0, len(o.DrawerSeq)+len(o.Chain)+1)
+	add := func(uid UserId) {
+		if _, ok := seen[uid]; ok || uid == (UserId{}) {
+			return
+		}
+		seen[uid] = struct{}{}
+		uids = append(uids, uid)
+	}
+
+	for _, d := range o.DrawerSeq {
+		add(d.UserId)
+	}
+	for _, s := range o.Chain {
+		add(s.UserId)
+	}
+	add(o.AnswererId)
+
+	return uids
+}
+
+// MemberScores returns the cumulative scores of the members in descending order.
+// 正解したお題に描いた・回答したメンバーに1点ずつ入る
+func (g *Game) MemberScores(members []User, shown int) []MemberScore {
+	points := make(map[UserId]int, len(members))
+	for _, o := range g.shownOdais(shown) {
+		if !o.IsCorrect() {
+			continue
+		}
+
+		for _, uid := range o.Participants() {
+			points[uid]++
+		}
+	}
+
+	scores := make([]MemberScore, len(members))
+	for i, m := range members {
+		scores[i] = MemberScore{
+			UserId: m.Id,
+			Score:  points[m.Id],
+		}
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		return scores[i].Score > scores[j].Score
+	})
+
+	return scores
+}
+
+// shownOdais returns the odais of the previous rounds and the first shown odais of the current round.
+func (g *Game) shownOdais(shown int) []*Odai {
+	odais := make([]*Odai, 0)
+	for _, h := range g.History {
+		odais = append(odais, h...)
+	}
+
+	if shown > len(g.Odais) {
+		shown = len(g.Odais)
+	}
+
+	return append(odais, g.Odais[:shown]...)
+}
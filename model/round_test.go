@@ -0,0 +1,105 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func testUsers(n int) []User {
+	users := make([]User, n)
+	for i := range users {
+		users[i] = User{Id: UserId(uuid.Must(uuid.NewV4()))}
+	}
+
+	return users
+}
+
+func answerOf(s string) *OdaiAnswer {
+	a := OdaiAnswer(s)
+	return &a
+}
+
+func TestNextRound(t *testing.T) {
+	g := InitGame()
+	g.RoundNum = 2
+	g.Odais = []*Odai{{Title: "ねこ"}}
+	g.DrawCount = 3
+	g.ShowCount = 1
+
+	if g.IsFinalRound() {
+		t.Fatal("the first of 2 rounds is the final round")
+	}
+
+	g.NextRound()
+	if g.Round != 1 || len(g.Odais) != 0 || g.DrawCount != 0 || g.ShowCount != 0 {
+		t.Errorf("game = {round: %d, odais: %d, drawCount: %d, showCount: %d}, want the next round from the start",
+			g.Round, len(g.Odais), g.DrawCount, g.ShowCount)
+	}
+	if len(g.History) != 1 || g.History[0][0].Title != "ねこ" {
+		t.Errorf("history = %v, want the odais of the first round", g.History)
+	}
+	if !g.IsFinalRound() {
+		t.Error("the second of 2 rounds is not the final round")
+	}
+}
+
+func TestIsCorrect(t *testing.T) {
+	tests := []struct {
+		name string
+		odai *Odai
+		want bool
+	}{
+		{name: "correct", odai: &Odai{Title: "ねこ", Answer: answerOf(" ねこ ")}, want: true},
+		{name: "case insensitive", odai: &Odai{Title: "Cat", Answer: answerOf("cat")}, want: true},
+		{name: "wrong", odai: &Odai{Title: "ねこ", Answer: answerOf("いぬ")}},
+		{name: "no answer", odai: &Odai{Title: "ねこ"}},
+		{
+			name: "last step of the chain",
+			odai: &Odai{Title: "ねこ", Chain: []RelayStep{{}, {Answer: answerOf("いぬ")}, {}, {Answer: answerOf("ねこ")}}},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.odai.IsCorrect(); got != tt.want {
+				t.Errorf("IsCorrect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemberScores(t *testing.T) {
+	users := testUsers(3)
+	g := InitGame()
+	g.RoundNum = 2
+
+	// 1 ラウンド目: 0 が描いて 1 が正解した
+	g.Odais = []*Odai{{
+		Title:      "ねこ",
+		Answer:     answerOf("ねこ"),
+		DrawerSeq:  []Drawer{{UserId: users[0].Id}},
+		AnswererId: users[1].Id,
+	}}
+	g.NextRound()
+
+	// 2 ラウンド目: 2 が描いて 1 が正解したが，まだ表示していない
+	g.Odais = []*Odai{{
+		Title:      "いぬ",
+		Answer:     answerOf("いぬ"),
+		DrawerSeq:  []Drawer{{UserId: users[2].Id}},
+		AnswererId: users[1].Id,
+	}}
+
+	want := map[UserId]int{users[0].Id: 1, users[1].Id: 1, users[2].Id: 0}
+	for _, s := range g.MemberScores(users, 0) {
+		if s.Score != want[s.UserId] {
+			t.Errorf("score before showing = %d, want %d", s.Score, want[s.UserId])
+		}
+	}
+
+	scores := g.MemberScores(users, 1)
+	if scores[0].UserId != users[1].Id || scores[0].Score != 2 {
+		t.Errorf("top score = %v, want %v with 2 points", scores[0], users[1].Id)
+	}
+}
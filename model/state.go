@@ -0,0 +1,52 @@
+package model
+
+// gameTransitions declares the phases which can follow each phase in each mode.
+var gameTransitions = map[GameMode]map[GameStatus][]GameStatus{
+	GameModeGrid: {
+		GameStatusRoom:   {GameStatusOdai},
+		GameStatusOdai:   {GameStatusDraw},
+		GameStatusDraw:   {GameStatusDraw, GameStatusAnswer},
+		GameStatusAnswer: {GameStatusShow},
+		GameStatusShow:   {GameStatusRoom, GameStatusOdai},
+	},
+	GameModeRelay: {
+		GameStatusRoom:   {GameStatusOdai},
+		GameStatusOdai:   {GameStatusDraw},
+		GameStatusDraw:   {GameStatusAnswer, GameStatusShow},
+		GameStatusAnswer: {GameStatusDraw, GameStatusShow},
+		GameStatusShow:   {GameStatusRoom, GameStatusOdai},
+	},
+}
+
+func (s GameStatus) String() string {
+	switch s {
+	case GameStatusRoom:
+		return "ROOM"
+	case GameStatusOdai:
+		return "ODAI"
+	case GameStatusDraw:
+		return "DRAW"
+	case GameStatusAnswer:
+		return "ANSWER"
+	case GameStatusShow:
+		return "SHOW"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// CanTransitTo reports whether the game can move from the current phase to next.
+func (g *Game) CanTransitTo(next GameStatus) bool {
+	for _, v := range gameTransitions[g.Mode][g.Status] {
+		if v == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasTimeLimit reports whether the phase finishes when the time limit comes.
+func (s GameStatus) HasTimeLimit() bool {
+	return s == GameStatusOdai || s == GameStatusDraw || s == GameStatusAnswer
+}
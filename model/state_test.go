@@ -0,0 +1,51 @@
+package model
+
+import "testing"
+
+func TestCanTransitTo(t *testing.T) {
+	tests := []struct {
+		mode     GameMode
+		from, to GameStatus
+		want     bool
+	}{
+		{mode: GameModeGrid, from: GameStatusRoom, to: GameStatusOdai, want: true},
+		{mode: GameModeGrid, from: GameStatusOdai, to: GameStatusDraw, want: true},
+		{mode: GameModeGrid, from: GameStatusDraw, to: GameStatusDraw, want: true},
+		{mode: GameModeGrid, from: GameStatusDraw, to: GameStatusAnswer, want: true},
+		{mode: GameModeGrid, from: GameStatusAnswer, to: GameStatusShow, want: true},
+		{mode: GameModeGrid, from: GameStatusShow, to: GameStatusRoom, want: true},
+		{mode: GameModeGrid, from: GameStatusShow, to: GameStatusOdai, want: true},
+		{mode: GameModeGrid, from: GameStatusRoom, to: GameStatusDraw, want: false},
+		{mode: GameModeGrid, from: GameStatusDraw, to: GameStatusShow, want: false},
+		{mode: GameModeGrid, from: GameStatusAnswer, to: GameStatusDraw, want: false},
+		// リレーモードでは描くステップと答えるステップが交互に来て，どちらでも終わりうる
+		{mode: GameModeRelay, from: GameStatusOdai, to: GameStatusDraw, want: true},
+		{mode: GameModeRelay, from: GameStatusDraw, to: GameStatusAnswer, want: true},
+		{mode: GameModeRelay, from: GameStatusAnswer, to: GameStatusDraw, want: true},
+		{mode: GameModeRelay, from: GameStatusDraw, to: GameStatusShow, want: true},
+		{mode: GameModeRelay, from: GameStatusAnswer, to: GameStatusShow, want: true},
+		{mode: GameModeRelay, from: GameStatusShow, to: GameStatusOdai, want: true},
+		{mode: GameModeRelay, from: GameStatusDraw, to: GameStatusDraw, want: false},
+		{mode: GameModeRelay, from: GameStatusOdai, to: GameStatusAnswer, want: false},
+	}
+	for _, tt := range tests {
+		g := &Game{Mode: tt.mode, Status: tt.from}
+		if got := g.CanTransitTo(tt.to); got != tt.want {
+			t.Errorf("CanTransitTo(%s) from %s in mode %d = %v, want %v", tt.to, tt.from, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestHasTimeLimit(t *testing.T) {
+	for s, want := range map[GameStatus]bool{
+		GameStatusRoom:   false,
+		GameStatusOdai:   true,
+		GameStatusDraw:   true,
+		GameStatusAnswer: true,
+		GameStatusShow:   false,
+	} {
+		if got := s.HasTimeLimit(); got != want {
+			t.Errorf("%s.HasTimeLimit() = %v, want %v", s, got, want)
+		}
+	}
+}
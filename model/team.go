@@ -0,0 +1,148 @@
+package model
+
+import "sort"
+
+type TeamId int
+
+func (tid TeamId) Int() int {
+	return int(tid)
+}
+
+type Team struct {
+	Id        TeamId
+	MemberIds []UserId
+}
+
+type TeamStanding struct {
+	TeamId TeamId
+	Score  int
+	Rank   int
+}
+
+// NOTE: Room.Teams が空のときはチームに分けずに全員で遊ぶ
+
+func (r *Room) TeamModeEnabled() bool {
+	return len(r.Teams) > 0
+}
+
+// TeamsAreBalanced reports whether all members belong to one of the teams
+// and every team has the same number of members, at least 2.
+// チームごとに同じお題を同じ人数で描くため
+func (r *Room) TeamsAreBalanced() bool {
+	if len(r.Teams) < 2 {
+		return false
+	}
+
+	size := len(r.Teams[0].MemberIds)
+	count := 0
+	for _, t := range r.Teams {
+		if len(t.MemberIds) != size || size < 2 {
+			return false
+		}
+		count += size
+	}
+
+	return count == len(r.Members)
+}
+
+func (r *Room) TeamOf(uid UserId) (TeamId, bool) {
+	for _, t := range r.Teams {
+		for _, m := range t.MemberIds {
+			if m == uid {
+				return t.Id, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// MoveMemberToTeam moves the member to the team and reports whether the team exists.
+func (r *Room) MoveMemberToTeam(uid UserId, tid TeamId) bool {
+	if tid.Int() < 0 || len(r.Teams) <= tid.Int() {
+		return false
+	}
+
+	r.removeMemberFromTeams(uid)
+	r.Teams[tid].MemberIds = append(r.Teams[tid].MemberIds, uid)
+
+	return true
+}
+
+// AddMemberToTeam adds the new member to the smallest team.
+func (r *Room) AddMemberToTeam(uid UserId) {
+	if !r.TeamModeEnabled() {
+		return
+	}
+
+	smallest := 0
+	for i, t := range r.Teams {
+		if len(t.MemberIds) < len(r.Teams[smallest].MemberIds) {
+			smallest = i
+		}
+	}
+
+	r.MoveMemberToTeam(uid, TeamId(smallest))
+}
+
+// CopyTeams returns a copy of the teams which is not affected by later changes.
+func (r *Room) CopyTeams() []Team {
+	if !r.TeamModeEnabled() {
+		return nil
+	}
+
+	teams := make([]Team, len(r.Teams))
+	for i, t := range r.Teams {
+		teams[i] = Team{
+			Id:        t.Id,
+			MemberIds: append([]UserId{}, t.MemberIds...),
+		}
+	}
+
+	return teams
+}
+
+func (r *Room) removeMemberFromTeams(uid UserId) {
+	for i, t := range r.Teams {
+		for j, m := range t.MemberIds {
+			if m == uid {
+				r.Teams[i].MemberIds = append(t.MemberIds[:j:j], t.MemberIds[j+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// TeamStandings ranks the teams by the correct answers in the previous rounds
+// and the first shown odais of the current round.
+func (g *Game) TeamStandings(shown int) []TeamStanding {
+	teams := g.Teams
+	scores := make(map[TeamId]int, len(teams))
+	for _, o := range g.shownOdais(shown) {
+		if o.IsCorrect() {
+			scores[o.TeamId]++
+		}
+	}
+
+	standings := make([]TeamStanding, len(teams))
+	for i, t := range teams {
+		standings[i] = TeamStanding{
+			TeamId: t.Id,
+			Score:  scores[t.Id],
+		}
+	}
+
+	sort.SliceStable(standings, func(i, j int) bool {
+		return standings[i].Score > standings[j].Score
+	})
+
+	for i := range standings {
+		if i > 0 && standings[i].Score == standings[i-1].Score {
+			standings[i].Rank = standings[i-1].Rank
+		} else {
+			standings[i].Rank = i + 1
+		}
+	}
+
+	return standings
+}
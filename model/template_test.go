@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+)
+
+func TestTemplateOf(t *testing.T) {
+	g := InitGame()
+	sender, other := UserId(uuid.Must(uuid.NewV4())), UserId(uuid.Must(uuid.NewV4()))
+	if g.HasTemplate() {
+		t.Fatal("a new game has a template")
+	}
+
+	g.SetTemplate(nil, "all")
+	g.SetTemplate(&sender, "sender")
+	if !g.HasTemplate() {
+		t.Fatal("HasTemplate() = false after SetTemplate()")
+	}
+
+	// お題ごとの下絵を全体の下絵より優先する
+	g.AddOdai(sender, "ねこ")
+	g.AddOdai(other, "いぬ")
+	if got := g.Odais[0].Template; got != "sender" {
+		t.Errorf("template of the odai of the sender = %q, want %q", got, "sender")
+	}
+	if got := g.Odais[1].Template; got != "all" {
+		t.Errorf("template of the other odai = %q, want %q", got, "all")
+	}
+
+	// 空の下絵で消す
+	g.SetTemplate(&sender, "")
+	if got := g.TemplateOf(sender); got != "all" {
+		t.Errorf("TemplateOf() = %q after clearing, want %q", got, "all")
+	}
+	g.SetTemplate(nil, "")
+	if g.HasTemplate() {
+		t.Error("HasTemplate() = true after clearing all templates")
+	}
+}
@@ -10,6 +10,7 @@ type User struct {
 	Id     UserId
 	Name   Username
 	Avatar Avatar
+	Bot    bool // サーバーが操作するボット
 }
 
 type UserId uuid.UUID
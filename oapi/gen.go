@@ -11,7 +11,7 @@ func (u UserIdInQuery) Refill() (model.UserId, error) {
 }
 
 func RefillUser(mu *model.User) User {
-	return User{
+	u := User{
 		Avatar: Avatar{
 			Color: mu.Avatar.Color.String(),
 			Type:  mu.Avatar.Type.Int(),
@@ -19,6 +19,12 @@ func RefillUser(mu *model.User) User {
 		Username: mu.Name.String(),
 		UserId:   mu.Id.UUID(),
 	}
+
+	if mu.Bot {
+		u.Bot = &mu.Bot
+	}
+
+	return u
 }
 
 func RefillUsers(mus []model.User) []User {
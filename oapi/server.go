@@ -13,6 +13,9 @@ import (
 
 // ServerInterface represents all server handlers.
 type ServerInterface interface {
+	// getImage
+	// (GET /images/{imageKey})
+	GetImage(ctx echo.Context, imageKey ImageKeyInPath, params GetImageParams) error
 	// ping
 	// (GET /ping)
 	Ping(ctx echo.Context) error
@@ -35,6 +38,38 @@ type ServerInterfaceWrapper struct {
 	Handler ServerInterface
 }
 
+// GetImage converts echo context to params.
+func (w *ServerInterfaceWrapper) GetImage(ctx echo.Context) error {
+	var err error
+	// ------------- Path parameter "imageKey" -------------
+	var imageKey ImageKeyInPath
+
+	err = runtime.BindStyledParameterWithLocation("simple", false, "imageKey", runtime.ParamLocationPath, ctx.Param("imageKey"), &imageKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter imageKey: %s", err))
+	}
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetImageParams
+	// ------------- Required query parameter "expires" -------------
+
+	err = runtime.BindQueryParameter("form", true, true, "expires", ctx.QueryParams(), &params.Expires)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter expires: %s", err))
+	}
+
+	// ------------- Required query parameter "signature" -------------
+
+	err = runtime.BindQueryParameter("form", true, true, "signature", ctx.QueryParams(), &params.Signature)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter signature: %s", err))
+	}
+
+	// Invoke the callback with all the unmarshalled arguments
+	err = w.Handler.GetImage(ctx, imageKey, params)
+	return err
+}
+
 // Ping converts echo context to params.
 func (w *ServerInterfaceWrapper) Ping(ctx echo.Context) error {
 	var err error
@@ -91,6 +126,20 @@ func (w *ServerInterfaceWrapper) Ws(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter user: %s", err))
 	}
 
+	// ------------- Optional query parameter "protocolVersion" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "protocolVersion", ctx.QueryParams(), &params.ProtocolVersion)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter protocolVersion: %s", err))
+	}
+
+	// ------------- Optional query parameter "features" -------------
+
+	err = runtime.BindQueryParameter("form", false, false, "features", ctx.QueryParams(), &params.Features)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Invalid format for parameter features: %s", err))
+	}
+
 	// Invoke the callback with all the unmarshalled arguments
 	err = w.Handler.Ws(ctx, params)
 	return err
@@ -124,6 +173,7 @@ func RegisterHandlersWithBaseURL(router EchoRouter, si ServerInterface, baseURL
 		Handler: si,
 	}
 
+	router.GET(baseURL+"/images/:imageKey", wrapper.GetImage)
 	router.GET(baseURL+"/ping", wrapper.Ping)
 	router.POST(baseURL+"/rooms/join", wrapper.JoinRoom)
 	router.POST(baseURL+"/rooms/new", wrapper.CreateRoom)
@@ -3,7 +3,88 @@
 // Code generated by github.com/deepmap/oapi-codegen version v1.9.0 DO NOT EDIT.
 package oapi
 
-import "github.com/gofrs/uuid"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// Defines values for AreaOrder.
+const (
+	AreaOrderGrow AreaOrder = "grow"
+
+	AreaOrderRandom AreaOrder = "random"
+
+	AreaOrderRaster AreaOrder = "raster"
+
+	AreaOrderRegion AreaOrder = "region"
+
+	AreaOrderSpiral AreaOrder = "spiral"
+)
+
+// Defines values for ErrorCode.
+const (
+	ErrorCodeALREADYEXISTS ErrorCode = "ALREADY_EXISTS"
+
+	ErrorCodeDUPLICATEODAI ErrorCode = "DUPLICATE_ODAI"
+
+	ErrorCodeGAMEPAUSED ErrorCode = "GAME_PAUSED"
+
+	ErrorCodeIMAGETOOLARGE ErrorCode = "IMAGE_TOO_LARGE"
+
+	ErrorCodeINTERNALERROR ErrorCode = "INTERNAL_ERROR"
+
+	ErrorCodeINVALIDBODY ErrorCode = "INVALID_BODY"
+
+	ErrorCodeINVALIDIMAGE ErrorCode = "INVALID_IMAGE"
+
+	ErrorCodeINVALIDIMAGEURL ErrorCode = "INVALID_IMAGE_URL"
+
+	ErrorCodeINVALIDOPTION ErrorCode = "INVALID_OPTION"
+
+	ErrorCodeNOTENOUGHMEMBERS ErrorCode = "NOT_ENOUGH_MEMBERS"
+
+	ErrorCodeNOTFOUND ErrorCode = "NOT_FOUND"
+
+	ErrorCodeROOMFULL ErrorCode = "ROOM_FULL"
+
+	ErrorCodeROUNDSREMAINING ErrorCode = "ROUNDS_REMAINING"
+
+	ErrorCodeSERVERCLOSING ErrorCode = "SERVER_CLOSING"
+
+	ErrorCodeTEAMSINRELAYMODE ErrorCode = "TEAMS_IN_RELAY_MODE"
+
+	ErrorCodeUNAUTHORIZED ErrorCode = "UNAUTHORIZED"
+
+	ErrorCodeUNBALANCEDTEAMS ErrorCode = "UNBALANCED_TEAMS"
+
+	ErrorCodeUNKNOWNEVENT ErrorCode = "UNKNOWN_EVENT"
+
+	ErrorCodeUNSUPPORTEDFEATURE ErrorCode = "UNSUPPORTED_FEATURE"
+
+	ErrorCodeUNSUPPORTEDIMAGEFORMAT ErrorCode = "UNSUPPORTED_IMAGE_FORMAT"
+
+	ErrorCodeWRONGPHASE ErrorCode = "WRONG_PHASE"
+)
+
+// Defines values for GameMode.
+const (
+	GameModeGrid GameMode = "grid"
+
+	GameModeRelay GameMode = "relay"
+)
+
+// Defines values for Palette.
+const (
+	PaletteFour Palette = "four"
+
+	PaletteFree Palette = "free"
+
+	PaletteMonochrome Palette = "monochrome"
+
+	PalettePlayer Palette = "player"
+)
 
 // Defines values for WsEvent.
 const (
@@ -23,6 +104,8 @@ const (
 
 	WsEventCHANGEHOST WsEvent = "CHANGE_HOST"
 
+	WsEventCLOCKSYNC WsEvent = "CLOCK_SYNC"
+
 	WsEventDRAWCANCEL WsEvent = "DRAW_CANCEL"
 
 	WsEventDRAWFINISH WsEvent = "DRAW_FINISH"
@@ -37,8 +120,16 @@ const (
 
 	WsEventERROR WsEvent = "ERROR"
 
+	WsEventGAMEPAUSE WsEvent = "GAME_PAUSE"
+
+	WsEventGAMERESUME WsEvent = "GAME_RESUME"
+
 	WsEventGAMESTART WsEvent = "GAME_START"
 
+	WsEventGAMEUPDATEPAUSE WsEvent = "GAME_UPDATE_PAUSE"
+
+	WsEventMAINTENANCE WsEvent = "MAINTENANCE"
+
 	WsEventNEXTROOM WsEvent = "NEXT_ROOM"
 
 	WsEventODAICANCEL WsEvent = "ODAI_CANCEL"
@@ -51,16 +142,30 @@ const (
 
 	WsEventODAISEND WsEvent = "ODAI_SEND"
 
+	WsEventREQUESTCLOCKSYNC WsEvent = "REQUEST_CLOCK_SYNC"
+
 	WsEventREQUESTGAMESTART WsEvent = "REQUEST_GAME_START"
 
 	WsEventRETURNROOM WsEvent = "RETURN_ROOM"
 
+	WsEventROOMADDBOT WsEvent = "ROOM_ADD_BOT"
+
 	WsEventROOMNEWMEMBER WsEvent = "ROOM_NEW_MEMBER"
 
 	WsEventROOMSETOPTION WsEvent = "ROOM_SET_OPTION"
 
+	WsEventROOMSETTEAM WsEvent = "ROOM_SET_TEAM"
+
+	WsEventROOMSETTEMPLATE WsEvent = "ROOM_SET_TEMPLATE"
+
 	WsEventROOMUPDATEOPTION WsEvent = "ROOM_UPDATE_OPTION"
 
+	WsEventROOMUPDATETEAMS WsEvent = "ROOM_UPDATE_TEAMS"
+
+	WsEventROOMUPDATETEMPLATE WsEvent = "ROOM_UPDATE_TEMPLATE"
+
+	WsEventROUNDFINISH WsEvent = "ROUND_FINISH"
+
 	WsEventSHOWANSWER WsEvent = "SHOW_ANSWER"
 
 	WsEventSHOWCANVAS WsEvent = "SHOW_CANVAS"
@@ -71,9 +176,38 @@ const (
 
 	WsEventSHOWSTART WsEvent = "SHOW_START"
 
+	WsEventTEAMSTANDINGS WsEvent = "TEAM_STANDINGS"
+
 	WsEventWELCOMENEWCLIENT WsEvent = "WELCOME_NEW_CLIENT"
 )
 
+// Defines values for WsFeature.
+const (
+	WsFeatureBatch WsFeature = "batch"
+
+	WsFeatureBoards WsFeature = "boards"
+
+	WsFeatureBots WsFeature = "bots"
+
+	WsFeatureCompression WsFeature = "compression"
+
+	WsFeatureImageUrls WsFeature = "imageUrls"
+
+	WsFeatureMsgpack WsFeature = "msgpack"
+
+	WsFeaturePalette WsFeature = "palette"
+
+	WsFeaturePause WsFeature = "pause"
+
+	WsFeatureRelayMode WsFeature = "relayMode"
+
+	WsFeatureRounds WsFeature = "rounds"
+
+	WsFeatureTeamMode WsFeature = "teamMode"
+
+	WsFeatureTemplate WsFeature = "template"
+)
+
 // Defines values for WsNextShowStatus.
 const (
 	WsNextShowStatusAnswer WsNextShowStatus = "answer"
@@ -85,6 +219,30 @@ const (
 	WsNextShowStatusOdai WsNextShowStatus = "odai"
 )
 
+// DRAWフェーズで各ターンに描くエリアの決め方 (gridモードのみ)
+// マスクで定義されたボードでは random のみ選べる
+//
+// random: ランダムな順番
+// raster: 左上から1行ずつ
+// spiral: 左上から時計回りに渦巻き状に
+// grow: 中央から始めて，描いたエリアに隣り合うエリアを選ぶ
+// region: 描く人ごとにひとつながりの領域を割り当てる
+type AreaOrder string
+
+// マスクで定義されたボード (boardNameが "4x4" のような列x行でないもの) のエリアの形
+//
+// 位置と大きさはキャンバスに対する割合で，maskを引き伸ばして重ねると不透明な部分がエリアになる．
+// エリアの外に描いた部分はサーバーで切り抜かれる
+type AreaRegion struct {
+	Height float32 `json:"height"`
+
+	// エリアを囲む長方形の PNG のデータURL
+	Mask  string  `json:"mask"`
+	Width float32 `json:"width"`
+	X     float32 `json:"x"`
+	Y     float32 `json:"y"`
+}
+
 // アバター情報
 type Avatar struct {
 	// アバターの背景色
@@ -101,6 +259,18 @@ type Canvas struct {
 
 	// ボード名
 	BoardName string `json:"boardName"`
+
+	// キャンバスの高さ (px)
+	Height int `json:"height"`
+
+	// マスクで定義されたボード (boardNameが "4x4" のような列x行でないもの) のエリアの形
+	//
+	// 位置と大きさはキャンバスに対する割合で，maskを引き伸ばして重ねると不透明な部分がエリアになる．
+	// エリアの外に描いた部分はサーバーで切り抜かれる
+	Region *AreaRegion `json:"region,omitempty"`
+
+	// キャンバスの幅 (px)
+	Width int `json:"width"`
 }
 
 // 新規ルーム作成リクエスト
@@ -115,6 +285,34 @@ type CreateRoomRequest struct {
 	Username string `json:"username"`
 }
 
+// REST APIのエラー
+type Error struct {
+	// クライアントが処理を分けられるエラーの種類
+	//
+	// INTERNAL_ERROR はサーバーの不具合なので，クライアントからは何もできない
+	// INVALID_IMAGE, UNSUPPORTED_IMAGE_FORMAT, IMAGE_TOO_LARGE は送った画像を読めなかったときで，content に詳細が入る
+	Code ErrorCode `json:"code"`
+
+	// デバッグ用のエラーの内容
+	Content string `json:"content"`
+
+	// ユーザーに表示するメッセージ (Accept-Language で言語を選ぶ)
+	Message string `json:"message"`
+}
+
+// クライアントが処理を分けられるエラーの種類
+//
+// INTERNAL_ERROR はサーバーの不具合なので，クライアントからは何もできない
+// INVALID_IMAGE, UNSUPPORTED_IMAGE_FORMAT, IMAGE_TOO_LARGE は送った画像を読めなかったときで，content に詳細が入る
+type ErrorCode string
+
+// ゲームモード
+//
+// grid: 1つのお題をみんなでマスごとに描いて，最後に1人が回答する
+// relay: 1人が描いた絵を次の人が回答し，その回答を次の人が描くのを繰り返す
+// (relay は3人以上で遊べる．チェーンは必ず回答で終わるので，人数が偶数のときは各チェーンに1人ずつ参加しない人がいる)
+type GameMode string
+
 // ルーム参加リクエスト
 type JoinRoomRequest struct {
 	// アバター情報
@@ -127,6 +325,23 @@ type JoinRoomRequest struct {
 	Username string `json:"username"`
 }
 
+// メンバーの累計スコア
+type MemberScore struct {
+	// 正解したお題に描いた・回答した数
+	Score int `json:"score"`
+
+	// ユーザーUUID
+	UserId uuid.UUID `json:"userId"`
+}
+
+// DRAWフェーズで使える色 (free以外は DRAW_SEND の画像をサーバーがパレットの色に置き換える)
+//
+// free: 色を制限しない
+// monochrome: 白と黒
+// four: 黒・赤・青・黄の4色と背景の白
+// player: 描く人ごとに割り当てた1色
+type Palette string
+
 // ルーム情報
 type Room struct {
 	// ルームの最大収容人数
@@ -145,11 +360,35 @@ type Room struct {
 	UserId uuid.UUID `json:"userId"`
 }
 
+// チーム情報
+type Team struct {
+	// チームに所属するメンバーのユーザーUUID
+	Members []uuid.UUID `json:"members"`
+
+	// チームID
+	TeamId int `json:"teamId"`
+}
+
+// チームの順位
+type TeamStanding struct {
+	// 順位 (同点は同じ順位)
+	Rank int `json:"rank"`
+
+	// 正解した回答の数
+	Score int `json:"score"`
+
+	// チームID
+	TeamId int `json:"teamId"`
+}
+
 // ユーザー情報
 type User struct {
 	// アバター情報
 	Avatar Avatar `json:"avatar"`
 
+	// サーバーが操作するボットかどうか
+	Bot *bool `json:"bot,omitempty"`
+
 	// ユーザーUUID
 	UserId uuid.UUID `json:"userId"`
 
@@ -171,9 +410,15 @@ type WsAnswerSendEventBody struct {
 
 // 絵が飛んできて，回答する (サーバー -> ルーム各員)
 type WsAnswerStartEventBody struct {
+	// フェーズが終わるサーバーの時刻 (CLOCK_SYNC で求めた時計のずれを足してカウントダウンする)
+	Deadline time.Time `json:"deadline"`
+
 	// 画像ID
 	Img string `json:"img"`
 
+	// 下絵の PNG のデータURL (下絵がないときは省略．imgには含まれないので下に重ねて表示する)
+	Template *string `json:"template,omitempty"`
+
 	// 制限時間
 	TimeLimit int `json:"timeLimit"`
 }
@@ -184,6 +429,20 @@ type WsChangeHostEventBody struct {
 	HostId string `json:"hostId"`
 }
 
+// サーバーの時刻を返す (サーバー -> リクエストしたクライアント)
+//
+// 受信した時刻を t とすると，往復時間は t - clientTime，時計のずれは serverTime - (clientTime + t) / 2 と見積もれる
+type WsClockSyncEventBody struct {
+	// REQUEST_CLOCK_SYNC の clientTime
+	ClientTime int64 `json:"clientTime"`
+
+	// サーバーが ping で測った往復時間 (ミリ秒，まだ測っていないときは省略)
+	Rtt *int `json:"rtt,omitempty"`
+
+	// 返信したときのサーバーの時刻 (UNIXミリ秒)
+	ServerTime int64 `json:"serverTime"`
+}
+
 // 絵を描き終えた人数を送信する (サーバー -> ルームの各員)
 type WsDrawInputEventBody struct {
 	// 絵を描き終えた人数
@@ -193,8 +452,15 @@ type WsDrawInputEventBody struct {
 // 絵を送信する (ルームの各員 -> サーバー)
 //
 // -> (DRAWフェーズが終わってなかったら) また，DRAW_START が飛んでくる
+// 色が制限されているときは，各画素をパレットの最も近い色 (アルファが半分未満なら透明) に置き換えて保存する
+// drawPhaseNum が今のターンと違うときは，前のターンの絵が遅れて届いたものとして捨てる (WRONG_PHASE)
 type WsDrawSendEventBody struct {
-	// 画像ID
+	// 描いた絵の DRAW_START の drawPhaseNum
+	DrawPhaseNum *int `json:"drawPhaseNum,omitempty"`
+
+	// PNG画像のデータURL
+	//
+	// DRAW_START の canvas の width x height で描く．縦横それぞれ2倍までの大きさなら受け付けて，キャンバスの大きさに伸縮する (それより大きいと IMAGE_TOO_LARGE)
 	Img string `json:"img"`
 }
 
@@ -206,6 +472,9 @@ type WsDrawStartEventBody struct {
 	// ユーザーが描画するキャンバスの分割情報・描画位置
 	Canvas Canvas `json:"canvas"`
 
+	// フェーズが終わるサーバーの時刻 (CLOCK_SYNC で求めた時計のずれを足してカウントダウンする)
+	Deadline time.Time `json:"deadline"`
+
 	// 現在のDRAWフェーズの番号
 	DrawPhaseNum int `json:"drawPhaseNum"`
 
@@ -218,28 +487,98 @@ type WsDrawStartEventBody struct {
 	// お題
 	Odai string `json:"odai"`
 
+	// 使える色の一覧 (#rrggbb．色が制限されていないときは省略)
+	Palette *[]string `json:"palette,omitempty"`
+
+	// 下絵の PNG のデータURL (下絵がないときは省略．imgには含まれないので下に重ねて表示する)
+	Template *string `json:"template,omitempty"`
+
 	// 制限時間
 	TimeLimit int `json:"timeLimit"`
+
+	// 見えるエリアの一覧 (fogRadiusが0のときは省略され，imgのそれ以外のエリアは透明になる)
+	VisibleArea *[]int `json:"visibleArea,omitempty"`
 }
 
 // エラー用ボディ
 type WsErrorBody struct {
-	// エラーの内容
+	// クライアントが処理を分けられるエラーの種類
+	//
+	// INTERNAL_ERROR はサーバーの不具合なので，クライアントからは何もできない
+	// INVALID_IMAGE, UNSUPPORTED_IMAGE_FORMAT, IMAGE_TOO_LARGE は送った画像を読めなかったときで，content に詳細が入る
+	Code ErrorCode `json:"code"`
+
+	// デバッグ用のエラーの内容
 	Content string `json:"content"`
+
+	// Websocketイベントのリスト
+	Event *WsEvent `json:"event,omitempty"`
+
+	// リクエストのボディで不正だったフィールド
+	Field *string `json:"field,omitempty"`
+
+	// ユーザーに表示するメッセージ (WebSocket接続時の Accept-Language で言語を選ぶ)
+	Message string `json:"message"`
 }
 
 // Websocketイベントのリスト
 type WsEvent string
 
+// 接続時にネゴシエーションする機能
+//
+// - compression: permessage-deflate でメッセージを圧縮する
+// - relayMode: リレーモード (全員が対応しているときだけ開始できる)
+// - teamMode: チーム戦 (ROOM_SET_TEAM, ROOM_UPDATE_TEAMS, TEAM_STANDINGS)
+// - rounds: 複数ラウンド (ROUND_FINISH)
+// - bots: ボット (ROOM_ADD_BOT)
+// - msgpack: MessagePack のバイナリフレーム
+// - batch: サーバーからのフレームをメッセージの配列にして，複数のメッセージをまとめて送る
+// - pause: ゲームの一時停止 (GAME_PAUSE, GAME_RESUME, GAME_UPDATE_PAUSE)
+// - boards: マスクで定義されたボード (Canvasのregion，全員が対応しているときだけ開始できる)
+// - template: ホストが設定する下絵 (ROOM_SET_TEMPLATE, ROOM_UPDATE_TEMPLATE，全員が対応しているときだけ開始できる)
+// - palette: 使える色の制限 (DRAW_STARTのpalette，全員が対応しているときだけ開始できる)
+// - imageUrls: サーバーから送る画像をデータURLの代わりに署名付きURLにする (GET /images/{imageKey})
+type WsFeature string
+
 // ゲームの開始を通知する (サーバー -> ルーム全員)
 type WsGameStartEventBody struct {
+	// フェーズが終わるサーバーの時刻 (CLOCK_SYNC で求めた時計のずれを足してカウントダウンする)
+	Deadline time.Time `json:"deadline"`
+
 	// お題のサジェスト
 	OdaiExample string `json:"odaiExample"`
 
+	// 現在のラウンドの番号
+	Round int `json:"round"`
+
+	// ラウンド数
+	RoundNum int `json:"roundNum"`
+
 	// 制限時間
 	TimeLimit int `json:"timeLimit"`
 }
 
+// ゲームの一時停止と再開を通知する (サーバー -> ルーム全員)
+//
+// ホストが GAME_PAUSE, GAME_RESUME を送ったときに送信する．
+// 一時停止中は ODAI, DRAW, ANSWER フェーズの入力 (READY, CANCEL, SEND) を受け付けない
+type WsGameUpdatePauseEventBody struct {
+	// 再開したフェーズが終わるサーバーの時刻 (再開したときのみ)
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// 一時停止中か
+	Paused bool `json:"paused"`
+
+	// フェーズの残り時間 (ミリ秒)
+	Remaining int `json:"remaining"`
+}
+
+// サーバーが停止することを通知する (サーバー -> ルーム全員)
+type WsMaintenanceEventBody struct {
+	// 停止理由のメッセージ
+	Content string `json:"content"`
+}
+
 // 次のWebsocketイベントのリスト
 type WsNextShowStatus string
 
@@ -255,15 +594,35 @@ type WsOdaiSendEventBody struct {
 	Odai string `json:"odai"`
 }
 
-// WsReceiveMessage defines model for WsReceiveMessage.
+// WebSocketで クライアントからサーバーへ送信する情報
+//
+// body はイベントの種類ごとの型にデコードして検証する
 type WsReceiveMessage struct {
-	// Embedded fields due to inline allOf schema
-	Body interface{} `json:"body"`
+	// イベントごとのボディ
+	//
+	// WsRoomSetOptionEventBody, WsRoomSetTeamEventBody, WsRoomAddBotEventBody, WsRoomSetTemplateEventBody,
+	// WsOdaiSendEventBody, WsDrawSendEventBody, WsAnswerSendEventBody, WsRequestClockSyncEventBody,
+	// またはボディのないイベントは空のオブジェクト
+	Body json.RawMessage `json:"body"`
 
 	// Websocketイベントのリスト
 	Type WsEvent `json:"type"`
 }
 
+// サーバーとの時計のずれを測る (ルームの各員 -> サーバー)
+type WsRequestClockSyncEventBody struct {
+	// 送信したときのクライアントの時刻 (UNIXミリ秒)
+	ClientTime int64 `json:"clientTime"`
+}
+
+// ボットを追加する (ホスト -> サーバー)
+//
+// userId を指定したときは，接続が切れたメンバーの代わりにボットが遊ぶ
+type WsRoomAddBotEventBody struct {
+	// 代わりに遊ぶメンバーのユーザーUUID
+	UserId *uuid.UUID `json:"userId,omitempty"`
+}
+
 // 部屋に追加のメンバーが来たことを通知する (サーバー -> ルーム全員)
 type WsRoomNewMemberEventBody struct {
 	// ルームの最大収容人数
@@ -278,16 +637,147 @@ type WsRoomNewMemberEventBody struct {
 
 // ゲームのオプションを設定する (ホスト -> サーバー)
 type WsRoomSetOptionEventBody struct {
+	// DRAWフェーズで各ターンに描くエリアの決め方 (gridモードのみ)
+	// マスクで定義されたボードでは random のみ選べる
+	//
+	// random: ランダムな順番
+	// raster: 左上から1行ずつ
+	// spiral: 左上から時計回りに渦巻き状に
+	// grow: 中央から始めて，描いたエリアに隣り合うエリアを選ぶ
+	// region: 描く人ごとにひとつながりの領域を割り当てる
+	AreaOrder *AreaOrder `json:"areaOrder,omitempty"`
+
+	// ボード名 (gridモードのみ．4x4, 5x5, 4x3 とマスクで定義されたボード hex19, rings13, puzzle9 など)
+	BoardName *string `json:"boardName,omitempty"`
+
+	// DRAWフェーズで見えるエリアの範囲 (自分のエリアから何マスまでか，0のときは全体が見える)
+	FogRadius *int `json:"fogRadius,omitempty"`
+
+	// ゲームモード
+	//
+	// grid: 1つのお題をみんなでマスごとに描いて，最後に1人が回答する
+	// relay: 1人が描いた絵を次の人が回答し，その回答を次の人が描くのを繰り返す
+	// (relay は3人以上で遊べる．チェーンは必ず回答で終わるので，人数が偶数のときは各チェーンに1人ずつ参加しない人がいる)
+	GameMode *GameMode `json:"gameMode,omitempty"`
+
+	// DRAWフェーズで使える色 (free以外は DRAW_SEND の画像をサーバーがパレットの色に置き換える)
+	//
+	// free: 色を制限しない
+	// monochrome: 白と黒
+	// four: 黒・赤・青・黄の4色と背景の白
+	// player: 描く人ごとに割り当てた1色
+	Palette *Palette `json:"palette,omitempty"`
+
+	// ラウンド数
+	RoundNum *int `json:"roundNum,omitempty"`
+
+	// チーム分けと役割決めに使う乱数のシード (不具合の再現用．指定しなければランダムに決まり，ゲーム開始時にサーバーのログに残る)
+	Seed *int64 `json:"seed,omitempty"`
+
+	// チーム数 (0のときはチームに分けない)
+	TeamNum *int `json:"teamNum,omitempty"`
+
 	// 制限時間
 	TimeLimit *int `json:"timeLimit,omitempty"`
 }
 
+// メンバーのチームを変更する (ホスト -> サーバー)
+type WsRoomSetTeamEventBody struct {
+	// チームID
+	TeamId int `json:"teamId"`
+
+	// ユーザーUUID
+	UserId uuid.UUID `json:"userId"`
+}
+
+// 下絵を設定する (ホスト -> サーバー)
+//
+// 下絵はボードのキャンバスの大きさに合わせて縦横比を保ったまま中央に置かれる．
+// userId を指定したときはそのメンバーが書いたお題だけの下絵になり，すべてのお題の下絵より優先する (gridモードのみ)
+type WsRoomSetTemplateEventBody struct {
+	// PNG か JPEG のデータURL (空文字列のときは下絵を消す)
+	Img string `json:"img"`
+
+	// お題を書くメンバーのユーザーUUID
+	UserId *uuid.UUID `json:"userId,omitempty"`
+}
+
 // ゲームの設定を更新する (サーバー -> ルーム全員)
 type WsRoomUpdateOptionEventBody struct {
+	// DRAWフェーズで各ターンに描くエリアの決め方 (gridモードのみ)
+	// マスクで定義されたボードでは random のみ選べる
+	//
+	// random: ランダムな順番
+	// raster: 左上から1行ずつ
+	// spiral: 左上から時計回りに渦巻き状に
+	// grow: 中央から始めて，描いたエリアに隣り合うエリアを選ぶ
+	// region: 描く人ごとにひとつながりの領域を割り当てる
+	AreaOrder *AreaOrder `json:"areaOrder,omitempty"`
+
+	// ボード名 (gridモードのみ．4x4, 5x5, 4x3 とマスクで定義されたボード hex19, rings13, puzzle9 など)
+	BoardName *string `json:"boardName,omitempty"`
+
+	// DRAWフェーズで見えるエリアの範囲 (自分のエリアから何マスまでか，0のときは全体が見える)
+	FogRadius *int `json:"fogRadius,omitempty"`
+
+	// ゲームモード
+	//
+	// grid: 1つのお題をみんなでマスごとに描いて，最後に1人が回答する
+	// relay: 1人が描いた絵を次の人が回答し，その回答を次の人が描くのを繰り返す
+	// (relay は3人以上で遊べる．チェーンは必ず回答で終わるので，人数が偶数のときは各チェーンに1人ずつ参加しない人がいる)
+	GameMode *GameMode `json:"gameMode,omitempty"`
+
+	// DRAWフェーズで使える色 (free以外は DRAW_SEND の画像をサーバーがパレットの色に置き換える)
+	//
+	// free: 色を制限しない
+	// monochrome: 白と黒
+	// four: 黒・赤・青・黄の4色と背景の白
+	// player: 描く人ごとに割り当てた1色
+	Palette *Palette `json:"palette,omitempty"`
+
+	// ラウンド数
+	RoundNum *int `json:"roundNum,omitempty"`
+
+	// チーム数 (0のときはチームに分けない)
+	TeamNum *int `json:"teamNum,omitempty"`
+
 	// 制限時間
 	TimeLimit *int `json:"timeLimit,omitempty"`
 }
 
+// チーム分けを更新する (サーバー -> ルーム全員)
+type WsRoomUpdateTeamsEventBody struct {
+	// チームの一覧 (空のときはチームに分けない)
+	Teams []Team `json:"teams"`
+}
+
+// 下絵を更新する (サーバー -> ルーム全員)
+type WsRoomUpdateTemplateEventBody struct {
+	// キャンバスの大きさにした PNG のデータURL (空文字列のときは下絵が消された)
+	Img string `json:"img"`
+
+	// お題を書くメンバーのユーザーUUID (すべてのお題の下絵のときは省略)
+	UserId *uuid.UUID `json:"userId,omitempty"`
+}
+
+// ラウンドの終了と累計結果を送信する (サーバー -> ルーム全員)
+type WsRoundFinishEventBody struct {
+	// 次のラウンドが始まるまでの秒数 (最後のラウンドのときは0)
+	NextRoundIn int `json:"nextRoundIn"`
+
+	// 終了したラウンドの番号
+	Round int `json:"round"`
+
+	// ラウンド数
+	RoundNum int `json:"roundNum"`
+
+	// スコアの高い順に並んだメンバーの累計スコア
+	Scores []MemberScore `json:"scores"`
+
+	// 累計のチームの順位 (チーム戦のときのみ)
+	TeamStandings *[]TeamStanding `json:"teamStandings,omitempty"`
+}
+
 // WsSendMessage defines model for WsSendMessage.
 type WsSendMessage struct {
 	// Embedded fields due to inline allOf schema
@@ -311,11 +801,17 @@ type WsShowAnswerEventBody struct {
 
 // 次のキャンバスを受信する (サーバー -> ルーム全員)
 type WsShowCanvasEventBody struct {
+	// ユーザー情報
+	Drawer *User `json:"drawer,omitempty"`
+
 	// 画像ID
 	Img string `json:"img"`
 
 	// 次のWebsocketイベントのリスト
 	Next WsNextShowStatus `json:"next"`
+
+	// 下絵の PNG のデータURL (下絵がないときは省略．表示するかはクライアントで切り替えられる)
+	Template *string `json:"template,omitempty"`
 }
 
 // 最初のお題を受信する (サーバー -> ルーム全員)
@@ -328,20 +824,65 @@ type WsShowOdaiEventBody struct {
 
 	// ユーザー情報
 	Sender User `json:"sender"`
+
+	// このお題を描いたチームのID (チーム戦のときのみ)
+	TeamId *int `json:"teamId,omitempty"`
+}
+
+// チームの順位を送信する (サーバー -> ルーム全員)
+type WsTeamStandingsEventBody struct {
+	// ゲーム終了時の最終結果かどうか
+	Final bool `json:"final"`
+
+	// 順位の高い順に並んだチームの一覧
+	Standings []TeamStanding `json:"standings"`
 }
 
 // 接続時に送信する (サーバー -> 新規クライアント)
 type WsWelcomeNewClientBody struct {
 	// 接続確認メッセージ
 	Content string `json:"content"`
+
+	// このコネクションで有効になった機能
+	Features []WsFeature `json:"features"`
+
+	// このコネクションで使うプロトコルのバージョン
+	ProtocolVersion int `json:"protocolVersion"`
+
+	// サーバーのバージョン
+	ServerVersion string `json:"serverVersion"`
 }
 
+// ExpiresInQuery defines model for expiresInQuery.
+type ExpiresInQuery int64
+
+// FeaturesInQuery defines model for featuresInQuery.
+type FeaturesInQuery []WsFeature
+
+// ImageKeyInPath defines model for imageKeyInPath.
+type ImageKeyInPath string
+
+// ProtocolVersionInQuery defines model for protocolVersionInQuery.
+type ProtocolVersionInQuery int
+
 // ルームID
 type RoomIdInPath string
 
+// SignatureInQuery defines model for signatureInQuery.
+type SignatureInQuery string
+
 // UserIdInQuery defines model for userIdInQuery.
 type UserIdInQuery string
 
+// GetImageParams defines parameters for GetImage.
+type GetImageParams struct {
+	// URLの有効期限 (UNIX時間の秒)
+	Expires ExpiresInQuery `json:"expires"`
+
+	// URLの署名
+	Signature SignatureInQuery `json:"signature"`
+}
+
 // JoinRoomJSONBody defines parameters for JoinRoom.
 type JoinRoomJSONBody JoinRoomRequest
 
@@ -355,6 +896,12 @@ type WsJSONBody WsReceiveMessage
 type WsParams struct {
 	// ユーザーUUID
 	User UserIdInQuery `json:"user"`
+
+	// クライアントが対応しているプロトコルのバージョン (省略したときは 1)
+	ProtocolVersion *ProtocolVersionInQuery `json:"protocolVersion,omitempty"`
+
+	// クライアントが使いたい機能 (カンマ区切り，プロトコルのバージョン 2 以上)
+	Features *FeaturesInQuery `json:"features,omitempty"`
 }
 
 // JoinRoomJSONRequestBody defines body for JoinRoom for application/json ContentType.
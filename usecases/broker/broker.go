@@ -0,0 +1,10 @@
+package broker
+
+// Broker delivers messages between backend instances.
+// Messages published to a topic are delivered in order to every subscriber
+// of the topic, including the subscribers of the publishing instance.
+type Broker interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, handler func(payload []byte)) (unsubscribe func(), err error)
+	Close() error
+}
@@ -2,4 +2,5 @@ package repository
 
 type Repository interface {
 	RoomRepository
+	SnapshotRepository
 }
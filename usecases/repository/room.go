@@ -10,6 +10,9 @@ type RoomRepository interface {
 	GetRoom(rid model.RoomId) (*model.Room, error)
 	GetRoomFromUserId(uid model.UserId) (*model.Room, error)
 	DeleteRoom(rid model.RoomId) error
+	RestoreRoom(room *model.Room) error
+	AddRoomMember(rid model.RoomId, user model.User) (*model.Room, error)
+	SetRoomHost(rid model.RoomId, uid model.UserId) error
 }
 
 type CreateRoomArgs struct {
@@ -22,4 +25,5 @@ type JoinRoomArgs struct {
 	Avatar   model.Avatar
 	RoomId   model.RoomId
 	Username model.Username
+	Bot      bool
 }
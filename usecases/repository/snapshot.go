@@ -0,0 +1,8 @@
+package repository
+
+import "io"
+
+type SnapshotRepository interface {
+	SaveSnapshot(w io.Writer) error
+	LoadSnapshot(r io.Reader) error
+}
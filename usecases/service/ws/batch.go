@@ -0,0 +1,96 @@
+//nolint:errcheck
+package ws
+
+import (
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/gorilla/websocket"
+)
+
+// maxBatchSize is the maximum number of messages sent in a frame.
+const maxBatchSize = 64
+
+// collectBatch collects the messages sent in the next frame, starting with first.
+// batch が無効なクライアントには 1 フレームに 1 メッセージだけ送る．
+// 途中で send が閉じられたときは，集めたメッセージと true を返す
+func (c *Client) collectBatch(first *oapi.WsSendMessage) ([]*oapi.WsSendMessage, bool) {
+	batch := make([]*oapi.WsSendMessage, 0, 1)
+	// 古いクライアントには知らないイベントを送らない
+	if c.accepts(first.Type) {
+		batch = append(batch, first)
+	}
+
+	if !c.supports(oapi.WsFeatureBatch) {
+		return batch, false
+	}
+
+	// 待ち時間がないときは，すでに溜まっているメッセージだけをまとめる
+	var window <-chan time.Time
+	if c.batchWindow > 0 {
+		timer := time.NewTimer(c.batchWindow)
+		defer timer.Stop()
+		window = timer.C
+	}
+
+	for len(batch) < maxBatchSize {
+		var (
+			message *oapi.WsSendMessage
+			ok      bool
+		)
+
+		if window == nil {
+			select {
+			case message, ok = <-c.send:
+			default:
+				return batch, false
+			}
+		} else {
+			select {
+			case message, ok = <-c.send:
+			case <-window:
+				return batch, false
+			}
+		}
+
+		if !ok {
+			return batch, true
+		}
+
+		if c.accepts(message.Type) {
+			batch = append(batch, message)
+		}
+	}
+
+	return batch, false
+}
+
+// writeFrame writes the messages collected by collectBatch in a frame.
+func (c *Client) writeFrame(batch []*oapi.WsSendMessage) error {
+	var (
+		buf []byte
+		err error
+	)
+
+	if c.supports(oapi.WsFeatureBatch) {
+		buf, err = c.codec.encodeBatch(batch)
+	} else {
+		buf, err = c.codec.encode(batch[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	return c.conn.WriteMessage(c.codec.frameType(), buf)
+}
+
+// writeClose writes the close frame after the send channel is closed.
+func (c *Client) writeClose() {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+	closeMsg := c.closeMsg
+	if closeMsg == nil {
+		closeMsg = []byte{}
+	}
+	c.conn.WriteMessage(websocket.CloseMessage, closeMsg)
+}
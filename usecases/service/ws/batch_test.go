@@ -0,0 +1,187 @@
+package ws
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/msgpack"
+	"github.com/gorilla/websocket"
+)
+
+type testMessage struct {
+	Type oapi.WsEvent `json:"type"`
+	Body struct {
+		Seq int `json:"seq"`
+	} `json:"body"`
+}
+
+// runWritePump sends n messages to a client as fast as possible and returns the frames it received.
+// 10 件に 1 件はクライアントが対応していないイベントにする
+func runWritePump(t *testing.T, features featureSet, window time.Duration, n int) [][]byte {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+
+		c := &Client{
+			conn:        conn,
+			send:        make(chan *oapi.WsSendMessage, 256),
+			features:    features,
+			codec:       codecOf(features),
+			batchWindow: window,
+		}
+		// 最初の ping への pong を受け取ってから送り始める
+		// (閉じた後に pong が届くと，クライアントが最後のフレームを読む前に接続がリセットされる)
+		ponged := make(chan struct{})
+		conn.SetPongHandler(func(string) error {
+			close(ponged)
+			conn.SetPongHandler(nil)
+			return nil
+		})
+
+		go c.writePump()
+
+		// readPump の代わりに pong を読む
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		<-ponged
+
+		for i := 0; i < n; i++ {
+			event := oapi.WsEventROOMUPDATEOPTION
+			if i%10 == 9 {
+				event = oapi.WsEventROUNDFINISH
+			}
+			c.send <- &oapi.WsSendMessage{Type: event, Body: map[string]int{"seq": i}}
+		}
+		close(c.send)
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	frames := make([][]byte, 0)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure) {
+				t.Fatalf("failed to read frame: %v", err)
+			}
+
+			return frames
+		}
+
+		frames = append(frames, data)
+	}
+}
+
+// decodeMsgpackFrame converts a MessagePack frame to JSON to decode it in the same way.
+func decodeMsgpackFrame(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	v, err := msgpack.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("failed to decode MessagePack frame: %v", err)
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to encode as JSON: %v", err)
+	}
+
+	return buf
+}
+
+func TestWritePumpFrames(t *testing.T) {
+	const n = 5000
+
+	tests := []struct {
+		name     string
+		features []oapi.WsFeature
+		window   time.Duration
+	}{
+		{name: "one message per frame", features: nil},
+		{name: "batch", features: []oapi.WsFeature{oapi.WsFeatureBatch}},
+		{name: "batch with window", features: []oapi.WsFeature{oapi.WsFeatureBatch}, window: time.Millisecond},
+		{name: "msgpack", features: []oapi.WsFeature{oapi.WsFeatureMsgpack}},
+		{name: "msgpack batch", features: []oapi.WsFeature{oapi.WsFeatureMsgpack, oapi.WsFeatureBatch}, window: time.Millisecond},
+		{name: "batch with rounds", features: []oapi.WsFeature{oapi.WsFeatureBatch, oapi.WsFeatureRounds}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			features := newFeatureSet(tt.features)
+			frames := runWritePump(t, features, tt.window, n)
+
+			var batched int
+			received := make([]testMessage, 0, n)
+			for _, data := range frames {
+				if features.has(oapi.WsFeatureMsgpack) {
+					data = decodeMsgpackFrame(t, data)
+				}
+
+				// 1 つのフレームは 1 つの JSON の値として読めなければならない
+				if features.has(oapi.WsFeatureBatch) {
+					var msgs []testMessage
+					if err := json.Unmarshal(data, &msgs); err != nil {
+						t.Fatalf("failed to decode frame %q: %v", data, err)
+					}
+					if len(msgs) == 0 || maxBatchSize < len(msgs) {
+						t.Fatalf("frame has %d messages", len(msgs))
+					}
+					if len(msgs) > 1 {
+						batched++
+					}
+					received = append(received, msgs...)
+				} else {
+					var msg testMessage
+					if err := json.Unmarshal(data, &msg); err != nil {
+						t.Fatalf("failed to decode frame %q: %v", data, err)
+					}
+					received = append(received, msg)
+				}
+			}
+
+			want := make([]int, 0, n)
+			for i := 0; i < n; i++ {
+				if i%10 != 9 || features.has(oapi.WsFeatureRounds) {
+					want = append(want, i)
+				}
+			}
+
+			if len(received) != len(want) {
+				t.Fatalf("received %d messages, want %d", len(received), len(want))
+			}
+			for i, msg := range received {
+				if msg.Body.Seq != want[i] {
+					t.Fatalf("message %d has seq %d, want %d", i, msg.Body.Seq, want[i])
+				}
+				if !features.has(oapi.WsFeatureRounds) && msg.Type == oapi.WsEventROUNDFINISH {
+					t.Fatalf("message %d is %s, which the client does not support", i, msg.Type)
+				}
+			}
+
+			if features.has(oapi.WsFeatureBatch) && tt.window > 0 && batched == 0 {
+				t.Error("no frame has more than one message")
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math/rand"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+	"github.com/21hack02win/nascalay-backend/util/logger"
+	"github.com/21hack02win/nascalay-backend/util/random"
+)
+
+const (
+	// Range of the time a bot takes before it tells the server that it is ready.
+	botMinThinkTime = 500 * time.Millisecond
+	botMaxThinkTime = 3 * time.Second
+)
+
+// ROOM_ADD_BOT
+// ボットを追加する (ホスト -> サーバー)
+// userId を指定したときは，接続が切れたメンバーの代わりにボットが遊ぶ
+func (c *Client) sendRoomAddBotEvent(body json.RawMessage) error {
+	room := c.server.room
+	if c.userId != room.HostId {
+		return errUnAuthorized
+	}
+
+	e := new(oapi.WsRoomAddBotEventBody)
+	if !isEmptyBody(body) {
+		if err := decodeBody(body, e); err != nil {
+			return fmt.Errorf("failed to decode body: %w", err)
+		}
+	}
+
+	if e.UserId != nil {
+		uid := model.UserId(*e.UserId)
+		if !isMemberOf(room, uid) {
+			return errNotFound
+		}
+
+		if _, ok := c.hub.userIdToClient.Load(uid); ok {
+			return errAlreadyExists
+		}
+
+		return c.hub.startBot(uid)
+	}
+
+	if !room.GameStatusIs(model.GameStatusRoom) {
+		return errWrongPhase
+	}
+
+	botNum := 1
+	for _, m := range room.Members {
+		if m.Bot {
+			botNum++
+		}
+	}
+
+	room, uid, err := c.hub.repo.JoinRoom(&repository.JoinRoomArgs{
+		RoomId:   room.Id,
+		Username: model.Username(fmt.Sprintf("ボット%d", botNum)),
+		Avatar: model.Avatar{
+			Type:  model.Avatar0,
+			Color: model.AvatarColor(fmt.Sprintf("#%06x", rand.Intn(0x1000000))),
+		},
+		Bot: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add bot: %w", err)
+	}
+
+	if err := c.hub.startBot(uid); err != nil {
+		return err
+	}
+
+	return c.hub.NotifyOfNewRoomMember(room)
+}
+
+func isMemberOf(room *model.Room, uid model.UserId) bool {
+	for _, m := range room.Members {
+		if m.Id == uid {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startBot registers a client played by the server for the member.
+func (h *Hub) startBot(uid model.UserId) error {
+	cli, err := NewClient(h, uid, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create bot client: %w", err)
+	}
+
+	cli.bot = true
+	cli.protocolVersion = ProtocolVersion
+	cli.features = allFeatures()
+	// ボットは前の絵を読んで描くので，画像はデータURLのまま受け取る
+	delete(cli.features, oapi.WsFeatureImageUrls)
+	h.registerCh <- cli
+	go cli.botPump()
+
+	return nil
+}
+
+// bot decides the requests of a bot from the events sent to it.
+type bot struct {
+	rng   *rand.Rand
+	style canvas.DrawStyle
+	// DRAW_START / ANSWER_START を受け取っていて，まだ送信していないとき
+	drawing   *oapi.WsDrawStartEventBody
+	answering bool
+	timeLimit time.Duration
+	// 現在のフェーズで送る READY (一時停止中に送って拒否されたときは再開後にもう一度送る)
+	readyEvent oapi.WsEvent
+}
+
+type botRequest struct {
+	req   *oapi.WsJSONRequestBody
+	delay time.Duration
+}
+
+// botPump plays the game for a bot by reacting to the events sent to the client,
+// in the same way as the human clients do.
+func (c *Client) botPump() {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	b := &bot{
+		rng:       rng,
+		style:     canvas.RandDrawStyle(rng),
+		timeLimit: time.Duration(model.DefaultTimeLimit) * time.Second,
+	}
+
+	// イベントを受け取り続けられるように，リクエストは別のgoroutineで送る
+	reqs := make(chan botRequest, 16)
+	defer close(reqs)
+
+	// 解除されると send より先に done が閉じるので，待っている間に抜けられる
+	go func() {
+		for r := range reqs {
+			select {
+			case <-time.After(r.delay):
+			case <-c.done:
+				return
+			}
+
+			// 待ち終わりと解除が重なったときも送らない
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+
+			c.handleRequest(r.req)
+		}
+	}()
+
+	for msg := range c.send {
+		for _, r := range b.react(msg) {
+			select {
+			case reqs <- r:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+func (b *bot) react(msg *oapi.WsSendMessage) []botRequest {
+	switch msg.Type {
+	case oapi.WsEventGAMESTART:
+		body := new(oapi.WsGameStartEventBody)
+		if err := convertBody(msg.Body, body); err == nil {
+			b.timeLimit = time.Duration(body.TimeLimit) * time.Second
+		}
+
+		return b.ready(oapi.WsEventODAIREADY)
+	case oapi.WsEventODAIFINISH:
+		b.readyEvent = ""
+
+		return b.request(oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{
+			Odai: random.OdaiExample(),
+		})
+	case oapi.WsEventDRAWSTART:
+		body := new(oapi.WsDrawStartEventBody)
+		if err := convertBody(msg.Body, body); err != nil {
+			logger.Echo.Error("bot failed to read DRAW_START:", err.Error())
+			return nil
+		}
+
+		b.drawing = body
+
+		return b.ready(oapi.WsEventDRAWREADY)
+	case oapi.WsEventDRAWFINISH:
+		b.readyEvent = ""
+		if b.drawing == nil {
+			return nil
+		}
+
+		img, err := b.draw(b.drawing)
+		drawPhaseNum := b.drawing.DrawPhaseNum
+		b.drawing = nil
+		if err != nil {
+			logger.Echo.Error("bot failed to draw:", err.Error())
+			return nil
+		}
+
+		return b.request(oapi.WsEventDRAWSEND, &oapi.WsDrawSendEventBody{
+			Img:          img,
+			DrawPhaseNum: &drawPhaseNum,
+		})
+	case oapi.WsEventANSWERSTART:
+		b.answering = true
+
+		return b.ready(oapi.WsEventANSWERREADY)
+	case oapi.WsEventANSWERFINISH:
+		b.readyEvent = ""
+		if !b.answering {
+			return nil
+		}
+
+		b.answering = false
+
+		return b.request(oapi.WsEventANSWERSEND, &oapi.WsAnswerSendEventBody{
+			Answer: random.OdaiExample(),
+		})
+	case oapi.WsEventGAMEUPDATEPAUSE:
+		body := new(oapi.WsGameUpdatePauseEventBody)
+		if err := convertBody(msg.Body, body); err != nil || body.Paused || len(b.readyEvent) == 0 {
+			return nil
+		}
+
+		return b.ready(b.readyEvent)
+	default:
+		return nil
+	}
+}
+
+// ready tells the server that the input is done after thinking for a while.
+func (b *bot) ready(event oapi.WsEvent) []botRequest {
+	b.readyEvent = event
+
+	think := botMinThinkTime + time.Duration(b.rng.Int63n(int64(botMaxThinkTime-botMinThinkTime)))
+	if limit := b.timeLimit / 2; limit < think {
+		think = limit
+	}
+
+	return []botRequest{{
+		req: &oapi.WsJSONRequestBody{
+			Type: event,
+			Body: json.RawMessage("{}"),
+		},
+		delay: think,
+	}}
+}
+
+func (b *bot) request(event oapi.WsEvent, body interface{}) []botRequest {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		logger.Echo.Error("bot failed to encode request:", err.Error())
+		return nil
+	}
+
+	return []botRequest{{
+		req: &oapi.WsJSONRequestBody{
+			Type: event,
+			Body: buf,
+		},
+	}}
+}
+
+// draw fills the assigned area on top of the drawing so far.
+func (b *bot) draw(e *oapi.WsDrawStartEventBody) (string, error) {
+	// まだ誰も描いていないときはボードの大きさで描く
+	size, err := canvas.BoardSize(e.Canvas.BoardName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get board size: %w", err)
+	}
+	bounds := image.Rectangle{Max: size}
+
+	prev, err := canvas.DecodeImage(e.Img)
+	if err == nil {
+		bounds = prev.Bounds()
+	} else {
+		prev = nil
+	}
+
+	area, err := canvas.AreaRect(bounds, e.Canvas.BoardName, e.Canvas.AreaId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get area: %w", err)
+	}
+
+	img, err := canvas.DrawArea(b.rng, b.style, bounds, area, prev)
+	if err != nil {
+		return "", fmt.Errorf("failed to draw area: %w", err)
+	}
+
+	return model.Img(img).AddPrefix(), nil
+}
+
+// convertBody converts the body of a message to the type of the event through JSON.
+func convertBody(from interface{}, to interface{}) error {
+	buf, err := json.Marshal(from)
+	if err != nil {
+		return fmt.Errorf("failed to encode body: %w", err)
+	}
+
+	if err := json.Unmarshal(buf, to); err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	return nil
+}
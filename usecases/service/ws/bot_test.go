@@ -0,0 +1,159 @@
+package ws
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	usecases "github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+)
+
+func TestBotReact(t *testing.T) {
+	drawPhaseNum := 3
+	steps := []struct {
+		name string
+		msg  *oapi.WsSendMessage
+		// want は返すリクエストのイベント (空なら何も返さない)
+		want oapi.WsEvent
+	}{
+		{name: "game start", msg: &oapi.WsSendMessage{Type: oapi.WsEventGAMESTART, Body: oapi.WsGameStartEventBody{TimeLimit: 30}}, want: oapi.WsEventODAIREADY},
+		{name: "paused", msg: &oapi.WsSendMessage{Type: oapi.WsEventGAMEUPDATEPAUSE, Body: oapi.WsGameUpdatePauseEventBody{Paused: true}}},
+		{name: "resumed before sending", msg: &oapi.WsSendMessage{Type: oapi.WsEventGAMEUPDATEPAUSE, Body: oapi.WsGameUpdatePauseEventBody{Paused: false}}, want: oapi.WsEventODAIREADY},
+		{name: "odai finish", msg: &oapi.WsSendMessage{Type: oapi.WsEventODAIFINISH}, want: oapi.WsEventODAISEND},
+		{name: "resumed after sending", msg: &oapi.WsSendMessage{Type: oapi.WsEventGAMEUPDATEPAUSE, Body: oapi.WsGameUpdatePauseEventBody{Paused: false}}},
+		{name: "draw start", msg: &oapi.WsSendMessage{Type: oapi.WsEventDRAWSTART, Body: oapi.WsDrawStartEventBody{
+			Canvas:       oapi.Canvas{AreaId: 5, BoardName: model.BoardName4x4},
+			DrawPhaseNum: drawPhaseNum,
+		}}, want: oapi.WsEventDRAWREADY},
+		{name: "draw finish", msg: &oapi.WsSendMessage{Type: oapi.WsEventDRAWFINISH}, want: oapi.WsEventDRAWSEND},
+		{name: "draw finish twice", msg: &oapi.WsSendMessage{Type: oapi.WsEventDRAWFINISH}},
+		{name: "answer start", msg: &oapi.WsSendMessage{Type: oapi.WsEventANSWERSTART}, want: oapi.WsEventANSWERREADY},
+		{name: "answer finish", msg: &oapi.WsSendMessage{Type: oapi.WsEventANSWERFINISH}, want: oapi.WsEventANSWERSEND},
+		{name: "answer finish twice", msg: &oapi.WsSendMessage{Type: oapi.WsEventANSWERFINISH}},
+		{name: "other event", msg: &oapi.WsSendMessage{Type: oapi.WsEventSHOWSTART}},
+	}
+
+	b := &bot{
+		rng:       rand.New(rand.NewSource(1)),
+		style:     canvas.DrawStyleShapes,
+		timeLimit: time.Duration(model.DefaultTimeLimit) * time.Second,
+	}
+	for _, tt := range steps {
+		reqs := b.react(tt.msg)
+		if len(tt.want) == 0 {
+			if len(reqs) != 0 {
+				t.Fatalf("%s: react() = %s, want nothing", tt.name, reqs[0].req.Type)
+			}
+			continue
+		}
+
+		if len(reqs) != 1 || reqs[0].req.Type != tt.want {
+			t.Fatalf("%s: react() = %v, want %s", tt.name, reqs, tt.want)
+		}
+
+		r := reqs[0]
+		switch tt.want {
+		case oapi.WsEventODAIREADY, oapi.WsEventDRAWREADY, oapi.WsEventANSWERREADY:
+			if r.delay < botMinThinkTime || botMaxThinkTime < r.delay {
+				t.Errorf("%s: delay = %v, want between %v and %v", tt.name, r.delay, botMinThinkTime, botMaxThinkTime)
+			}
+		case oapi.WsEventDRAWSEND:
+			e := new(oapi.WsDrawSendEventBody)
+			if err := json.Unmarshal(r.req.Body, e); err != nil {
+				t.Fatal(err)
+			}
+			if e.DrawPhaseNum == nil || *e.DrawPhaseNum != drawPhaseNum {
+				t.Errorf("%s: drawPhaseNum = %v, want %d", tt.name, e.DrawPhaseNum, drawPhaseNum)
+			}
+			if _, err := canvas.DecodeDrawing(e.Img, model.BoardName4x4); err != nil {
+				t.Errorf("%s: the drawing is rejected: %v", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestBotsPlayGame(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+
+	// ホストも含めて全員をボットにする
+	uids := []model.UserId{room.HostId}
+	for i := 0; i < 2; i++ {
+		_, uid, err := h.repo.JoinRoom(&usecases.JoinRoomArgs{
+			RoomId:   room.Id,
+			Username: "bot",
+			Bot:      true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		uids = append(uids, uid)
+	}
+	for _, uid := range uids {
+		if err := h.startBot(uid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for _, uid := range uids {
+			if c, ok := h.userIdToClient.Load(uid); ok {
+				h.unregister(c)
+			}
+		}
+	})
+	eventually(t, "the bots are registered", func() bool {
+		for _, uid := range uids {
+			if _, ok := h.userIdToClient.Load(uid); !ok {
+				return false
+			}
+		}
+		return true
+	})
+
+	// 考える時間は制限時間の半分までなので，短くして早く終わらせる
+	game := room.Game
+	game.TimeLimit = 1
+	game.SetBoard(model.BoardName1x1, 1)
+
+	s, ok := h.roomIdToServer.Load(room.Id)
+	if !ok {
+		t.Fatal("the server of the room is not found")
+	}
+	if err := s.transit(model.GameStatusOdai); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		s.mux.Lock()
+		status := game.Status
+		s.mux.Unlock()
+		if status == model.GameStatusShow {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the bots are still in %s", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if len(game.Odais) != len(uids) {
+		t.Fatalf("%d odais, want %d", len(game.Odais), len(uids))
+	}
+	for _, o := range game.Odais {
+		if o.Img.IsEmpty() {
+			t.Errorf("odai %q is not drawn", o.Title)
+		}
+		if o.Answer == nil || len(*o.Answer) == 0 {
+			t.Errorf("odai %q is not answered", o.Title)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/util/errcode"
+	"github.com/21hack02win/nascalay-backend/util/logger"
+	"github.com/gofrs/uuid"
+)
+
+// NOTE: 複数インスタンスで動かす場合，ルームのゲーム状態はルームを作成したインスタンス(オーナー)だけが持つ
+// 他のインスタンスに接続したクライアントのイベントはブローカー経由でオーナーに転送され，
+// オーナーは転送先のクライアントを send チャネルの中身をブローカーに流すだけの Client として扱う
+
+const roomsTopic = "nascalay.rooms"
+
+// pendingConnectTimeout is how long a connect request waits for the join of the member replicated from another instance.
+const pendingConnectTimeout = 10 * time.Second
+
+func instanceTopic(instanceId string) string {
+	return "nascalay.instance." + instanceId
+}
+
+func userTopic(uid model.UserId) string {
+	return "nascalay.user." + uid.UUID().String()
+}
+
+type busMessageKind string
+
+const (
+	// エッジ -> オーナー
+	busMessageConnect    busMessageKind = "connect"
+	busMessageDisconnect busMessageKind = "disconnect"
+	busMessageRequest    busMessageKind = "request"
+	// オーナー -> エッジ
+	busMessageSend  busMessageKind = "send"
+	busMessageClose busMessageKind = "close"
+	// 任意のインスタンス -> 全インスタンス
+	busMessageCreateRoom busMessageKind = "createRoom"
+	busMessageJoinRoom   busMessageKind = "joinRoom"
+	busMessageChangeHost busMessageKind = "changeHost"
+	busMessageDeleteRoom busMessageKind = "deleteRoom"
+)
+
+type busMessage struct {
+	Kind    busMessageKind         `json:"kind"`
+	Origin  string                 `json:"origin"`
+	RoomId  model.RoomId           `json:"roomId,omitempty"`
+	UserId  uuid.UUID              `json:"userId,omitempty"`
+	Request *oapi.WsReceiveMessage `json:"request,omitempty"`
+	Message *oapi.WsSendMessage    `json:"message,omitempty"`
+	Room    *oapi.Room             `json:"room,omitempty"`
+	User    *oapi.User             `json:"user,omitempty"`
+	Lang    errcode.Lang           `json:"lang,omitempty"`
+	// Negotiated protocol version and features of the client connected to the edge.
+	ProtocolVersion int              `json:"protocolVersion,omitempty"`
+	Features        []oapi.WsFeature `json:"features,omitempty"`
+}
+
+func (h *Hub) publish(topic string, msg *busMessage) {
+	msg.Origin = h.instanceId
+
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		logger.Echo.Error("failed to encode bus message:", err.Error())
+		return
+	}
+
+	if err := h.broker.Publish(topic, buf); err != nil {
+		logger.Echo.Error("failed to publish bus message:", err.Error())
+	}
+}
+
+func decodeBusMessage(payload []byte) (*busMessage, bool) {
+	msg := new(busMessage)
+	if err := json.Unmarshal(payload, msg); err != nil {
+		logger.Echo.Error("failed to decode bus message:", err.Error())
+		return nil, false
+	}
+
+	return msg, true
+}
+
+// ownerOf returns the id of the instance which runs the game of the room
+func (h *Hub) ownerOf(rid model.RoomId) string {
+	if owner, ok := h.roomIdToOwner.Load(rid); ok {
+		return owner
+	}
+
+	return h.instanceId
+}
+
+// Owner side
+
+func (h *Hub) handleInstanceMessage(payload []byte) {
+	msg, ok := decodeBusMessage(payload)
+	if !ok {
+		return
+	}
+
+	uid := model.UserId(msg.UserId)
+
+	switch msg.Kind {
+	case busMessageConnect:
+		h.connectRelayClient(msg)
+	case busMessageDisconnect:
+		h.pendingMux.Lock()
+		delete(h.pendingConnects, uid)
+		h.pendingMux.Unlock()
+
+		if c, ok := h.userIdToClient.Load(uid); ok && c.conn == nil && !c.bot {
+			h.unregisterFromBus(c)
+		}
+	case busMessageRequest:
+		if c, ok := h.userIdToClient.Load(uid); ok && c.conn == nil && !c.bot && msg.Request != nil {
+			c.handleRequest((*oapi.WsJSONRequestBody)(msg.Request))
+		}
+	}
+}
+
+// unregisterFromBus hands the client to the hub without blocking the broker subscription.
+// ハブは解除するときにブローカーへ送信・購読解除するので，購読の goroutine で待つとデッドロックする
+func (h *Hub) unregisterFromBus(c *Client) {
+	go func() {
+		h.unregisterCh <- c
+	}()
+}
+
+// connectRelayClient creates the client for the member connected to another instance.
+// 参加の複製より先に接続が届いたときは，参加が届いてから作る
+func (h *Hub) connectRelayClient(msg *busMessage) {
+	uid := model.UserId(msg.UserId)
+
+	h.pendingMux.Lock()
+	if _, err := h.repo.GetRoomFromUserId(uid); errors.Is(err, repository.ErrNotFound) {
+		h.pendingConnects[uid] = msg
+		h.pendingMux.Unlock()
+
+		time.AfterFunc(pendingConnectTimeout, func() {
+			h.pendingMux.Lock()
+			defer h.pendingMux.Unlock()
+
+			if h.pendingConnects[uid] == msg {
+				delete(h.pendingConnects, uid)
+				logger.Echo.Errorf("failed to create relay client(userId:%s): member has not joined", uid.UUID().String())
+			}
+		})
+
+		return
+	}
+	h.pendingMux.Unlock()
+
+	cli, err := NewClient(h, uid, nil)
+	if err != nil {
+		logger.Echo.Error("failed to create relay client:", err.Error())
+		return
+	}
+
+	// エラーのメッセージの言語や有効な機能はエッジのクライアントに合わせる
+	if len(msg.Lang) > 0 {
+		cli.lang = msg.Lang
+	}
+	if msg.ProtocolVersion > 0 {
+		cli.protocolVersion = msg.ProtocolVersion
+	}
+	cli.features = newFeatureSet(msg.Features)
+
+	h.registerCh <- cli
+	go cli.relayPump()
+}
+
+// takePendingConnect returns the connect request of the member which was waiting for the join.
+func (h *Hub) takePendingConnect(uid model.UserId) (*busMessage, bool) {
+	h.pendingMux.Lock()
+	defer h.pendingMux.Unlock()
+
+	msg, ok := h.pendingConnects[uid]
+	delete(h.pendingConnects, uid)
+
+	return msg, ok
+}
+
+// relayPump pumps messages for a client connected to another instance to the broker.
+func (c *Client) relayPump() {
+	for msg := range c.send {
+		c.hub.publish(userTopic(c.userId), &busMessage{
+			Kind:    busMessageSend,
+			Message: msg,
+		})
+	}
+
+	c.hub.publish(userTopic(c.userId), &busMessage{
+		Kind: busMessageClose,
+	})
+}
+
+// Edge side
+
+func (h *Hub) connectToOwner(c *Client) error {
+	unsubscribe, err := h.broker.Subscribe(userTopic(c.userId), func(payload []byte) {
+		msg, ok := decodeBusMessage(payload)
+		if !ok {
+			return
+		}
+
+		if cur, ok := h.userIdToClient.Load(c.userId); !ok || cur != c {
+			return
+		}
+
+		switch msg.Kind {
+		case busMessageSend:
+			if msg.Message != nil {
+				c.push(msg.Message)
+			}
+		case busMessageClose:
+			h.unregisterFromBus(c)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	c.unsubscribe = unsubscribe
+	h.publish(instanceTopic(c.owner), &busMessage{
+		Kind:            busMessageConnect,
+		UserId:          c.userId.UUID(),
+		Lang:            c.lang,
+		ProtocolVersion: c.protocolVersion,
+		Features:        c.features.list(),
+	})
+
+	return nil
+}
+
+func (h *Hub) disconnectFromOwner(c *Client) {
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
+
+	h.publish(instanceTopic(c.owner), &busMessage{
+		Kind:   busMessageDisconnect,
+		UserId: c.userId.UUID(),
+	})
+}
+
+func (h *Hub) forwardToOwner(c *Client, req *oapi.WsJSONRequestBody) {
+	h.publish(instanceTopic(c.owner), &busMessage{
+		Kind:    busMessageRequest,
+		UserId:  c.userId.UUID(),
+		Request: (*oapi.WsReceiveMessage)(req),
+	})
+}
+
+// Room replication
+
+func (h *Hub) handleRoomsMessage(payload []byte) {
+	msg, ok := decodeBusMessage(payload)
+	if !ok || msg.Origin == h.instanceId {
+		return
+	}
+
+	switch msg.Kind {
+	case busMessageCreateRoom:
+		if msg.Room == nil {
+			return
+		}
+
+		if err := h.repo.RestoreRoom(roomFromOapi(msg.Room)); err != nil {
+			logger.Echo.Error("failed to replicate room:", err.Error())
+			return
+		}
+
+		h.roomIdToOwner.Store(msg.RoomId, msg.Origin)
+	case busMessageJoinRoom:
+		if msg.User == nil {
+			return
+		}
+
+		// 接続を待たせている間に参加を書き込まないように，ロックを取ってから追加する
+		h.pendingMux.Lock()
+		room, err := h.repo.AddRoomMember(msg.RoomId, userFromOapi(msg.User))
+		h.pendingMux.Unlock()
+		if err != nil {
+			logger.Echo.Error("failed to replicate room member:", err.Error())
+			return
+		}
+
+		if h.ownerOf(room.Id) == h.instanceId {
+			if err := h.notifyOfNewRoomMember(room); err != nil {
+				logger.Echo.Error(err.Error())
+			}
+		}
+
+		if pending, ok := h.takePendingConnect(model.UserId(msg.User.UserId)); ok {
+			h.connectRelayClient(pending)
+		}
+	case busMessageChangeHost:
+		if err := h.repo.SetRoomHost(msg.RoomId, model.UserId(msg.UserId)); err != nil {
+			logger.Echo.Error("failed to replicate host:", err.Error())
+		}
+	case busMessageDeleteRoom:
+		if err := h.repo.DeleteRoom(msg.RoomId); err != nil {
+			logger.Echo.Error("failed to replicate room deletion:", err.Error())
+		}
+
+		h.roomIdToOwner.Delete(msg.RoomId)
+	}
+}
+
+func userFromOapi(u *oapi.User) model.User {
+	return model.User{
+		Id:   model.UserId(u.UserId),
+		Name: model.Username(u.Username),
+		Avatar: model.Avatar{
+			Type:  model.AvatarType(u.Avatar.Type),
+			Color: model.AvatarColor(u.Avatar.Color),
+		},
+		Bot: u.Bot != nil && *u.Bot,
+	}
+}
+
+func roomFromOapi(r *oapi.Room) *model.Room {
+	members := make([]model.User, len(r.Members))
+	for i := range r.Members {
+		members[i] = userFromOapi(&r.Members[i])
+	}
+
+	return &model.Room{
+		Id:       model.RoomId(r.RoomId),
+		Capacity: model.Capacity(r.Capacity),
+		HostId:   model.UserId(r.HostId),
+		Members:  members,
+	}
+}
@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/random"
+)
+
+func TestConnectBeforeJoin(t *testing.T) {
+	br := broker.NewLocalBroker()
+	owner, edge := newTestHub(t, br), newTestHub(t, br)
+	room := newTestRoom(t, owner, edge)
+
+	// 参加の複製より先に接続が届く
+	uid := random.UserId()
+	edge.publish(instanceTopic(owner.instanceId), &busMessage{
+		Kind:   busMessageConnect,
+		UserId: uid.UUID(),
+		Lang:   "en",
+	})
+	eventually(t, "the connect is pending", func() bool {
+		owner.pendingMux.Lock()
+		defer owner.pendingMux.Unlock()
+		_, ok := owner.pendingConnects[uid]
+		return ok
+	})
+
+	u := oapi.RefillUser(&model.User{Id: uid, Name: "guest"})
+	edge.publish(roomsTopic, &busMessage{
+		Kind:   busMessageJoinRoom,
+		RoomId: room.Id,
+		User:   &u,
+	})
+
+	eventually(t, "the relay client is registered", func() bool {
+		_, ok := owner.userIdToClient.Load(uid)
+		return ok
+	})
+
+	c, _ := owner.userIdToClient.Load(uid)
+	if c.conn != nil || c.server == nil || c.lang != "en" {
+		t.Errorf("relay client = {conn: %v, server: %v, lang: %q}, want the one for the edge", c.conn, c.server, c.lang)
+	}
+}
+
+func TestPushAfterUnregister(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+
+	c, err := NewClient(h, room.HostId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.register(c)
+
+	// 送信待ちの goroutine がいても，解除で抜けてから閉じる
+	blocked := make(chan bool)
+	go func() {
+		for i := 0; i < cap(c.send); i++ {
+			c.push(&oapi.WsSendMessage{Type: oapi.WsEventROOMUPDATEOPTION})
+		}
+		blocked <- c.push(&oapi.WsSendMessage{Type: oapi.WsEventROOMUPDATEOPTION})
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	h.unregister(c)
+	h.unregister(c)
+
+	if <-blocked {
+		t.Error("push() to a full channel succeeded after unregister")
+	}
+	if c.push(&oapi.WsSendMessage{Type: oapi.WsEventROOMUPDATEOPTION}) {
+		t.Error("push() succeeded after unregister")
+	}
+	if _, ok := h.userIdToClient.Load(c.userId); ok {
+		t.Error("client is still registered")
+	}
+}
+
+func TestDisconnectWhileHubIsBusy(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+
+	relay, err := NewClient(h, room.HostId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.registerCh <- relay
+
+	// ハブが他のクライアントの解除で止まっている間に切断が届く
+	busy, err := NewClient(h, joinTestRoom(t, h, room, "busy"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy.sendMux.Lock()
+	go func() {
+		h.unregisterCh <- busy
+	}()
+	eventually(t, "the hub is unregistering the busy client", func() bool {
+		select {
+		case <-busy.done:
+			return true
+		default:
+			return false
+		}
+	})
+
+	payload, err := json.Marshal(&busMessage{Kind: busMessageDisconnect, UserId: relay.userId.UUID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handled := make(chan struct{})
+	go func() {
+		h.handleInstanceMessage(payload)
+		close(handled)
+	}()
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("the disconnect blocks the broker subscription until the hub is free")
+	}
+
+	busy.sendMux.Unlock()
+	eventually(t, "the relay client is unregistered", func() bool {
+		_, ok := h.userIdToClient.Load(relay.userId)
+		return !ok
+	})
+}
@@ -3,17 +3,19 @@ package ws
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/21hack02win/nascalay-backend/model"
 	"github.com/21hack02win/nascalay-backend/oapi"
 	"github.com/21hack02win/nascalay-backend/util/canvas"
+	"github.com/21hack02win/nascalay-backend/util/errcode"
 	"github.com/21hack02win/nascalay-backend/util/logger"
 	"github.com/21hack02win/nascalay-backend/util/random"
 	"github.com/gorilla/websocket"
-	"github.com/mitchellh/mapstructure"
 )
 
 const (
@@ -24,7 +26,8 @@ const (
 	pongWait = 60 * time.Second
 
 	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
+	// ping で往復時間も測るので，接続の維持に必要な間隔より短くしている
+	pingPeriod = 10 * time.Second
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 300000
@@ -36,6 +39,30 @@ type Client struct {
 	server *Server
 	conn   *websocket.Conn
 	send   chan *oapi.WsSendMessage
+	// done is closed when the client is unregistered, before send is closed.
+	// send は sendMux を取ってから送り，閉じるのは送っている goroutine がいなくなってからにする
+	done     chan struct{}
+	doneOnce sync.Once
+	sendMux  sync.RWMutex
+	closed   bool
+	// Payload of the close frame sent after the send channel is closed.
+	closeMsg []byte
+	// Id of the instance running the game when the room is owned by another instance.
+	owner       string
+	unsubscribe func()
+	// Whether the client is played by the server.
+	bot bool
+	// Language of the messages in the ERROR events.
+	lang errcode.Lang
+	// Negotiated protocol version and features of the connection.
+	protocolVersion int
+	features        featureSet
+	// Codec of the frames written to the connection.
+	codec codec
+	// Time to wait for more messages to send in a frame when batching.
+	batchWindow time.Duration
+	// Round trip time of the connection in nanoseconds measured by ping/pong.
+	rtt atomic.Int64
 }
 
 func NewClient(hub *Hub, userId model.UserId, conn *websocket.Conn) (*Client, error) {
@@ -44,6 +71,22 @@ func NewClient(hub *Hub, userId model.UserId, conn *websocket.Conn) (*Client, er
 		return nil, fmt.Errorf("failed to get room from userId: %w", err)
 	}
 
+	if owner := hub.ownerOf(room.Id); owner != hub.instanceId {
+		return &Client{
+			hub:    hub,
+			userId: userId,
+			conn:   conn,
+			send:   make(chan *oapi.WsSendMessage, 256),
+			done:   make(chan struct{}),
+			owner:  owner,
+			lang:   errcode.DefaultLang,
+			// 接続時にネゴシエーションした結果で上書きする
+			protocolVersion: legacyProtocolVersion,
+			features:        make(featureSet),
+			codec:           jsonCodec{},
+		}, nil
+	}
+
 	server, ok := hub.roomIdToServer.Load(room.Id)
 	if !ok {
 		server = &Server{
@@ -60,6 +103,12 @@ func NewClient(hub *Hub, userId model.UserId, conn *websocket.Conn) (*Client, er
 		server: server,
 		conn:   conn,
 		send:   make(chan *oapi.WsSendMessage, 256),
+		done:   make(chan struct{}),
+		lang:   errcode.DefaultLang,
+		// 接続時にネゴシエーションした結果で上書きする
+		protocolVersion: legacyProtocolVersion,
+		features:        make(featureSet),
+		codec:           jsonCodec{},
 	}, nil
 }
 
@@ -74,48 +123,36 @@ func (c *Client) writePump() {
 		ticker.Stop()
 		c.conn.Close()
 	}()
+
+	// 最初のフェーズから往復時間を使えるように，すぐに測り始める
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	c.conn.WriteMessage(websocket.PingMessage, pingPayload())
+
 	for {
 		select {
 		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
 				// The hub closed the channel.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				logger.Echo.Error("failed to create next writer:", err.Error())
+				c.writeClose()
 				return
 			}
 
-			buf, err := json.Marshal(message)
-			if err != nil {
-				logger.Echo.Error("failed to encode as JSON:", err.Error())
-				return
-			}
-
-			w.Write(buf)
-
-			// Add queued chat messages to the current websocket message.
-			for i := 0; i < len(c.send); i++ {
-				buf, err = json.Marshal(<-c.send)
-				if err != nil {
-					logger.Echo.Error("failed to encode as JSON:", err.Error())
+			batch, closed := c.collectBatch(message)
+			if len(batch) > 0 {
+				c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.writeFrame(batch); err != nil {
+					logger.Echo.Error("failed to write frame:", err.Error())
 					return
 				}
-
-				w.Write(buf)
 			}
 
-			if err := w.Close(); err != nil {
-				logger.Echo.Error("failed to close writer:", err.Error())
+			if closed {
+				c.writeClose()
 				return
 			}
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := c.conn.WriteMessage(websocket.PingMessage, pingPayload()); err != nil {
 				logger.Echo.Error("failed to write message:", err.Error())
 				return
 			}
@@ -134,37 +171,125 @@ func (c *Client) readPump() {
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
-	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+	c.conn.SetPongHandler(func(appData string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		c.observePong(appData)
+		return nil
+	})
 	for {
-		req := new(oapi.WsJSONRequestBody)
-		if err := c.conn.ReadJSON(req); err != nil {
+		frameType, data, err := c.conn.ReadMessage()
+		if err != nil {
 			if !websocket.IsCloseError(err) && !websocket.IsUnexpectedCloseError(err) {
 				logger.Echo.Error("websocket error occured:", err.Error())
 			}
 			break
 		}
 
-		if err := c.callEventHandler(req); err != nil {
-			logger.Echo.Error("websocket error occured:", err.Error())
-			c.send <- &oapi.WsSendMessage{
-				Type: oapi.WsEventERROR,
-				Body: &oapi.WsErrorBody{
-					Content: err.Error(),
-				},
-			}
+		cd, err := c.codecOfFrame(frameType)
+		if err != nil {
+			logger.Echo.Error("unsupported frame:", err.Error())
+			break
+		}
+
+		req, err := cd.decode(data)
+		if err != nil {
+			logger.Echo.Error("failed to decode message:", err.Error())
+			break
+		}
+
+		if len(c.owner) > 0 && req.Type != oapi.WsEventREQUESTCLOCKSYNC {
+			c.hub.forwardToOwner(c, req)
 			continue
 		}
+
+		c.handleRequest(req)
+	}
+}
+
+// handleRequest calls the event handler and replies ERROR if it fails.
+func (c *Client) handleRequest(req *oapi.WsJSONRequestBody) {
+	if err := c.callEventHandler(req); err != nil {
+		logger.Echo.Error("websocket error occured:", err.Error())
+		code := ErrorCodeOf(err)
+		event := req.Type
+		body := &oapi.WsErrorBody{
+			Code:    code,
+			Message: errcode.Message(code, c.lang),
+			Content: err.Error(),
+			Event:   &event,
+		}
+
+		// 不正なフィールドをクライアントに伝える
+		var fe *fieldError
+		if errors.As(err, &fe) {
+			body.Field = &fe.field
+		}
+
+		c.push(&oapi.WsSendMessage{
+			Type: oapi.WsEventERROR,
+			Body: body,
+		})
 	}
 }
 
+// push sends the message to the client, or drops it if the client has been unregistered.
+func (c *Client) push(msg *oapi.WsSendMessage) bool {
+	c.sendMux.RLock()
+	defer c.sendMux.RUnlock()
+
+	if c.closed {
+		return false
+	}
+
+	// 送信待ちの間に登録が解除されたら諦める
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// closeSend closes the send channel, and reports false if it has already been closed.
+func (c *Client) closeSend() bool {
+	// 先に done を閉じて，送信待ちの goroutine を抜けさせる
+	c.doneOnce.Do(func() { close(c.done) })
+
+	c.sendMux.Lock()
+	defer c.sendMux.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	c.closed = true
+	close(c.send)
+
+	return true
+}
+
 // Client Events
 
 func (c *Client) callEventHandler(req *oapi.WsJSONRequestBody) error {
+	if !c.accepts(req.Type) {
+		return errUnsupportedFeature
+	}
+
 	switch req.Type {
 	case oapi.WsEventROOMSETOPTION:
 		return c.sendRoomSetOptionEvent(req.Body)
+	case oapi.WsEventROOMSETTEAM:
+		return c.sendRoomSetTeamEvent(req.Body)
+	case oapi.WsEventROOMADDBOT:
+		return c.sendRoomAddBotEvent(req.Body)
+	case oapi.WsEventROOMSETTEMPLATE:
+		return c.sendRoomSetTemplateEvent(req.Body)
 	case oapi.WsEventREQUESTGAMESTART:
 		return c.sendRequestGameStartEvent(req.Body)
+	case oapi.WsEventGAMEPAUSE:
+		return c.sendGamePauseEvent(req.Body)
+	case oapi.WsEventGAMERESUME:
+		return c.sendGameResumeEvent(req.Body)
 	case oapi.WsEventODAIREADY:
 		return c.sendOdaiReadyEvent(req.Body)
 	case oapi.WsEventODAICANCEL:
@@ -187,6 +312,8 @@ func (c *Client) callEventHandler(req *oapi.WsJSONRequestBody) error {
 		return c.sendShowNextEvent(req.Body)
 	case oapi.WsEventRETURNROOM:
 		return c.sendReturnRoomEvent(req.Body)
+	case oapi.WsEventREQUESTCLOCKSYNC:
+		return c.sendRequestClockSyncEvent(req.Body)
 	default:
 		return errUnknownEventType
 	}
@@ -194,7 +321,7 @@ func (c *Client) callEventHandler(req *oapi.WsJSONRequestBody) error {
 
 // ROOM_SET_OPTION
 // ゲームのオプションを設定する (ホスト -> サーバー)
-func (c *Client) sendRoomSetOptionEvent(body interface{}) error {
+func (c *Client) sendRoomSetOptionEvent(body json.RawMessage) error {
 	if !c.server.room.GameStatusIs(model.GameStatusRoom) {
 		return errWrongPhase
 	}
@@ -203,46 +330,225 @@ func (c *Client) sendRoomSetOptionEvent(body interface{}) error {
 		return errUnAuthorized
 	}
 
-	if body == nil {
-		return errNilBody
-	}
-
 	e := new(oapi.WsRoomSetOptionEventBody)
-	if err := mapstructure.Decode(body, e); err != nil {
+	if err := decodeBody(body, e); err != nil {
 		return fmt.Errorf("failed to decode body: %w", err)
 	}
 
-	updateBody := new(oapi.WsRoomUpdateOptionEventBody)
+	if err := c.checkOptionFeatures(e); err != nil {
+		return err
+	}
+
 	game := c.server.room.Game
 
+	// 一部だけ設定されたまま終わらないように，すべての値を確かめてから設定する
+	mode := game.Mode
+	if e.GameMode != nil {
+		m, err := gameModeOf(*e.GameMode)
+		if err != nil {
+			return err
+		}
+		mode = m
+	}
+
+	if e.TeamNum != nil {
+		if err := c.server.checkTeamNum(*e.TeamNum); err != nil {
+			return err
+		}
+	}
+
+	order := game.AreaOrder
+	if e.AreaOrder != nil {
+		o, err := areaOrderOf(*e.AreaOrder)
+		if err != nil {
+			return err
+		}
+		order = o
+	}
+
+	var palette model.Palette
+	if e.Palette != nil {
+		p, err := paletteOf(*e.Palette)
+		if err != nil {
+			return err
+		}
+		palette = p
+	}
+
+	var (
+		board         canvas.Board
+		template      model.Img
+		odaiTemplates map[model.UserId]model.Img
+	)
+	if e.BoardName != nil {
+		if mode == model.GameModeRelay {
+			return errBoardInRelayMode
+		}
+
+		b, err := canvas.BoardOf(*e.BoardName)
+		if err != nil {
+			return errUnknownBoard
+		}
+		board = b
+
+		// モードを変えるとボードも変わるので，変えた後のボードから合わせる
+		from := game.Canvas.BoardName
+		if e.GameMode != nil {
+			from = model.DefaultBoardNameOf(mode)
+		}
+
+		template, odaiTemplates, err = c.server.resizeTemplates(from, *e.BoardName)
+		if err != nil {
+			return err
+		}
+	}
+
+	// マスクで定義されたボードには行と列がないので，random 以外の順番は選べない
+	boardName := game.Canvas.BoardName
+	if e.GameMode != nil {
+		boardName = model.DefaultBoardNameOf(mode)
+	}
+	if e.BoardName != nil {
+		boardName = *e.BoardName
+	}
+	if order != model.AreaOrderRandom && !canvas.IsGridBoard(boardName) {
+		return errAreaOrderOnBoard
+	}
+
 	// Set options
+	updateBody := new(oapi.WsRoomUpdateOptionEventBody)
+
 	if e.TimeLimit != nil {
 		game.TimeLimit = model.TimeLimit(*e.TimeLimit)
 		updateBody.TimeLimit = e.TimeLimit
 	}
 
+	if e.GameMode != nil {
+		game.SetMode(mode)
+		updateBody.GameMode = e.GameMode
+	}
+
+	// チーム分けにも使うので，チーム数より先に設定する
+	if e.Seed != nil {
+		game.Seed = *e.Seed
+	}
+
+	if e.TeamNum != nil {
+		c.server.setTeamNum(*e.TeamNum)
+		updateBody.TeamNum = e.TeamNum
+	}
+
+	if e.RoundNum != nil {
+		game.RoundNum = *e.RoundNum
+		updateBody.RoundNum = e.RoundNum
+	}
+
+	if e.FogRadius != nil {
+		game.FogRadius = *e.FogRadius
+		updateBody.FogRadius = e.FogRadius
+	}
+
+	if e.AreaOrder != nil {
+		game.AreaOrder = order
+		updateBody.AreaOrder = e.AreaOrder
+	}
+
+	if e.Palette != nil {
+		game.Palette = palette
+		updateBody.Palette = e.Palette
+	}
+
+	if e.BoardName != nil {
+		game.SetBoard(*e.BoardName, board.AreaNum())
+		game.Template, game.OdaiTemplates = template, odaiTemplates
+		updateBody.BoardName = e.BoardName
+	}
+
 	if err := c.server.sendRoomUpdateOptionEvent(updateBody); err != nil {
 		return c.server.sendEventErr(err, oapi.WsEventROOMUPDATEOPTION)
 	}
 
+	if e.TeamNum != nil {
+		if err := c.server.sendRoomUpdateTeamsEvent(); err != nil {
+			return c.server.sendEventErr(err, oapi.WsEventROOMUPDATETEAMS)
+		}
+	}
+
 	return nil
 }
 
+// checkOptionFeatures rejects the options which the client has not enabled.
+func (c *Client) checkOptionFeatures(e *oapi.WsRoomSetOptionEventBody) error {
+	if e.GameMode != nil && *e.GameMode == oapi.GameModeRelay && !c.supports(oapi.WsFeatureRelayMode) {
+		return errUnsupportedFeature
+	}
+
+	// 機能が無効でも，機能を使わない値 (チームなし，1 ラウンド) は受け付ける
+	if e.TeamNum != nil && *e.TeamNum != 0 && !c.supports(oapi.WsFeatureTeamMode) {
+		return errUnsupportedFeature
+	}
+
+	if e.RoundNum != nil && *e.RoundNum != 1 && !c.supports(oapi.WsFeatureRounds) {
+		return errUnsupportedFeature
+	}
+
+	// グリッドのボードは名前だけで描けるので，機能がなくても選べる
+	if e.BoardName != nil && !canvas.IsGridBoard(*e.BoardName) && !c.supports(oapi.WsFeatureBoards) {
+		return errUnsupportedFeature
+	}
+
+	if e.Palette != nil && *e.Palette != oapi.PaletteFree && !c.supports(oapi.WsFeaturePalette) {
+		return errUnsupportedFeature
+	}
+
+	return nil
+}
+
+func areaOrderOf(order oapi.AreaOrder) (model.AreaOrder, error) {
+	switch order {
+	case oapi.AreaOrderRandom:
+		return model.AreaOrderRandom, nil
+	case oapi.AreaOrderRaster:
+		return model.AreaOrderRaster, nil
+	case oapi.AreaOrderSpiral:
+		return model.AreaOrderSpiral, nil
+	case oapi.AreaOrderGrow:
+		return model.AreaOrderGrow, nil
+	case oapi.AreaOrderRegion:
+		return model.AreaOrderRegion, nil
+	default:
+		return 0, errUnknownAreaOrder
+	}
+}
+
+func paletteOf(palette oapi.Palette) (model.Palette, error) {
+	switch palette {
+	case oapi.PaletteFree:
+		return model.PaletteFree, nil
+	case oapi.PaletteMonochrome:
+		return model.PaletteMonochrome, nil
+	case oapi.PaletteFour:
+		return model.PaletteFour, nil
+	case oapi.PalettePlayer:
+		return model.PalettePlayer, nil
+	default:
+		return 0, errUnknownPalette
+	}
+}
+
 // REQUEST_GAME_START
 // ゲームを開始する (ホスト -> サーバー)
-func (c *Client) sendRequestGameStartEvent(_ interface{}) error {
+func (c *Client) sendRequestGameStartEvent(_ json.RawMessage) error {
 	if !c.server.room.GameStatusIs(model.GameStatusRoom) {
 		return errWrongPhase
 	}
-	if len(c.server.room.Members) < 2 {
-		return errNotEnoughMember
-	}
 
 	if c.userId != c.server.room.HostId {
 		return errUnAuthorized
 	}
 
-	if err := c.server.sendGameStartEvent(); err != nil {
+	// ODAIフェーズに移行
+	if err := c.server.transit(model.GameStatusOdai); err != nil {
 		return c.server.sendEventErr(err, oapi.WsEventGAMESTART)
 	}
 
@@ -251,15 +557,18 @@ func (c *Client) sendRequestGameStartEvent(_ interface{}) error {
 
 // ODAI_READY
 // お題の入力が完了していることを通知する (ルームの各員 -> サーバー)
-func (c *Client) sendOdaiReadyEvent(_ interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusOdai) {
-		return errWrongPhase
+func (c *Client) sendOdaiReadyEvent(_ json.RawMessage) error {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	if err := c.server.checkPhaseInput(model.GameStatusOdai); err != nil {
+		return err
 	}
 
 	c.server.room.Game.AddReady(c.userId)
 
 	if c.server.allMembersAreReady() {
-		if err := c.server.sendOdaiFinishEvent(); err != nil {
+		if err := c.server.finishPhaseLocked(model.GameStatusOdai); err != nil {
 			return c.server.sendEventErr(err, oapi.WsEventODAIFINISH)
 		}
 	} else {
@@ -273,9 +582,12 @@ func (c *Client) sendOdaiReadyEvent(_ interface{}) error {
 
 // ODAI_CANCEL
 // お題の入力の完了を解除する (ルームの各員 -> サーバー)
-func (c *Client) sendOdaiCancelEvent(_ interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusOdai) {
-		return errWrongPhase
+func (c *Client) sendOdaiCancelEvent(_ json.RawMessage) error {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	if err := c.server.checkPhaseInput(model.GameStatusOdai); err != nil {
+		return err
 	}
 
 	c.server.room.Game.CancelReady(c.userId)
@@ -290,27 +602,31 @@ func (c *Client) sendOdaiCancelEvent(_ interface{}) error {
 // ODAI_SEND
 // お題を送信する (ルームの各員 -> サーバー)
 // DRAWフェーズを開始する
-func (c *Client) sendOdaiSendEvent(body interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusOdai) {
-		return errWrongPhase
+func (c *Client) sendOdaiSendEvent(body json.RawMessage) error {
+	e := new(oapi.WsOdaiSendEventBody)
+	if err := decodeBody(body, e); err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
 	}
 
-	if body == nil {
-		return errNilBody
-	}
+	// 締め切り後のタイマーがフェーズを進めている間に書き込まないように，遷移までロックを取る
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
 
-	e := new(oapi.WsOdaiSendEventBody)
-	if err := mapstructure.Decode(body, e); err != nil {
-		return fmt.Errorf("failed to decode body: %w", err)
+	if err := c.server.checkPhaseInput(model.GameStatusOdai); err != nil {
+		return err
 	}
 
 	game := c.server.room.Game
 
 	// 存在チェック
 	for _, v := range game.Odais {
-		if v.SenderId == c.userId || v.Title == model.OdaiTitle(e.Odai) {
+		if v.SenderId == c.userId {
 			return errAlreadyExists
 		}
+
+		if v.Title == model.OdaiTitle(e.Odai) {
+			return errDuplicateOdai
+		}
 	}
 
 	game.AddOdai(c.userId, model.OdaiTitle(e.Odai))
@@ -325,18 +641,10 @@ func (c *Client) sendOdaiSendEvent(body interface{}) error {
 
 	if len(game.Odais)+len(odaisByUnregisteredClients) == len(c.server.room.Members) {
 		for _, Id := range odaisByUnregisteredClients {
-			game.Odais = append(game.Odais, &model.Odai{
-				Title:     model.OdaiTitle(random.OdaiExample()),
-				SenderId:  Id,
-				DrawerSeq: []model.Drawer{},
-			})
-		}
-		game.ResetReady()
-		game.Status = model.GameStatusDraw
-		game.DrawCount = 0
-		random.SetupMemberRoles(game, c.server.room.Members)
-
-		if err := c.server.sendDrawStartEvent(); err != nil {
+			game.AddOdai(Id, model.OdaiTitle(random.OdaiExample()))
+		}
+
+		if err := c.server.transitLocked(model.GameStatusDraw); err != nil {
 			return c.server.sendEventErr(err, oapi.WsEventDRAWSTART)
 		}
 	}
@@ -346,15 +654,18 @@ func (c *Client) sendOdaiSendEvent(body interface{}) error {
 
 // DRAW_READY
 // 絵が書き終わっていることを通知する (ルームの各員 -> サーバー)
-func (c *Client) sendDrawReadyEvent(_ interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusDraw) {
-		return errWrongPhase
+func (c *Client) sendDrawReadyEvent(_ json.RawMessage) error {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	if err := c.server.checkPhaseInput(model.GameStatusDraw); err != nil {
+		return err
 	}
 
 	c.server.room.Game.AddReady(c.userId)
 
 	if c.server.allMembersAreReady() {
-		if err := c.server.sendDrawFinishEvent(); err != nil {
+		if err := c.server.finishPhaseLocked(model.GameStatusDraw); err != nil {
 			return c.server.sendEventErr(err, oapi.WsEventDRAWFINISH)
 		}
 	} else {
@@ -368,9 +679,12 @@ func (c *Client) sendDrawReadyEvent(_ interface{}) error {
 
 // DRAW_CANCEL
 // 絵が書き終わっている通知を解除する (ルームの各員 -> サーバー)
-func (c *Client) sendDrawCancelEvent(_ interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusDraw) {
-		return errWrongPhase
+func (c *Client) sendDrawCancelEvent(_ json.RawMessage) error {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	if err := c.server.checkPhaseInput(model.GameStatusDraw); err != nil {
+		return err
 	}
 
 	c.server.room.Game.CancelReady(c.userId)
@@ -386,32 +700,59 @@ func (c *Client) sendDrawCancelEvent(_ interface{}) error {
 // 絵を送信する (ルームの各員 -> サーバー)
 // お題が残っていたら再度DRAW_START が送信される
 // お題がすべて終わったらANSWERフェーズを開始する
-func (c *Client) sendDrawSendEvent(body interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusDraw) {
-		return errWrongPhase
-	}
-
-	if body == nil {
-		return errNilBody
+func (c *Client) sendDrawSendEvent(body json.RawMessage) error {
+	c.server.mux.Lock()
+	if err := c.server.checkPhaseInput(model.GameStatusDraw); err != nil {
+		c.server.mux.Unlock()
+		return err
 	}
+	seq := c.server.phaseSeq
+	boardName := c.server.room.Game.Canvas.BoardName
+	c.server.mux.Unlock()
 
 	e := new(oapi.WsDrawSendEventBody)
-	if err := mapstructure.Decode(body, e); err != nil {
+	if err := decodeBody(body, e); err != nil {
 		return fmt.Errorf("failed to decode body: %w", err)
 	}
 
+	// 画像のデコードは重いので，ロックを取る前に済ませる
+	sendImg, err := canvas.DecodeDrawing(e.Img, boardName)
+	if err != nil {
+		return fmt.Errorf("failed to decode drawing: %w", err)
+	}
+
+	// 締め切り後のタイマーがフェーズを進めている間に書き込まないように，遷移までロックを取る
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	// デコードしている間に一時停止したときは受け付けない
+	if c.server.room.Game.Paused {
+		return errGamePaused
+	}
+
+	// デコードしている間に次のターンに進んだときと，前のターンの絵が遅れて届いたときは捨てる
+	if c.server.phaseSeq != seq || (e.DrawPhaseNum != nil && *e.DrawPhaseNum != c.server.drawPhaseNum()) {
+		return errStaleDrawing
+	}
+
+	if c.server.room.Game.Mode == model.GameModeRelay {
+		return c.receiveRelayDrawing(sendImg)
+	}
+
 	for _, v := range c.server.room.Game.Odais {
 		if v.DrawerSeq[c.server.room.Game.DrawCount].UserId == c.userId {
-			sendImg := e.Img[strings.IndexByte(e.Img, ',')+1:]
-			if len(v.Img) > 0 {
-				newImg, err := canvas.MergeImage(string(v.Img), sendImg)
-				if err != nil {
-					v.Img = model.Img(sendImg)
-					return fmt.Errorf("failed to merge image: %w", err)
-				}
-				v.Img = model.Img(newImg)
+			// マスクで定義されたボードでは，エリアの外に描いた部分を切り抜く
+			areaId := v.DrawerSeq[c.server.room.Game.DrawCount].AreaId.Int()
+			sendImg, err = canvas.ClipArea(sendImg, boardName, areaId)
+			if err != nil {
+				return fmt.Errorf("failed to clip image: %w", err)
+			}
+
+			sendImg = canvas.Quantize(sendImg, c.server.paletteOf(c.userId))
+			if v.Img == nil {
+				v.Img = model.NewRaster(sendImg)
 			} else {
-				v.Img = model.Img(sendImg)
+				v.Img.Draw(sendImg)
 			}
 			v.ImgUpdated = true
 			break
@@ -431,21 +772,13 @@ func (c *Client) sendDrawSendEvent(body interface{}) error {
 		}
 	}
 
-	game := c.server.room.Game
 	if allImgUpdated {
-		game.ResetReady()
-		if game.DrawCount.Int()+1 < c.server.room.AllDrawPhase() {
-			game.DrawCount++
-
-			game.ResetImgUpdated()
-
-			if err := c.server.sendDrawStartEvent(); err != nil {
+		if c.server.nextOfDrawPhase() == model.GameStatusDraw {
+			if err := c.server.transitLocked(model.GameStatusDraw); err != nil {
 				return c.server.sendEventErr(err, oapi.WsEventDRAWSTART)
 			}
 		} else {
-			game.Status = model.GameStatusAnswer
-
-			if err := c.server.sendAnswerStartEvent(); err != nil {
+			if err := c.server.transitLocked(model.GameStatusAnswer); err != nil {
 				return c.server.sendEventErr(err, oapi.WsEventANSWERSTART)
 			}
 		}
@@ -456,15 +789,18 @@ func (c *Client) sendDrawSendEvent(body interface{}) error {
 
 // ANSWER_READY
 // 回答の入力が完了していることを通知する (ルームの各員 -> サーバー)
-func (c *Client) sendAnswerReadyEvent(_ interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusAnswer) {
-		return errWrongPhase
+func (c *Client) sendAnswerReadyEvent(_ json.RawMessage) error {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	if err := c.server.checkPhaseInput(model.GameStatusAnswer); err != nil {
+		return err
 	}
 
 	c.server.room.Game.AddReady(c.userId)
 
 	if c.server.allMembersAreReady() {
-		if err := c.server.sendAnswerFinishEvent(); err != nil {
+		if err := c.server.finishPhaseLocked(model.GameStatusAnswer); err != nil {
 			return c.server.sendEventErr(err, oapi.WsEventANSWERFINISH)
 		}
 	} else {
@@ -478,9 +814,12 @@ func (c *Client) sendAnswerReadyEvent(_ interface{}) error {
 
 // ANSWER_CANCEL
 // 回答の入力の完了を解除する (ルームの各員 -> サーバー)
-func (c *Client) sendAnswerCancelEvent(_ interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusAnswer) {
-		return errWrongPhase
+func (c *Client) sendAnswerCancelEvent(_ json.RawMessage) error {
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	if err := c.server.checkPhaseInput(model.GameStatusAnswer); err != nil {
+		return err
 	}
 
 	c.server.room.Game.CancelReady(c.userId)
@@ -495,21 +834,23 @@ func (c *Client) sendAnswerCancelEvent(_ interface{}) error {
 // ANSWER_SEND
 // 回答を送信する (ルームの各員 -> サーバー)
 // SHOWフェーズを開始する
-func (c *Client) sendAnswerSendEvent(body interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusAnswer) {
-		return errWrongPhase
+func (c *Client) sendAnswerSendEvent(body json.RawMessage) error {
+	e := new(oapi.WsAnswerSendEventBody)
+	if err := decodeBody(body, e); err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
 	}
 
-	if body == nil {
-		return errNilBody
-	}
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
 
-	e := new(oapi.WsAnswerSendEventBody)
-	if err := mapstructure.Decode(body, e); err != nil {
-		return fmt.Errorf("failed to decode body: %w", err)
+	if err := c.server.checkPhaseInput(model.GameStatusAnswer); err != nil {
+		return err
 	}
 
 	game := c.server.room.Game
+	if game.Mode == model.GameModeRelay {
+		return c.receiveRelayAnswer(e)
+	}
 
 	for _, v := range game.Odais {
 		if v.AnswererId == c.userId {
@@ -533,9 +874,7 @@ func (c *Client) sendAnswerSendEvent(body interface{}) error {
 	}
 
 	if allAnswersendd {
-		game.Status = model.GameStatusShow
-
-		if err := c.server.sendShowStartEvent(); err != nil {
+		if err := c.server.transitLocked(model.GameStatusShow); err != nil {
 			return c.server.sendEventErr(err, oapi.WsEventSHOWSTART)
 		}
 	}
@@ -545,16 +884,23 @@ func (c *Client) sendAnswerSendEvent(body interface{}) error {
 
 // SHOW_NEXT
 // つぎの結果表示を要求する (ホスト -> サーバー)
-func (c *Client) sendShowNextEvent(_ interface{}) error {
-	if !c.server.room.GameStatusIs(model.GameStatusShow) {
-		return errWrongPhase
-	}
-
+func (c *Client) sendShowNextEvent(_ json.RawMessage) error {
 	if c.userId != c.server.room.HostId {
 		return errUnAuthorized
 	}
 
+	// 次のラウンドへのタイマーと同じゲームの状態を書き換えるので，ロックを取る
+	c.server.mux.Lock()
+	defer c.server.mux.Unlock()
+
+	if !c.server.room.GameStatusIs(model.GameStatusShow) {
+		return errWrongPhase
+	}
+
 	game := c.server.room.Game
+	if game.Mode == model.GameModeRelay {
+		return c.server.showNextRelayStep()
+	}
 
 	switch game.NextShowPhase {
 	case model.GameShowPhaseOdai:
@@ -577,6 +923,12 @@ func (c *Client) sendShowNextEvent(_ interface{}) error {
 			game.NextShowPhase = model.GameShowPhaseEnd
 		}
 		game.ShowCount++
+		if err := c.server.sendTeamStandingsEvent(); err != nil {
+			logger.Echo.Error(c.server.sendEventErr(err, oapi.WsEventTEAMSTANDINGS))
+		}
+		if game.NextShowPhase == model.GameShowPhaseEnd {
+			c.server.finishShowLocked()
+		}
 	case model.GameShowPhaseEnd:
 	default:
 		return errUnknownPhase
@@ -587,7 +939,7 @@ func (c *Client) sendShowNextEvent(_ interface{}) error {
 
 // RETURN_ROOM
 // ルーム(新規加入待機状態) に戻る (ホスト -> サーバー)
-func (c *Client) sendReturnRoomEvent(_ interface{}) error {
+func (c *Client) sendReturnRoomEvent(_ json.RawMessage) error {
 	if !c.server.room.GameStatusIs(model.GameStatusShow) {
 		return errWrongPhase
 	}
@@ -596,7 +948,7 @@ func (c *Client) sendReturnRoomEvent(_ interface{}) error {
 		return errUnAuthorized
 	}
 
-	if err := c.server.sendNextRoomEvent(); err != nil {
+	if err := c.server.transit(model.GameStatusRoom); err != nil {
 		logger.Echo.Error(c.server.sendEventErr(err, oapi.WsEventNEXTROOM))
 	}
 
@@ -0,0 +1,259 @@
+package ws
+
+import (
+	"errors"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+)
+
+func TestDrawSendAfterCompletion(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	guest := newTestClient(t, h, joinTestRoom(t, h, room, "guest"))
+
+	if err := request(t, host, oapi.WsEventREQUESTGAMESTART, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range []*Client{host, guest} {
+		if err := request(t, c, oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{Odai: []string{"ねこ", "いぬ"}[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, game := host.server, room.Game
+	if !room.GameStatusIs(model.GameStatusDraw) || game.DrawCount != 0 {
+		t.Fatalf("game is %s at turn %d, want the first DRAW turn", game.Status, game.DrawCount)
+	}
+
+	// 誰も絵を送らないまま，締め切り後のタイマーが次のターンに進める
+	s.mux.Lock()
+	err := s.transitLocked(s.phase(model.GameStatusDraw).complete())
+	s.mux.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if game.DrawCount != 1 {
+		t.Fatalf("turn = %d after completion, want 1", game.DrawCount)
+	}
+
+	// 前のターンの絵が遅れて届く
+	img := testDrawing(t, game.Canvas.BoardName)
+	stale := 0
+	err = request(t, guest, oapi.WsEventDRAWSEND, &oapi.WsDrawSendEventBody{Img: img, DrawPhaseNum: &stale})
+	if !errors.Is(err, errStaleDrawing) {
+		t.Fatalf("late DRAW_SEND error = %v, want %v", err, errStaleDrawing)
+	}
+	for _, o := range game.Odais {
+		if o.ImgUpdated || !o.Img.IsEmpty() {
+			t.Errorf("odai %q is drawn by the late drawing", o.Title)
+		}
+	}
+
+	// 今のターンの絵は受け付けて，全員が送るまで次のターンに進まない
+	cur := 1
+	if err := request(t, guest, oapi.WsEventDRAWSEND, &oapi.WsDrawSendEventBody{Img: img, DrawPhaseNum: &cur}); err != nil {
+		t.Fatalf("DRAW_SEND error = %v", err)
+	}
+	if game.DrawCount != 1 {
+		t.Errorf("turn = %d after a drawing of 2 members, want 1", game.DrawCount)
+	}
+
+	updated := 0
+	for _, o := range game.Odais {
+		if o.ImgUpdated {
+			updated++
+		}
+	}
+	if updated != 1 {
+		t.Errorf("%d odais are drawn, want 1", updated)
+	}
+}
+
+func TestRoomSetOptionSeed(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	newTestClient(t, h, joinTestRoom(t, h, room, "guest"))
+
+	seed := int64(42)
+	if err := request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{Seed: &seed}); err != nil {
+		t.Fatal(err)
+	}
+	if room.Game.Seed != seed {
+		t.Fatalf("seed = %d, want %d", room.Game.Seed, seed)
+	}
+
+	// 次のラウンドのシードも最初のシードから決まる
+	room.Game.NextRound()
+	next := room.Game.Seed
+
+	other := model.InitGame()
+	other.Seed = seed
+	other.NextRound()
+	if next == seed || other.Seed != next {
+		t.Errorf("seed of the next round = %d, want %d derived from %d", next, other.Seed, seed)
+	}
+}
+
+func TestRoomSetOptionRejected(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	host.features = newFeatureSet([]oapi.WsFeature{oapi.WsFeatureRelayMode})
+
+	game := room.Game
+	timeLimit, mode, board := game.TimeLimit, game.Mode, game.Canvas.BoardName
+
+	// 後ろのフィールドが不正なときは，前のフィールドも設定しない
+	newTimeLimit := int(timeLimit) + 10
+	relay := oapi.GameModeRelay
+	err := request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{
+		TimeLimit: &newTimeLimit,
+		GameMode:  &relay,
+		BoardName: &board,
+	})
+	if !errors.Is(err, errBoardInRelayMode) {
+		t.Fatalf("ROOM_SET_OPTION error = %v, want %v", err, errBoardInRelayMode)
+	}
+
+	if game.TimeLimit != timeLimit || game.Mode != mode || game.Canvas.BoardName != board {
+		t.Errorf("option = {timeLimit: %d, mode: %v, board: %s} after the rejection, want {%d, %v, %s}",
+			game.TimeLimit, game.Mode, game.Canvas.BoardName, timeLimit, mode, board)
+	}
+}
+
+func TestRelayNeedsThreeMembers(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	guest := newTestClient(t, h, joinTestRoom(t, h, room, "guest"))
+	for _, c := range []*Client{host, guest} {
+		c.features = newFeatureSet([]oapi.WsFeature{oapi.WsFeatureRelayMode})
+	}
+
+	relay := oapi.GameModeRelay
+	if err := request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{GameMode: &relay}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 2人では回答するステップがない
+	if err := request(t, host, oapi.WsEventREQUESTGAMESTART, struct{}{}); !errors.Is(err, errNotEnoughMember) {
+		t.Fatalf("REQUEST_GAME_START error = %v with 2 members, want %v", err, errNotEnoughMember)
+	}
+
+	third := newTestClient(t, h, joinTestRoom(t, h, room, "third"))
+	third.features = newFeatureSet([]oapi.WsFeature{oapi.WsFeatureRelayMode})
+	if err := request(t, host, oapi.WsEventREQUESTGAMESTART, struct{}{}); err != nil {
+		t.Fatalf("REQUEST_GAME_START error = %v with 3 members", err)
+	}
+}
+
+func TestAreaOrderOnMaskBoard(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	host.features = newFeatureSet([]oapi.WsFeature{oapi.WsFeatureBoards})
+
+	game := room.Game
+	hex, grow, random := "hex19", oapi.AreaOrderGrow, oapi.AreaOrderRandom
+
+	// マスクのボードにはエリアの行と列がない
+	err := request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{BoardName: &hex, AreaOrder: &grow})
+	if !errors.Is(err, errAreaOrderOnBoard) {
+		t.Fatalf("ROOM_SET_OPTION error = %v, want %v", err, errAreaOrderOnBoard)
+	}
+	if game.Canvas.BoardName == hex || game.AreaOrder != model.AreaOrderRandom {
+		t.Errorf("option = {board: %s, areaOrder: %v} after the rejection", game.Canvas.BoardName, game.AreaOrder)
+	}
+
+	// 先に順番を選んでいても，後からマスクのボードは選べない
+	if err := request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{AreaOrder: &grow}); err != nil {
+		t.Fatal(err)
+	}
+	err = request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{BoardName: &hex})
+	if !errors.Is(err, errAreaOrderOnBoard) {
+		t.Fatalf("ROOM_SET_OPTION error = %v, want %v", err, errAreaOrderOnBoard)
+	}
+
+	if err := request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{BoardName: &hex, AreaOrder: &random}); err != nil {
+		t.Fatalf("ROOM_SET_OPTION error = %v with the random order", err)
+	}
+	if game.Canvas.BoardName != hex || game.AreaOrder != model.AreaOrderRandom {
+		t.Errorf("option = {board: %s, areaOrder: %v}, want {%s, random}", game.Canvas.BoardName, game.AreaOrder, hex)
+	}
+}
+
+func TestPhaseInputWhilePaused(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	guest := newTestClient(t, h, joinTestRoom(t, h, room, "guest"))
+	host.features = newFeatureSet([]oapi.WsFeature{oapi.WsFeaturePause})
+
+	if err := request(t, host, oapi.WsEventREQUESTGAMESTART, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := request(t, host, oapi.WsEventGAMEPAUSE, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, event := range []oapi.WsEvent{oapi.WsEventODAIREADY, oapi.WsEventODAICANCEL} {
+		if err := request(t, guest, event, struct{}{}); !errors.Is(err, errGamePaused) {
+			t.Errorf("%s error = %v while paused, want %v", event, err, errGamePaused)
+		}
+	}
+	if err := request(t, guest, oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{Odai: "ねこ"}); !errors.Is(err, errGamePaused) {
+		t.Errorf("ODAI_SEND error = %v while paused, want %v", err, errGamePaused)
+	}
+	if len(room.Game.Odais) != 0 || room.Game.ReadyCount() != 0 {
+		t.Errorf("%d odais and %d ready members while paused, want none", len(room.Game.Odais), room.Game.ReadyCount())
+	}
+
+	if err := request(t, host, oapi.WsEventGAMERESUME, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := request(t, guest, oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{Odai: "ねこ"}); err != nil {
+		t.Errorf("ODAI_SEND error = %v after resuming", err)
+	}
+}
+
+func TestPaletteOf(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	guestId := joinTestRoom(t, h, room, "guest")
+	newTestClient(t, h, guestId)
+	host.features = newFeatureSet([]oapi.WsFeature{oapi.WsFeaturePalette})
+
+	tests := []struct {
+		palette oapi.Palette
+		// want[i] は i 番目のメンバーの色
+		want []color.Palette
+	}{
+		{palette: oapi.PaletteFree, want: []color.Palette{nil, nil}},
+		{palette: oapi.PaletteMonochrome, want: []color.Palette{canvas.MonochromePalette, canvas.MonochromePalette}},
+		{palette: oapi.PaletteFour, want: []color.Palette{canvas.FourColorPalette, canvas.FourColorPalette}},
+		{palette: oapi.PalettePlayer, want: []color.Palette{canvas.PlayerPalette(0), canvas.PlayerPalette(1)}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.palette), func(t *testing.T) {
+			palette := tt.palette
+			if err := request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{Palette: &palette}); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, uid := range []model.UserId{room.HostId, guestId} {
+				if got := host.server.paletteOf(uid); !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("paletteOf(member %d) = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
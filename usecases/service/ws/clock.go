@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+)
+
+// Upper limit of the time waited for slow clients after the deadline of a phase.
+const maxFinishGrace = 2 * time.Second
+
+// pingPayload is the payload of the pings, which carries the time it was sent.
+func pingPayload() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+}
+
+// observePong updates the round trip time of the connection with a pong.
+// 急な揺れに引きずられないように，指数移動平均をとる
+func (c *Client) observePong(payload string) {
+	sent, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return
+	}
+
+	// 未来の時刻や，読み込みの期限 (pongWait) より前に送ったはずのない時刻は壊れているので捨てる
+	rtt := time.Since(time.Unix(0, sent))
+	if rtt < 0 || pongWait < rtt {
+		return
+	}
+
+	if old := c.rtt.Load(); old > 0 {
+		rtt = (time.Duration(old)*7 + rtt) / 8
+	}
+	c.rtt.Store(int64(rtt))
+}
+
+// RTT returns the round trip time of the connection, or 0 if it has not been measured.
+// 別のインスタンスにつながっているクライアントやボットは測れないので 0
+func (c *Client) RTT() time.Duration {
+	return time.Duration(c.rtt.Load())
+}
+
+// finishGrace is the time waited after the deadline before forcing FINISH.
+// 最も遅いメンバーの片道の時間だけ待つ
+func (s *Server) finishGrace() time.Duration {
+	var grace time.Duration
+	for _, m := range s.room.Members {
+		if c, ok := s.hub.userIdToClient.Load(m.Id); ok && grace < c.RTT()/2 {
+			grace = c.RTT() / 2
+		}
+	}
+
+	if maxFinishGrace < grace {
+		return maxFinishGrace
+	}
+
+	return grace
+}
+
+// REQUEST_CLOCK_SYNC
+// サーバーとの時計のずれを測る (ルームの各員 -> サーバー)
+// ルームの状態によらないので，別のインスタンスのルームでもオーナーに転送せずに返す
+func (c *Client) sendRequestClockSyncEvent(body json.RawMessage) error {
+	e := new(oapi.WsRequestClockSyncEventBody)
+	if err := decodeBody(body, e); err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	res := &oapi.WsClockSyncEventBody{
+		ClientTime: e.ClientTime,
+		ServerTime: time.Now().UnixMilli(),
+	}
+
+	if rtt := c.RTT(); rtt > 0 {
+		ms := int(rtt / time.Millisecond)
+		res.Rtt = &ms
+	}
+
+	c.push(&oapi.WsSendMessage{
+		Type: oapi.WsEventCLOCKSYNC,
+		Body: res,
+	})
+
+	return nil
+}
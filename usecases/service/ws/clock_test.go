@@ -0,0 +1,123 @@
+package ws
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
+	"github.com/21hack02win/nascalay-backend/oapi"
+)
+
+// pongOf returns the payload of a pong for the ping sent ago.
+func pongOf(ago time.Duration) string {
+	return strconv.FormatInt(time.Now().Add(-ago).UnixNano(), 10)
+}
+
+func TestObservePong(t *testing.T) {
+	// 測るまでの処理にかかる時間の分だけ長くなるのを許す
+	const slack = 50 * time.Millisecond
+
+	steps := []struct {
+		name    string
+		payload string
+		want    time.Duration
+	}{
+		{name: "first pong", payload: pongOf(100 * time.Millisecond), want: 100 * time.Millisecond},
+		{name: "slow pong is smoothed", payload: pongOf(900 * time.Millisecond), want: 200 * time.Millisecond},
+		{name: "not a number", payload: "ping", want: 200 * time.Millisecond},
+		{name: "empty", payload: "", want: 200 * time.Millisecond},
+		{name: "future", payload: pongOf(-time.Minute), want: 200 * time.Millisecond},
+		{name: "older than the read deadline", payload: pongOf(2 * pongWait), want: 200 * time.Millisecond},
+		{name: "fast pong is smoothed", payload: pongOf(0), want: 175 * time.Millisecond},
+	}
+
+	c := &Client{}
+	for _, tt := range steps {
+		c.observePong(tt.payload)
+		if got := c.RTT(); got < tt.want || tt.want+slack < got {
+			t.Fatalf("%s: RTT() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFinishGrace(t *testing.T) {
+	tests := []struct {
+		name string
+		rtts []time.Duration
+		want time.Duration
+	}{
+		{name: "not measured", rtts: []time.Duration{0, 0}, want: 0},
+		{name: "slowest member", rtts: []time.Duration{100 * time.Millisecond, 300 * time.Millisecond}, want: 150 * time.Millisecond},
+		{name: "at the cap", rtts: []time.Duration{2 * maxFinishGrace, 0}, want: maxFinishGrace},
+		{name: "over the cap", rtts: []time.Duration{time.Minute, 10 * time.Second}, want: maxFinishGrace},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHub(t, broker.NewLocalBroker())
+			room := newTestRoom(t, h)
+			host := newTestClient(t, h, room.HostId)
+			guest := newTestClient(t, h, joinTestRoom(t, h, room, "guest"))
+			// 接続していないメンバーは数えない
+			joinTestRoom(t, h, room, "offline")
+
+			for i, c := range []*Client{host, guest} {
+				c.rtt.Store(int64(tt.rtts[i]))
+			}
+
+			if got := host.server.finishGrace(); got != tt.want {
+				t.Errorf("finishGrace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClockSync(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host, msgs := newRecordingClient(t, h, room.HostId)
+
+	sync := func() *oapi.WsClockSyncEventBody {
+		t.Helper()
+
+		clientTime := time.Now().Add(-time.Hour).UnixMilli()
+		before := time.Now().UnixMilli()
+		if err := request(t, host, oapi.WsEventREQUESTCLOCKSYNC, &oapi.WsRequestClockSyncEventBody{ClientTime: clientTime}); err != nil {
+			t.Fatal(err)
+		}
+		after := time.Now().UnixMilli()
+
+		for {
+			select {
+			case msg := <-msgs:
+				if msg.Type != oapi.WsEventCLOCKSYNC {
+					continue
+				}
+
+				body := new(oapi.WsClockSyncEventBody)
+				if err := convertBody(msg.Body, body); err != nil {
+					t.Fatal(err)
+				}
+				if body.ClientTime != clientTime {
+					t.Errorf("clientTime = %d, want %d sent by the client", body.ClientTime, clientTime)
+				}
+				if body.ServerTime < before || after < body.ServerTime {
+					t.Errorf("serverTime = %d, want between %d and %d", body.ServerTime, before, after)
+				}
+
+				return body
+			case <-time.After(time.Second):
+				t.Fatal("CLOCK_SYNC is not sent")
+			}
+		}
+	}
+
+	if body := sync(); body.Rtt != nil {
+		t.Errorf("rtt = %d before measuring, want nothing", *body.Rtt)
+	}
+
+	host.rtt.Store(int64(120 * time.Millisecond))
+	if body := sync(); body.Rtt == nil || *body.Rtt != 120 {
+		t.Errorf("rtt = %v, want 120", body.Rtt)
+	}
+}
@@ -0,0 +1,180 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/msgpack"
+	"github.com/gorilla/websocket"
+)
+
+// codec converts the messages of a connection to and from WebSocket frames.
+type codec interface {
+	// frameType is the type of the frames written by encode.
+	frameType() int
+	encode(msg *oapi.WsSendMessage) ([]byte, error)
+	// encodeBatch encodes the messages as an array in a frame.
+	encodeBatch(msgs []*oapi.WsSendMessage) ([]byte, error)
+	decode(data []byte) (*oapi.WsJSONRequestBody, error)
+}
+
+// imgEvents lists the events whose body has images in imgFields.
+// MessagePack ではデータURLではなく PNG のバイト列をそのまま送る
+var imgEvents = map[oapi.WsEvent]bool{
+	oapi.WsEventDRAWSTART:          true,
+	oapi.WsEventANSWERSTART:        true,
+	oapi.WsEventSHOWCANVAS:         true,
+	oapi.WsEventDRAWSEND:           true,
+	oapi.WsEventROOMSETTEMPLATE:    true,
+	oapi.WsEventROOMUPDATETEMPLATE: true,
+}
+
+var imgFields = []string{"img", "template"}
+
+var errInvalidFrame = errors.New("frame is not a message")
+
+// codecOf returns the codec used to write the messages to the connection.
+func codecOf(features featureSet) codec {
+	if features.has(oapi.WsFeatureMsgpack) {
+		return msgpackCodec{}
+	}
+
+	return jsonCodec{}
+}
+
+// codecOfFrame returns the codec to read a received frame.
+// msgpack が有効でもテキストフレームは JSON として読む
+func (c *Client) codecOfFrame(frameType int) (codec, error) {
+	switch {
+	case frameType == websocket.TextMessage:
+		return jsonCodec{}, nil
+	case frameType == websocket.BinaryMessage && c.supports(oapi.WsFeatureMsgpack):
+		return msgpackCodec{}, nil
+	default:
+		return nil, errUnsupportedFeature
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) frameType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) encode(msg *oapi.WsSendMessage) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonCodec) encodeBatch(msgs []*oapi.WsSendMessage) ([]byte, error) {
+	return json.Marshal(msgs)
+}
+
+func (jsonCodec) decode(data []byte) (*oapi.WsJSONRequestBody, error) {
+	req := new(oapi.WsJSONRequestBody)
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) frameType() int {
+	return websocket.BinaryMessage
+}
+
+func (msgpackCodec) encode(msg *oapi.WsSendMessage) ([]byte, error) {
+	v, err := msgpackValueOf(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) encodeBatch(msgs []*oapi.WsSendMessage) ([]byte, error) {
+	arr := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		v, err := msgpackValueOf(msg)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+
+	return msgpack.Marshal(arr)
+}
+
+// msgpackValueOf converts the message to the value written in MessagePack.
+// ボディの型ごとにエンコードを書かなくて済むように，一度 JSON にしてから変換する
+func msgpackValueOf(msg *oapi.WsSendMessage) (map[string]interface{}, error) {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode as JSON: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var v map[string]interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+
+	if body, ok := v["body"].(map[string]interface{}); ok && imgEvents[msg.Type] {
+		for _, field := range imgFields {
+			if img, ok := body[field].(string); ok && strings.HasPrefix(img, imgPrefix) {
+				b, err := base64.StdEncoding.DecodeString(img[len(imgPrefix):])
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode %s: %w", field, err)
+				}
+				body[field] = b
+			}
+		}
+	}
+
+	return v, nil
+}
+
+func (msgpackCodec) decode(data []byte) (*oapi.WsJSONRequestBody, error) {
+	v, err := msgpack.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, errInvalidFrame
+	}
+
+	typ, ok := m["type"].(string)
+	if !ok {
+		return nil, errInvalidFrame
+	}
+
+	// リクエストの処理は JSON のボディを扱うので，画像をデータURLに戻してから JSON にする
+	body := m["body"]
+	if b, ok := body.(map[string]interface{}); ok && imgEvents[oapi.WsEvent(typ)] {
+		for _, field := range imgFields {
+			if img, ok := b[field].([]byte); ok {
+				b[field] = imgPrefix + base64.StdEncoding.EncodeToString(img)
+			}
+		}
+	}
+
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode body as JSON: %w", err)
+	}
+
+	return &oapi.WsJSONRequestBody{
+		Type: oapi.WsEvent(typ),
+		Body: raw,
+	}, nil
+}
@@ -1,15 +1,91 @@
 package ws
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+)
 
 var (
-	errNilBody          = errors.New("body is nil")
-	errUnAuthorized     = errors.New("unauthorized")
-	errUnknownEventType = errors.New("unknown event type")
-	errWrongPhase       = errors.New("wrong phase")
-	errNotFound         = errors.New("not found")
-	errAlreadyExists    = errors.New("already exists")
-	errUnknownPhase     = errors.New("unknown phase")
-	errInvalidDrawCount = errors.New("invalid draw count")
-	errNotEnoughMember  = errors.New("not enough member")
+	errNilBody            = newError(oapi.ErrorCodeINVALIDBODY, "body is nil")
+	errUnAuthorized       = newError(oapi.ErrorCodeUNAUTHORIZED, "unauthorized")
+	errUnknownEventType   = newError(oapi.ErrorCodeUNKNOWNEVENT, "unknown event type")
+	errWrongPhase         = newError(oapi.ErrorCodeWRONGPHASE, "wrong phase")
+	errNotFound           = newError(oapi.ErrorCodeNOTFOUND, "not found")
+	errAlreadyExists      = newError(oapi.ErrorCodeALREADYEXISTS, "already exists")
+	errDuplicateOdai      = newError(oapi.ErrorCodeDUPLICATEODAI, "duplicate odai")
+	errUnknownPhase       = newError(oapi.ErrorCodeINTERNALERROR, "unknown phase")
+	errInvalidDrawCount   = newError(oapi.ErrorCodeINTERNALERROR, "invalid draw count")
+	errNotEnoughMember    = newError(oapi.ErrorCodeNOTENOUGHMEMBERS, "not enough member")
+	errServerClosing      = newError(oapi.ErrorCodeSERVERCLOSING, "server is closing")
+	errInvalidTransition  = newError(oapi.ErrorCodeWRONGPHASE, "invalid transition")
+	errOdaiNotCollected   = newError(oapi.ErrorCodeINTERNALERROR, "odai not collected")
+	errUnknownGameMode    = newError(oapi.ErrorCodeINVALIDOPTION, "unknown game mode")
+	errInvalidTeamNum     = newError(oapi.ErrorCodeINVALIDOPTION, "invalid team num")
+	errUnbalancedTeams    = newError(oapi.ErrorCodeUNBALANCEDTEAMS, "teams are not balanced")
+	errTeamsInRelayMode   = newError(oapi.ErrorCodeTEAMSINRELAYMODE, "teams are not supported in relay mode")
+	errInvalidRoundNum    = newError(oapi.ErrorCodeINVALIDOPTION, "invalid round num")
+	errInvalidFogRadius   = newError(oapi.ErrorCodeINVALIDOPTION, "invalid fog radius")
+	errUnknownAreaOrder   = newError(oapi.ErrorCodeINVALIDOPTION, "unknown area order")
+	errAreaOrderOnBoard   = newError(oapi.ErrorCodeINVALIDOPTION, "area order is not supported on the board")
+	errUnknownPalette     = newError(oapi.ErrorCodeINVALIDOPTION, "unknown palette")
+	errUnknownBoard       = newError(oapi.ErrorCodeINVALIDOPTION, "unknown board")
+	errBoardInRelayMode   = newError(oapi.ErrorCodeINVALIDOPTION, "board cannot be changed in relay mode")
+	errNoRoundsLeft       = newError(oapi.ErrorCodeWRONGPHASE, "no rounds left")
+	errRoundsRemaining    = newError(oapi.ErrorCodeROUNDSREMAINING, "rounds remaining")
+	errInvalidBody        = newError(oapi.ErrorCodeINVALIDBODY, "body is not a JSON object")
+	errRequiredField      = newError(oapi.ErrorCodeINVALIDBODY, "required")
+	errInvalidFieldType   = newError(oapi.ErrorCodeINVALIDBODY, "invalid type")
+	errTooLong            = newError(oapi.ErrorCodeINVALIDBODY, "too long")
+	errInvalidTimeLimit   = newError(oapi.ErrorCodeINVALIDOPTION, "invalid time limit")
+	errInvalidDataURL     = newError(oapi.ErrorCodeINVALIDBODY, "invalid data URL")
+	errUnsupportedFeature = newError(oapi.ErrorCodeUNSUPPORTEDFEATURE, "unsupported feature")
+	errGamePaused         = newError(oapi.ErrorCodeGAMEPAUSED, "game is paused")
+	errNotPaused          = newError(oapi.ErrorCodeWRONGPHASE, "game is not paused")
+	errStaleDrawing       = newError(oapi.ErrorCodeWRONGPHASE, "drawing for a finished turn")
+	errInvalidSignature   = newError(oapi.ErrorCodeINVALIDIMAGEURL, "invalid signature")
+	errImageExpired       = newError(oapi.ErrorCodeINVALIDIMAGEURL, "image URL is expired")
 )
+
+// codedError is an error with the code sent to the clients in the ERROR event.
+type codedError struct {
+	code oapi.ErrorCode
+	msg  string
+}
+
+func newError(code oapi.ErrorCode, msg string) error {
+	return &codedError{code: code, msg: msg}
+}
+
+func (e *codedError) Error() string {
+	return e.msg
+}
+
+// ErrorCodeOf returns the code of the error for the clients.
+// 外側でラップしたエラーのコードを優先する
+func ErrorCodeOf(err error) oapi.ErrorCode {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return oapi.ErrorCodeNOTFOUND
+	case errors.Is(err, repository.ErrAlreadyExists):
+		return oapi.ErrorCodeALREADYEXISTS
+	case errors.Is(err, repository.ErrForbidden):
+		// 参加できないのはルームが満員のときだけ
+		return oapi.ErrorCodeROOMFULL
+	case errors.Is(err, canvas.ErrInvalidImage):
+		return oapi.ErrorCodeINVALIDIMAGE
+	case errors.Is(err, canvas.ErrUnsupportedFormat):
+		return oapi.ErrorCodeUNSUPPORTEDIMAGEFORMAT
+	case errors.Is(err, canvas.ErrImageTooLarge):
+		return oapi.ErrorCodeIMAGETOOLARGE
+	default:
+		return oapi.ErrorCodeINTERNALERROR
+	}
+}
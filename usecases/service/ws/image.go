@@ -0,0 +1,174 @@
+package ws
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/usecases/storage"
+	"github.com/21hack02win/nascalay-backend/util/logger"
+)
+
+// imageURLLifetime is how long the URLs of the images sent to the clients are valid.
+// 有効期限を分単位に切り上げるので，同じ画像には同じ分のうちは同じURLを返し，CDNでキャッシュできる
+const (
+	imageURLLifetime = 10 * time.Minute
+	imageURLRounding = time.Minute
+)
+
+// ImageOptions configures the URLs of the images sent to the clients which enabled the imageUrls feature.
+type ImageOptions struct {
+	Store storage.ImageStore
+	// Secret signs the URLs. A random one is used if empty, so the instances sharing rooms need the same one.
+	Secret []byte
+	// BaseURL is put before "/images/{imageKey}" .e.g "https://api.example.com/api" or "/api"
+	BaseURL string
+}
+
+// imageLinker saves the images and signs their URLs.
+type imageLinker struct {
+	store   storage.ImageStore
+	secret  []byte
+	baseURL string
+}
+
+func newImageLinker(opts ImageOptions) (*imageLinker, error) {
+	secret := opts.Secret
+	if len(secret) == 0 {
+		secret = make([]byte, sha256.Size)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate image secret: %w", err)
+		}
+	}
+
+	return &imageLinker{
+		store:   opts.Store,
+		secret:  secret,
+		baseURL: strings.TrimSuffix(opts.BaseURL, "/"),
+	}, nil
+}
+
+func (l *imageLinker) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(key + "." + strconv.FormatInt(expires, 10)))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// link saves the image of the data URL and returns the signed URL of it.
+// データURLでないものと空の画像はそのまま返す
+func (l *imageLinker) link(dataURL string, now time.Time) (string, error) {
+	if !strings.HasPrefix(dataURL, imgPrefix) || len(dataURL) == len(imgPrefix) {
+		return dataURL, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(dataURL[len(imgPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	key, err := l.store.Put(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to save image: %w", err)
+	}
+
+	expires := now.Add(imageURLLifetime + imageURLRounding - 1).Truncate(imageURLRounding).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("signature", l.sign(key, expires))
+
+	return l.baseURL + "/images/" + key + "?" + q.Encode(), nil
+}
+
+// Image returns the image of the signed URL sent to a client.
+func (h *Hub) Image(key string, expires int64, signature string) ([]byte, error) {
+	if !hmac.Equal([]byte(signature), []byte(h.images.sign(key, expires))) {
+		return nil, errInvalidSignature
+	}
+
+	if time.Now().Unix() > expires {
+		return nil, errImageExpired
+	}
+
+	return h.images.store.Get(key)
+}
+
+// imageLinks is a message sent to the clients with and without the imageUrls feature.
+// 画像の保存と署名は最初に必要になったときに一度だけ行い，宛先の間で使い回す
+type imageLinks struct {
+	msg    *oapi.WsSendMessage
+	linked func() *oapi.WsSendMessage
+}
+
+func (h *Hub) imageLinksOf(msg *oapi.WsSendMessage) *imageLinks {
+	return &imageLinks{
+		msg:    msg,
+		linked: sync.OnceValue(func() *oapi.WsSendMessage { return h.linkImages(msg) }),
+	}
+}
+
+// messageFor returns the message sent to the client.
+func (l *imageLinks) messageFor(c *Client) *oapi.WsSendMessage {
+	if !c.supports(oapi.WsFeatureImageUrls) || !imgEvents[l.msg.Type] {
+		return l.msg
+	}
+
+	return l.linked()
+}
+
+// linkImages replaces the data URLs of the images in the message with the signed URLs.
+// 保存に失敗した画像はデータURLのまま送る
+func (h *Hub) linkImages(msg *oapi.WsSendMessage) *oapi.WsSendMessage {
+	now := time.Now()
+	link := func(img string) string {
+		u, err := h.images.link(img, now)
+		if err != nil {
+			logger.Echo.Error(err.Error())
+			return img
+		}
+
+		return u
+	}
+	linkPtr := func(img *string) *string {
+		if img == nil {
+			return nil
+		}
+
+		u := link(*img)
+		return &u
+	}
+
+	// ボディはURLを使わないクライアントにも送るので，書き換えずにコピーする
+	var body interface{}
+	switch b := msg.Body.(type) {
+	case oapi.WsDrawStartEventBody:
+		b.Img, b.Template = link(b.Img), linkPtr(b.Template)
+		body = b
+	case oapi.WsAnswerStartEventBody:
+		b.Img, b.Template = link(b.Img), linkPtr(b.Template)
+		body = b
+	case *oapi.WsShowCanvasEventBody:
+		cp := *b
+		cp.Img, cp.Template = link(b.Img), linkPtr(b.Template)
+		body = &cp
+	case *oapi.WsRoomUpdateTemplateEventBody:
+		cp := *b
+		cp.Img = link(b.Img)
+		body = &cp
+	default:
+		return msg
+	}
+
+	return &oapi.WsSendMessage{
+		Type: msg.Type,
+		Body: body,
+	}
+}
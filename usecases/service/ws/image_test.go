@@ -0,0 +1,56 @@
+package ws
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
+	"github.com/21hack02win/nascalay-backend/interfaces/repository"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/usecases/storage"
+)
+
+// countingStore is an ImageStore which counts the images saved.
+type countingStore struct {
+	mu   sync.Mutex
+	puts int
+}
+
+func (s *countingStore) Put(data []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.puts++
+
+	return storage.KeyOf(data), nil
+}
+
+func (s *countingStore) Get(_ string) ([]byte, error) {
+	return nil, storage.ErrNotFound
+}
+
+func TestImagesLinkedOncePerMessage(t *testing.T) {
+	store := new(countingStore)
+	h, err := InitHub(repository.NewRepository(), broker.NewLocalBroker(), 0, ImageOptions{Store: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	room := newTestRoom(t, h)
+	clients := []*Client{newTestClient(t, h, room.HostId)}
+	for _, name := range []string{"guest1", "guest2"} {
+		clients = append(clients, newTestClient(t, h, joinTestRoom(t, h, room, name)))
+	}
+	for _, c := range clients {
+		c.features = newFeatureSet([]oapi.WsFeature{oapi.WsFeatureImageUrls})
+	}
+
+	clients[0].server.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+		Type: oapi.WsEventSHOWCANVAS,
+		Body: &oapi.WsShowCanvasEventBody{Img: testDrawing(t, room.Game.Canvas.BoardName)},
+	})
+
+	if store.puts != 1 {
+		t.Errorf("the image is saved %d times for %d clients, want once", store.puts, len(clients))
+	}
+}
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+)
+
+// GAME_PAUSE
+// ゲームを一時停止する (ホスト -> サーバー)
+func (c *Client) sendGamePauseEvent(_ json.RawMessage) error {
+	if c.userId != c.server.room.HostId {
+		return errUnAuthorized
+	}
+
+	return c.server.pause()
+}
+
+// GAME_RESUME
+// 一時停止したゲームを再開する (ホスト -> サーバー)
+func (c *Client) sendGameResumeEvent(_ json.RawMessage) error {
+	if c.userId != c.server.room.HostId {
+		return errUnAuthorized
+	}
+
+	return c.server.resume()
+}
+
+// pause stops the countdown of the current phase and keeps the remaining time.
+// 制限時間のあるフェーズのカウントダウン中だけ一時停止できる
+func (s *Server) pause() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	game := s.room.Game
+	if game.Paused {
+		return errGamePaused
+	}
+
+	if !game.Status.HasTimeLimit() || !s.counting {
+		return errWrongPhase
+	}
+
+	remaining := time.Until(time.Time(game.Timeout))
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	s.stopPhaseTimer()
+	game.Paused = true
+	game.Remaining = remaining
+
+	return s.sendGameUpdatePauseEvent()
+}
+
+// resume restarts the countdown with the remaining time.
+func (s *Server) resume() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	game := s.room.Game
+	if !game.Paused {
+		return errNotPaused
+	}
+
+	game.Paused = false
+	s.startCountdown(game.Remaining)
+
+	return s.sendGameUpdatePauseEvent()
+}
+
+// GAME_UPDATE_PAUSE
+// ゲームの一時停止と再開を通知する (サーバー -> ルーム全員)
+func (s *Server) sendGameUpdatePauseEvent() error {
+	game := s.room.Game
+	body := &oapi.WsGameUpdatePauseEventBody{
+		Paused:    game.Paused,
+		Remaining: int(game.Remaining / time.Millisecond),
+	}
+
+	if !game.Paused {
+		deadline := time.Time(game.Timeout)
+		body.Deadline = &deadline
+	}
+
+	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+		Type: oapi.WsEventGAMEUPDATEPAUSE,
+		Body: body,
+	})
+
+	return nil
+}
+
+// checkPhaseInput rejects the inputs of the phase while the game is in another phase or paused.
+// 一時停止と入力が入れ違わないように，s.mux を取ってから呼ぶ
+func (s *Server) checkPhaseInput(status model.GameStatus) error {
+	if s.room.Game.Paused {
+		return errGamePaused
+	}
+
+	if !s.room.GameStatusIs(status) {
+		return errWrongPhase
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package ws
+
+import (
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+)
+
+// Versions of the WebSocket protocol.
+// 1: 最初のバージョン (機能のネゴシエーションなし)
+// 2: 接続時に機能をネゴシエーションする
+const (
+	ProtocolVersion       = 2
+	legacyProtocolVersion = 1
+)
+
+// ServerVersion is sent to the clients in WELCOME_NEW_CLIENT.
+// ビルド時に -ldflags "-X github.com/21hack02win/nascalay-backend/usecases/service/ws.ServerVersion=v1.2.0" で指定する
+var ServerVersion = ""
+
+// Handshake is what a client announces when it connects.
+type Handshake struct {
+	ProtocolVersion int
+	Features        []oapi.WsFeature
+}
+
+// supportedFeatures lists the features which this server can enable.
+var supportedFeatures = []oapi.WsFeature{
+	oapi.WsFeatureCompression,
+	oapi.WsFeatureRelayMode,
+	oapi.WsFeatureTeamMode,
+	oapi.WsFeatureRounds,
+	oapi.WsFeatureBots,
+	oapi.WsFeatureMsgpack,
+	oapi.WsFeatureBatch,
+	oapi.WsFeaturePause,
+	oapi.WsFeatureBoards,
+	oapi.WsFeatureTemplate,
+	oapi.WsFeaturePalette,
+	oapi.WsFeatureImageUrls,
+}
+
+// eventFeatures maps the events added by a feature to the feature.
+// 機能が有効でないクライアントにはイベントを送らず，リクエストは受け付けない
+var eventFeatures = map[oapi.WsEvent]oapi.WsFeature{
+	oapi.WsEventROOMSETTEAM:        oapi.WsFeatureTeamMode,
+	oapi.WsEventROOMUPDATETEAMS:    oapi.WsFeatureTeamMode,
+	oapi.WsEventTEAMSTANDINGS:      oapi.WsFeatureTeamMode,
+	oapi.WsEventROUNDFINISH:        oapi.WsFeatureRounds,
+	oapi.WsEventROOMADDBOT:         oapi.WsFeatureBots,
+	oapi.WsEventGAMEPAUSE:          oapi.WsFeaturePause,
+	oapi.WsEventGAMERESUME:         oapi.WsFeaturePause,
+	oapi.WsEventGAMEUPDATEPAUSE:    oapi.WsFeaturePause,
+	oapi.WsEventROOMSETTEMPLATE:    oapi.WsFeatureTemplate,
+	oapi.WsEventROOMUPDATETEMPLATE: oapi.WsFeatureTemplate,
+}
+
+// featureSet is the set of the features enabled for a connection.
+type featureSet map[oapi.WsFeature]bool
+
+func newFeatureSet(features []oapi.WsFeature) featureSet {
+	fs := make(featureSet, len(features))
+	for _, f := range features {
+		fs[f] = true
+	}
+
+	return fs
+}
+
+// allFeatures is used for the clients played by the server.
+func allFeatures() featureSet {
+	return newFeatureSet(supportedFeatures)
+}
+
+func (fs featureSet) has(f oapi.WsFeature) bool {
+	return fs[f]
+}
+
+// list returns the features in the order of supportedFeatures.
+func (fs featureSet) list() []oapi.WsFeature {
+	list := make([]oapi.WsFeature, 0, len(fs))
+	for _, f := range supportedFeatures {
+		if fs.has(f) {
+			list = append(list, f)
+		}
+	}
+
+	return list
+}
+
+// negotiate decides the protocol version and the features of the connection.
+// compressed is whether permessage-deflate has been negotiated in the upgrade.
+func negotiate(hs Handshake, compressed bool) (int, featureSet) {
+	version := hs.ProtocolVersion
+	if version < legacyProtocolVersion {
+		version = legacyProtocolVersion
+	}
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+
+	features := make(featureSet)
+	if version < 2 {
+		return version, features
+	}
+
+	supported := allFeatures()
+	for _, f := range hs.Features {
+		if !supported.has(f) {
+			continue
+		}
+
+		// 接続で permessage-deflate が使えないときは圧縮できない
+		if f == oapi.WsFeatureCompression && !compressed {
+			continue
+		}
+
+		features[f] = true
+	}
+
+	return version, features
+}
+
+// offersCompression reports whether the client offers permessage-deflate in the upgrade request.
+// gorilla/websocket と同じく，拡張の名前が一致するものだけを見る
+func offersCompression(r *http.Request) bool {
+	for _, exts := range r.Header.Values("Sec-WebSocket-Extensions") {
+		for _, ext := range strings.Split(exts, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// serverVersion returns ServerVersion or the VCS revision embedded by the go command.
+func serverVersion() string {
+	if len(ServerVersion) > 0 {
+		return ServerVersion
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" && len(s.Value) >= 7 {
+			return s.Value[:7]
+		}
+	}
+
+	return info.Main.Version
+}
+
+// supports reports whether the feature is enabled for the client.
+func (c *Client) supports(f oapi.WsFeature) bool {
+	return c.features.has(f)
+}
+
+// accepts reports whether the event can be sent to the client.
+func (c *Client) accepts(event oapi.WsEvent) bool {
+	f, ok := eventFeatures[event]
+	return !ok || c.supports(f)
+}
+
+// allMembersSupport reports whether all connected members of the room have enabled the feature.
+// 接続していないメンバーがどのクライアントを使うかはわからないので数えない
+func (s *Server) allMembersSupport(f oapi.WsFeature) bool {
+	for _, m := range s.room.Members {
+		if c, ok := s.hub.userIdToClient.Load(m.Id); ok && !c.supports(f) {
+			return false
+		}
+	}
+
+	return true
+}
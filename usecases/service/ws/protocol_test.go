@@ -0,0 +1,100 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/gorilla/websocket"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name        string
+		hs          Handshake
+		compressed  bool
+		wantVersion int
+		want        []oapi.WsFeature
+	}{
+		{
+			name:        "legacy",
+			hs:          Handshake{Features: []oapi.WsFeature{oapi.WsFeatureRelayMode}},
+			wantVersion: legacyProtocolVersion,
+			want:        []oapi.WsFeature{},
+		},
+		{
+			name:        "newer client",
+			hs:          Handshake{ProtocolVersion: ProtocolVersion + 1, Features: []oapi.WsFeature{oapi.WsFeatureRounds}},
+			wantVersion: ProtocolVersion,
+			want:        []oapi.WsFeature{oapi.WsFeatureRounds},
+		},
+		{
+			name:        "unknown feature",
+			hs:          Handshake{ProtocolVersion: ProtocolVersion, Features: []oapi.WsFeature{"telepathy", oapi.WsFeatureBots}},
+			wantVersion: ProtocolVersion,
+			want:        []oapi.WsFeature{oapi.WsFeatureBots},
+		},
+		{
+			name:        "compression negotiated",
+			hs:          Handshake{ProtocolVersion: ProtocolVersion, Features: []oapi.WsFeature{oapi.WsFeatureMsgpack, oapi.WsFeatureCompression}},
+			compressed:  true,
+			wantVersion: ProtocolVersion,
+			want:        []oapi.WsFeature{oapi.WsFeatureCompression, oapi.WsFeatureMsgpack},
+		},
+		{
+			name:        "compression not negotiated",
+			hs:          Handshake{ProtocolVersion: ProtocolVersion, Features: []oapi.WsFeature{oapi.WsFeatureMsgpack, oapi.WsFeatureCompression}},
+			wantVersion: ProtocolVersion,
+			want:        []oapi.WsFeature{oapi.WsFeatureMsgpack},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, features := negotiate(tt.hs, tt.compressed)
+			if version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", version, tt.wantVersion)
+			}
+			if got := features.list(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("features = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestOffersCompression checks that offersCompression agrees with the extensions negotiated by the upgrader.
+func TestOffersCompression(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+
+	offered := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offered <- offersCompression(r)
+		conn, err := h.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	for _, compress := range []bool{true, false} {
+		d := websocket.Dialer{EnableCompression: compress}
+		conn, resp, err := d.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+
+		negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+		if negotiated != compress {
+			t.Errorf("permessage-deflate negotiated = %v for a client offering it = %v", negotiated, compress)
+		}
+		if got := <-offered; got != negotiated {
+			t.Errorf("offersCompression() = %v, want %v", got, negotiated)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package ws
+
+import (
+	"image"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+	"github.com/21hack02win/nascalay-backend/util/logger"
+	"github.com/21hack02win/nascalay-backend/util/random"
+)
+
+// NOTE: リレーモードでは DRAW / ANSWER フェーズを交互に繰り返す
+// game.StepCount 番目のステップが偶数なら DRAW，奇数なら ANSWER フェーズになる
+
+// nextOfRelayStep returns the phase after the current step in the relay mode.
+func (s *Server) nextOfRelayStep() model.GameStatus {
+	next := s.room.Game.StepCount + 1
+	if next.Int() >= s.room.Game.RelayStepNum() {
+		return model.GameStatusShow
+	}
+
+	if next.IsDraw() {
+		return model.GameStatusDraw
+	}
+
+	return model.GameStatusAnswer
+}
+
+func (s *Server) enterRelayStep(from model.GameStatus) error {
+	game := s.room.Game
+	game.ResetReady()
+	game.ResetImgUpdated()
+
+	if from == model.GameStatusOdai {
+		game.StepCount = 0
+		logger.Echo.Infof("setup relay chains (roomId:%s, seed:%d)", s.room.Id.String(), game.Seed)
+		random.SetupRelayChains(game)
+	} else {
+		game.StepCount++
+	}
+
+	s.startPhaseTimer()
+
+	if game.StepCount.IsDraw() {
+		if err := s.sendRelayDrawStartEvent(); err != nil {
+			return s.sendEventErr(err, oapi.WsEventDRAWSTART)
+		}
+	} else {
+		if err := s.sendRelayAnswerStartEvent(); err != nil {
+			return s.sendEventErr(err, oapi.WsEventANSWERSTART)
+		}
+	}
+
+	return nil
+}
+
+// DRAW_START (リレーモード)
+// 前の人の回答(最初はお題)を送信する (サーバー -> ルーム各員)
+func (s *Server) sendRelayDrawStartEvent() error {
+	if !s.room.GameStatusIs(model.GameStatusDraw) {
+		return errWrongPhase
+	}
+
+	var (
+		game = s.room.Game
+		sc   = game.StepCount.Int()
+		size = canvasSizeOf(game.Canvas.BoardName)
+	)
+
+	for _, o := range game.Odais {
+		if len(o.Chain) <= sc {
+			return errInvalidDrawCount
+		}
+
+		step := o.Chain[sc]
+		c, ok := s.hub.userIdToClient.Load(step.UserId)
+		if !ok {
+			logger.Echo.Infof("client(userId:%s) not found", step.UserId.UUID().String())
+			continue
+		}
+
+		prompt := o.Title.String()
+		if sc > 0 {
+			if a := o.Chain[sc-1].Answer; a != nil {
+				prompt = a.String()
+			}
+		}
+
+		s.sendMsgTo(c, &oapi.WsSendMessage{
+			Type: oapi.WsEventDRAWSTART,
+			Body: oapi.WsDrawStartEventBody{
+				AllDrawPhaseNum: (game.RelayStepNum() + 1) / 2,
+				Canvas: oapi.Canvas{
+					AreaId:    0,
+					BoardName: game.Canvas.BoardName,
+					Width:     size.X,
+					Height:    size.Y,
+				},
+				DrawPhaseNum: s.drawPhaseNum(),
+				Img:          model.Img("").AddPrefix(),
+				Odai:         prompt,
+				TimeLimit:    int(game.TimeLimit),
+				Deadline:     time.Time(game.Timeout),
+				DrawnArea:    []int{},
+				Palette:      s.paletteColorsOf(step.UserId),
+			},
+		})
+	}
+
+	return nil
+}
+
+// ANSWER_START (リレーモード)
+// 前の人の絵を送信する (サーバー -> ルーム各員)
+func (s *Server) sendRelayAnswerStartEvent() error {
+	if !s.room.GameStatusIs(model.GameStatusAnswer) {
+		return errWrongPhase
+	}
+
+	var (
+		game = s.room.Game
+		sc   = game.StepCount.Int()
+	)
+
+	for _, o := range game.Odais {
+		if len(o.Chain) <= sc || sc == 0 {
+			return errInvalidDrawCount
+		}
+
+		step := o.Chain[sc]
+		c, ok := s.hub.userIdToClient.Load(step.UserId)
+		if !ok {
+			logger.Echo.Infof("client(userId:%s) not found", step.UserId.UUID().String())
+			continue
+		}
+
+		s.sendMsgTo(c, &oapi.WsSendMessage{
+			Type: oapi.WsEventANSWERSTART,
+			Body: oapi.WsAnswerStartEventBody{
+				Img:       o.Chain[sc-1].Img.DataURL(),
+				TimeLimit: int(game.TimeLimit),
+				Deadline:  time.Time(game.Timeout),
+			},
+		})
+	}
+
+	return nil
+}
+
+// relayStepOf returns the step of the current turn taken by the user.
+func (s *Server) relayStepOf(uid model.UserId) (*model.Odai, *model.RelayStep) {
+	sc := s.room.Game.StepCount.Int()
+	for _, o := range s.room.Game.Odais {
+		if sc < len(o.Chain) && o.Chain[sc].UserId == uid {
+			return o, &o.Chain[sc]
+		}
+	}
+
+	return nil, nil
+}
+
+// allRelayStepsAreSent reports whether all connected members have sent the current step.
+func (s *Server) allRelayStepsAreSent() bool {
+	game := s.room.Game
+	sc := game.StepCount
+	for _, o := range game.Odais {
+		if len(o.Chain) <= sc.Int() {
+			continue
+		}
+
+		step := o.Chain[sc]
+		if _, ok := s.hub.userIdToClient.Load(step.UserId); !ok {
+			continue
+		}
+
+		if sc.IsDraw() && !o.ImgUpdated || !sc.IsDraw() && step.Answer == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Server) completeRelayStep() model.GameStatus {
+	game := s.room.Game
+	sc := game.StepCount.Int()
+	for _, o := range game.Odais {
+		if len(o.Chain) <= sc {
+			continue
+		}
+
+		// 送信されなかった絵は白紙，回答は空にする
+		o.ImgUpdated = true
+		if !game.StepCount.IsDraw() && o.Chain[sc].Answer == nil {
+			noAnswer := model.OdaiAnswer("")
+			o.Chain[sc].Answer = &noAnswer
+		}
+	}
+
+	return s.nextOfRelayStep()
+}
+
+// showNextRelayStep shows the odai and then each step of the chain in order.
+// s.mux を取ってから呼ぶ
+func (s *Server) showNextRelayStep() error {
+	game := s.room.Game
+
+	switch game.NextShowPhase {
+	case model.GameShowPhaseOdai:
+		if err := s.sendShowOdaiEvent(); err != nil {
+			logger.Echo.Error(s.sendEventErr(err, oapi.WsEventSHOWODAI))
+		}
+		game.ShowStep = 0
+		game.NextShowPhase = model.GameShowPhaseCanvas
+	case model.GameShowPhaseCanvas, model.GameShowPhaseAnswer:
+		if err := s.sendRelayShowStepEvent(); err != nil {
+			return err
+		}
+		game.ShowStep++
+		if game.ShowStep.Int() < game.RelayStepNum() {
+			if game.ShowStep.IsDraw() {
+				game.NextShowPhase = model.GameShowPhaseCanvas
+			} else {
+				game.NextShowPhase = model.GameShowPhaseAnswer
+			}
+		} else {
+			if game.ShowCount.Int()+1 < len(game.Odais) {
+				game.NextShowPhase = model.GameShowPhaseOdai
+			} else {
+				game.NextShowPhase = model.GameShowPhaseEnd
+			}
+			game.ShowCount++
+			if game.NextShowPhase == model.GameShowPhaseEnd {
+				s.finishShowLocked()
+			}
+		}
+	case model.GameShowPhaseEnd:
+	default:
+		return errUnknownPhase
+	}
+
+	return nil
+}
+
+// SHOW_CANVAS / SHOW_ANSWER (リレーモード)
+// チェーンの次のステップを受信する (サーバー -> ルーム全員)
+func (s *Server) sendRelayShowStepEvent() error {
+	if !s.room.GameStatusIs(model.GameStatusShow) {
+		return errWrongPhase
+	}
+
+	var (
+		game = s.room.Game
+		sc   = game.ShowCount.Int()
+		step = game.ShowStep
+	)
+
+	if len(game.Odais) < sc+1 || len(game.Odais[sc].Chain) < step.Int()+1 {
+		return errNotFound
+	}
+
+	var next oapi.WsNextShowStatus
+	switch {
+	case step.Int()+1 < len(game.Odais[sc].Chain) && (step + 1).IsDraw():
+		next = oapi.WsNextShowStatusCanvas
+	case step.Int()+1 < len(game.Odais[sc].Chain):
+		next = oapi.WsNextShowStatusAnswer
+	case sc+1 < len(game.Odais):
+		next = oapi.WsNextShowStatusOdai
+	default:
+		next = oapi.WsNextShowStatusEnd
+	}
+
+	cur := game.Odais[sc].Chain[step]
+	user := s.refillMember(cur.UserId)
+
+	if step.IsDraw() {
+		s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+			Type: oapi.WsEventSHOWCANVAS,
+			Body: &oapi.WsShowCanvasEventBody{
+				Next:   next,
+				Img:    cur.Img.DataURL(),
+				Drawer: &user,
+			},
+		})
+
+		return nil
+	}
+
+	var answer string
+	if cur.Answer != nil {
+		answer = cur.Answer.String()
+	}
+
+	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+		Type: oapi.WsEventSHOWANSWER,
+		Body: &oapi.WsShowAnswerEventBody{
+			Answerer: user,
+			Next:     next,
+			Answer:   answer,
+		},
+	})
+
+	return nil
+}
+
+func (s *Server) refillMember(uid model.UserId) oapi.User {
+	for _, m := range s.room.Members {
+		if m.Id == uid {
+			return oapi.RefillUser(&m)
+		}
+	}
+
+	return oapi.User{}
+}
+
+// receiveRelayDrawing stores the drawing of the current step sent by the client.
+func (c *Client) receiveRelayDrawing(src image.Image) error {
+	o, step := c.server.relayStepOf(c.userId)
+	if step == nil {
+		return errNotFound
+	}
+
+	// 1x1のボードなので重ねずにそのまま保存する
+	// 大きさをそろえたものを持ち，次の人に送るときに一度だけエンコードする
+	step.Img = model.NewRaster(canvas.Quantize(src, c.server.paletteOf(c.userId)))
+	o.ImgUpdated = true
+
+	return c.transitRelayStepIfSent()
+}
+
+// receiveRelayAnswer stores the answer of the current step sent by the client.
+func (c *Client) receiveRelayAnswer(e *oapi.WsAnswerSendEventBody) error {
+	_, step := c.server.relayStepOf(c.userId)
+	if step == nil {
+		return errNotFound
+	}
+
+	ma := model.OdaiAnswer(e.Answer)
+	step.Answer = &ma
+
+	return c.transitRelayStepIfSent()
+}
+
+// 全員の送信が完了したら次のステップ or SHOWフェーズに移行
+// ロックを取ってから呼ぶ
+func (c *Client) transitRelayStepIfSent() error {
+	if !c.server.allRelayStepsAreSent() {
+		return nil
+	}
+
+	next := c.server.nextOfRelayStep()
+	if err := c.server.transitLocked(next); err != nil {
+		switch next {
+		case model.GameStatusDraw:
+			return c.server.sendEventErr(err, oapi.WsEventDRAWSTART)
+		case model.GameStatusAnswer:
+			return c.server.sendEventErr(err, oapi.WsEventANSWERSTART)
+		default:
+			return c.server.sendEventErr(err, oapi.WsEventSHOWSTART)
+		}
+	}
+
+	return nil
+}
+
+func gameModeOf(mode oapi.GameMode) (model.GameMode, error) {
+	switch mode {
+	case oapi.GameModeGrid:
+		return model.GameModeGrid, nil
+	case oapi.GameModeRelay:
+		return model.GameModeRelay, nil
+	default:
+		return 0, errUnknownGameMode
+	}
+}
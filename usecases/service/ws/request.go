@@ -0,0 +1,178 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+)
+
+// Limits of the fields in the request bodies (docs/openapi.yml と合わせる)
+const (
+	maxOdaiLength   = 30
+	maxAnswerLength = 30
+	maxImgLength    = maxMessageSize
+	imgPrefix       = "data:image/png;base64,"
+	jpegPrefix      = "data:image/jpeg;base64,"
+)
+
+// fieldError is an error about a field of the request body.
+type fieldError struct {
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return fmt.Sprintf("invalid field %q: %s", e.field, e.err.Error())
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// isEmptyBody reports whether the request has no body.
+func isEmptyBody(body json.RawMessage) bool {
+	b := bytes.TrimSpace(body)
+	return len(b) == 0 || bytes.Equal(b, []byte("null"))
+}
+
+// decodeBody decodes the body of a request into the type of the event and validates it.
+// 不正なフィールドがあるときは *fieldError を返す
+func decodeBody(body json.RawMessage, out interface{}) error {
+	if isEmptyBody(body) {
+		return errNilBody
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return errInvalidBody
+	}
+
+	// フィールドごとにデコードして，どのフィールドが不正か分かるようにする
+	v := reflect.ValueOf(out).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, required := jsonFieldOf(t.Field(i))
+		if len(name) == 0 {
+			continue
+		}
+
+		raw, ok := fields[name]
+		if !ok || isEmptyBody(raw) {
+			if required {
+				return &fieldError{field: name, err: errRequiredField}
+			}
+
+			continue
+		}
+
+		if err := json.Unmarshal(raw, v.Field(i).Addr().Interface()); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return &fieldError{field: name, err: fmt.Errorf("%w: expected %s", errInvalidFieldType, typeErr.Type.String())}
+			}
+
+			return &fieldError{field: name, err: fmt.Errorf("%w: %s", errInvalidFieldType, err.Error())}
+		}
+	}
+
+	return validateBody(out)
+}
+
+// jsonFieldOf returns the JSON name of the field and whether it is required.
+// oapi-codegen は任意のフィールドを omitempty 付きのポインタにするので，それ以外を必須とみなす
+func jsonFieldOf(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if len(tag) == 0 || tag == "-" {
+		return "", false
+	}
+
+	name, opts, _ := strings.Cut(tag, ",")
+
+	return name, !strings.Contains(opts, "omitempty")
+}
+
+// validateBody checks the constraints of docs/openapi.yml which the generated types cannot express.
+func validateBody(v interface{}) error {
+	switch e := v.(type) {
+	case *oapi.WsRoomSetOptionEventBody:
+		if e.TimeLimit != nil && (*e.TimeLimit < 1 || int(model.MaxTimeLimit) < *e.TimeLimit) {
+			return &fieldError{field: "timeLimit", err: fmt.Errorf("%w: must be between 1 and %d", errInvalidTimeLimit, model.MaxTimeLimit)}
+		}
+
+		if e.RoundNum != nil && (*e.RoundNum < 1 || model.MaxRoundNum < *e.RoundNum) {
+			return &fieldError{field: "roundNum", err: fmt.Errorf("%w: must be between 1 and %d", errInvalidRoundNum, model.MaxRoundNum)}
+		}
+
+		if e.FogRadius != nil && (*e.FogRadius < 0 || model.MaxFogRadius < *e.FogRadius) {
+			return &fieldError{field: "fogRadius", err: fmt.Errorf("%w: must be between 0 and %d", errInvalidFogRadius, model.MaxFogRadius)}
+		}
+	case *oapi.WsOdaiSendEventBody:
+		if len(strings.TrimSpace(e.Odai)) == 0 {
+			return &fieldError{field: "odai", err: errRequiredField}
+		}
+
+		if maxOdaiLength < utf8.RuneCountInString(e.Odai) {
+			return &fieldError{field: "odai", err: fmt.Errorf("%w: must be at most %d characters", errTooLong, maxOdaiLength)}
+		}
+	case *oapi.WsAnswerSendEventBody:
+		if maxAnswerLength < utf8.RuneCountInString(e.Answer) {
+			return &fieldError{field: "answer", err: fmt.Errorf("%w: must be at most %d characters", errTooLong, maxAnswerLength)}
+		}
+	case *oapi.WsDrawSendEventBody:
+		if err := validateImg(e.Img); err != nil {
+			return &fieldError{field: "img", err: err}
+		}
+	case *oapi.WsRoomSetTemplateEventBody:
+		// 空文字列は下絵を消す．写真も使えるように JPEG も受け付ける
+		if len(e.Img) > 0 {
+			if err := validateDataURL(e.Img, imgPrefix, jpegPrefix); err != nil {
+				return &fieldError{field: "img", err: err}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateImg checks that img is a base64 encoded data URL of a PNG image.
+func validateImg(img string) error {
+	return validateDataURL(img, imgPrefix)
+}
+
+// validateDataURL checks that img is a base64 encoded data URL starting with one of the prefixes.
+func validateDataURL(img string, prefixes ...string) error {
+	if maxImgLength < len(img) {
+		return fmt.Errorf("%w: must be at most %d bytes", errTooLong, maxImgLength)
+	}
+
+	prefix := ""
+	for _, p := range prefixes {
+		if strings.HasPrefix(img, p) {
+			prefix = p
+			break
+		}
+	}
+
+	if len(prefix) == 0 {
+		return fmt.Errorf("%w: must start with %q", errInvalidDataURL, strings.Join(prefixes, `" or "`))
+	}
+
+	data := img[len(prefix):]
+	if len(data) == 0 {
+		return fmt.Errorf("%w: no image data", errInvalidDataURL)
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidDataURL, err.Error())
+	}
+
+	return nil
+}
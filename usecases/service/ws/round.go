@@ -0,0 +1,89 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/logger"
+)
+
+// Time between the end of the show phase and the start of the next round.
+const roundInterval = 10 * time.Second
+
+// finishShowLocked is called when all results of the round have been shown.
+// 最後のラウンドでなければ次のラウンドを自動で開始する
+func (s *Server) finishShowLocked() {
+	if err := s.sendRoundFinishEvent(); err != nil {
+		logger.Echo.Error(s.sendEventErr(err, oapi.WsEventROUNDFINISH))
+	}
+
+	if s.room.Game.IsFinalRound() {
+		return
+	}
+
+	s.startRoundTimer()
+}
+
+// startRoundTimer starts the countdown to the next round.
+func (s *Server) startRoundTimer() {
+	if s.hub.IsClosing() {
+		return
+	}
+
+	game := s.room.Game
+	seq := s.phaseSeq
+
+	s.stopPhaseTimer()
+	game.Timer = time.AfterFunc(roundInterval, func() {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+
+		if s.phaseSeq != seq {
+			return
+		}
+
+		if err := s.transitLocked(model.GameStatusOdai); err != nil {
+			logger.Echo.Error(err.Error())
+		}
+	})
+}
+
+// ROUND_FINISH
+// ラウンドの終了と累計結果を送信する (サーバー -> ルーム全員)
+func (s *Server) sendRoundFinishEvent() error {
+	if !s.room.GameStatusIs(model.GameStatusShow) {
+		return errWrongPhase
+	}
+
+	game := s.room.Game
+	scores := game.MemberScores(s.room.Members, len(game.Odais))
+	body := &oapi.WsRoundFinishEventBody{
+		Round:    game.Round,
+		RoundNum: game.RoundNum,
+		Scores:   make([]oapi.MemberScore, len(scores)),
+	}
+
+	for i, v := range scores {
+		body.Scores[i] = oapi.MemberScore{
+			UserId: v.UserId.UUID(),
+			Score:  v.Score,
+		}
+	}
+
+	if len(game.Teams) > 0 {
+		standings := refillTeamStandings(game.TeamStandings(len(game.Odais)))
+		body.TeamStandings = &standings
+	}
+
+	if !game.IsFinalRound() {
+		body.NextRoundIn = int(roundInterval / time.Second)
+	}
+
+	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+		Type: oapi.WsEventROUNDFINISH,
+		Body: body,
+	})
+
+	return nil
+}
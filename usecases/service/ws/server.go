@@ -2,11 +2,14 @@ package ws
 
 import (
 	"fmt"
+	"image"
+	"image/color"
 	"sync"
 	"time"
 
 	"github.com/21hack02win/nascalay-backend/model"
 	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
 	"github.com/21hack02win/nascalay-backend/util/logger"
 	"github.com/21hack02win/nascalay-backend/util/random"
 )
@@ -14,6 +17,12 @@ import (
 type Server struct {
 	hub  *Hub
 	room *model.Room
+	// mux serializes the phase transitions of the room
+	mux sync.Mutex
+	// phaseSeq is incremented on every transition to ignore stale timers
+	phaseSeq int
+	// counting is true until the time limit of the current phase comes
+	counting bool
 }
 
 // ROOM_NEW_MEMBER
@@ -54,7 +63,7 @@ func (s *Server) sendRoomUpdateOptionEvent(body *oapi.WsRoomUpdateOptionEventBod
 // ゲームの開始を通知する (サーバー -> ルーム全員)
 // ODAIフェーズを開始する
 func (s *Server) sendGameStartEvent() error {
-	if !s.room.GameStatusIs(model.GameStatusRoom) {
+	if !s.room.GameStatusIs(model.GameStatusOdai) {
 		return errWrongPhase
 	}
 
@@ -70,32 +79,13 @@ func (s *Server) sendGameStartEvent() error {
 			Body: &oapi.WsGameStartEventBody{
 				OdaiExample: random.OdaiExample(),
 				TimeLimit:   int(s.room.Game.TimeLimit),
+				Deadline:    time.Time(s.room.Game.Timeout),
+				Round:       s.room.Game.Round,
+				RoundNum:    s.room.Game.RoundNum,
 			},
 		})
 	}
 
-	// ODAIフェーズに移行
-	s.room.Game.Status = model.GameStatusOdai
-
-	// BREAK_ROOMのカウントダウン停止
-	if !s.room.Game.BreakTimer.Stop() {
-		<-s.room.Game.BreakTimer.C
-	}
-
-	// ODAIのカウントダウン開始
-	if !s.room.Game.Timer.Stop() {
-		select {
-		case <-s.room.Game.Timer.C:
-		default:
-		}
-	}
-	s.room.Game.Timeout = model.Timeout(time.Now().Add(time.Second * time.Duration(s.room.Game.TimeLimit)))
-	s.room.Game.Timer = time.AfterFunc(time.Second*time.Duration(s.room.Game.TimeLimit), func() {
-		if err := s.sendOdaiFinishEvent(); err != nil {
-			logger.Echo.Error(s.sendEventErr(err, oapi.WsEventODAIFINISH).Error())
-		}
-	})
-
 	return nil
 }
 
@@ -124,14 +114,6 @@ func (s *Server) sendOdaiFinishEvent() error {
 		return errWrongPhase
 	}
 
-	// ODAIのカウントダウン停止
-	if !s.room.Game.Timer.Stop() {
-		select {
-		case <-s.room.Game.Timer.C:
-		default:
-		}
-	}
-
 	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
 		Type: oapi.WsEventODAIFINISH,
 	})
@@ -150,6 +132,7 @@ func (s *Server) sendDrawStartEvent() error {
 	var (
 		game      = s.room.Game
 		drawCount = game.DrawCount
+		size      = canvasSizeOf(game.Canvas.BoardName)
 	)
 
 	for _, o := range game.Odais {
@@ -169,6 +152,11 @@ func (s *Server) sendDrawStartEvent() error {
 			drawnArea[i] = o.DrawerSeq[i].AreaId.Int()
 		}
 
+		img, visibleArea, err := s.fogImg(o.Img, drawer.AreaId)
+		if err != nil {
+			return err
+		}
+
 		s.sendMsgTo(c, &oapi.WsSendMessage{
 			Type: oapi.WsEventDRAWSTART,
 			Body: oapi.WsDrawStartEventBody{
@@ -176,31 +164,127 @@ func (s *Server) sendDrawStartEvent() error {
 				Canvas: oapi.Canvas{
 					AreaId:    drawer.AreaId.Int(),
 					BoardName: game.Canvas.BoardName,
+					Width:     size.X,
+					Height:    size.Y,
+					Region:    areaRegionOf(game.Canvas.BoardName, drawer.AreaId.Int()),
 				},
-				DrawPhaseNum: game.DrawCount.Int(),
-				Img:          o.Img.AddPrefix(),
+				DrawPhaseNum: s.drawPhaseNum(),
+				Img:          img,
 				Odai:         o.Title.String(),
 				TimeLimit:    int(game.TimeLimit),
+				Deadline:     time.Time(game.Timeout),
 				DrawnArea:    drawnArea,
+				VisibleArea:  visibleArea,
+				Template:     templateOf(o),
+				Palette:      s.paletteColorsOf(drawer.UserId),
 			},
 		})
 	}
 
-	// DRAWのカウントダウン開始
-	if !s.room.Game.Timer.Stop() {
-		select {
-		case <-s.room.Game.Timer.C:
-		default:
-		}
+	return nil
+}
+
+// canvasSizeOf returns the size in pixels that the clients draw the board in.
+func canvasSizeOf(boardName string) image.Point {
+	size, err := canvas.BoardSize(boardName)
+	if err != nil {
+		return image.Pt(canvas.GridWidth, canvas.GridHeight)
+	}
+
+	return size
+}
+
+// areaRegionOf returns the geometry of the area for the boards defined by masks.
+func areaRegionOf(boardName string, areaId int) *oapi.AreaRegion {
+	b, err := canvas.BoardOf(boardName)
+	if err != nil {
+		return nil
+	}
+
+	r := b.Region(areaId)
+	if r == nil {
+		return nil
+	}
+
+	return &oapi.AreaRegion{
+		X:      float32(r.X),
+		Y:      float32(r.Y),
+		Width:  float32(r.Width),
+		Height: float32(r.Height),
+		Mask:   model.Img(r.Mask).AddPrefix(),
+	}
+}
+
+// fogImg hides the areas farther than the fog radius from the area of the drawer and returns the data URL.
+// 霧がないときは画像をそのまま返し，見えるエリアは nil にする
+func (s *Server) fogImg(img *model.Raster, areaId model.AreaId) (string, *[]int, error) {
+	game := s.room.Game
+	if game.FogRadius == 0 {
+		return img.DataURL(), nil, nil
+	}
+
+	visibleArea, err := canvas.NeighborAreas(game.Canvas.BoardName, areaId.Int(), game.FogRadius)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get neighbor areas: %w", err)
+	}
+
+	// 最初の DRAW フェーズではまだ画像がない
+	if img.IsEmpty() {
+		return img.DataURL(), &visibleArea, nil
+	}
+
+	masked, err := canvas.MaskImage(img.Image(), game.Canvas.BoardName, visibleArea)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to mask image: %w", err)
+	}
+
+	b64, err := canvas.EncodeImage(masked)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return model.Img(b64).AddPrefix(), &visibleArea, nil
+}
+
+// drawPhaseNum returns the number of the current turn sent in DRAW_START.
+// リレーモードでは描くステップと答えるステップが交互に来る
+func (s *Server) drawPhaseNum() int {
+	if s.room.Game.Mode == model.GameModeRelay {
+		return s.room.Game.StepCount.Int() / 2
 	}
-	game.Timeout = model.Timeout(time.Now().Add(time.Second * time.Duration(s.room.Game.TimeLimit)))
-	game.Timer = time.AfterFunc(time.Second*time.Duration(s.room.Game.TimeLimit), func() {
-		if err := s.sendDrawFinishEvent(); err != nil {
-			logger.Echo.Error(s.sendEventErr(err, oapi.WsEventDRAWFINISH).Error())
+
+	return s.room.Game.DrawCount.Int()
+}
+
+// paletteOf returns the colors which the user can draw with, or nil when the colors are free.
+// 割り当てる色はメンバーの並び順で決める
+func (s *Server) paletteOf(uid model.UserId) color.Palette {
+	switch s.room.Game.Palette {
+	case model.PaletteMonochrome:
+		return canvas.MonochromePalette
+	case model.PaletteFour:
+		return canvas.FourColorPalette
+	case model.PalettePlayer:
+		for i, m := range s.room.Members {
+			if m.Id == uid {
+				return canvas.PlayerPalette(i)
+			}
 		}
-	})
 
-	return nil
+		return canvas.PlayerPalette(0)
+	default:
+		return nil
+	}
+}
+
+func (s *Server) paletteColorsOf(uid model.UserId) *[]string {
+	p := s.paletteOf(uid)
+	if len(p) == 0 {
+		return nil
+	}
+
+	hex := canvas.HexColors(p)
+	return &hex
 }
 
 // DRAW_INPUT
@@ -228,14 +312,6 @@ func (s *Server) sendDrawFinishEvent() error {
 		return errWrongPhase
 	}
 
-	// DRAWのカウントダウン停止
-	if !s.room.Game.Timer.Stop() {
-		select {
-		case <-s.room.Game.Timer.C:
-		default:
-		}
-	}
-
 	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
 		Type: oapi.WsEventDRAWFINISH,
 	})
@@ -261,26 +337,14 @@ func (s *Server) sendAnswerStartEvent() error {
 		s.sendMsgTo(ac, &oapi.WsSendMessage{
 			Type: oapi.WsEventANSWERSTART,
 			Body: oapi.WsAnswerStartEventBody{
-				Img:       v.Img.AddPrefix(),
+				Img:       v.Img.DataURL(),
 				TimeLimit: int(s.room.Game.TimeLimit),
+				Deadline:  time.Time(s.room.Game.Timeout),
+				Template:  templateOf(v),
 			},
 		})
 	}
 
-	// ANSWERのカウントダウン開始
-	if !s.room.Game.Timer.Stop() {
-		select {
-		case <-s.room.Game.Timer.C:
-		default:
-		}
-	}
-	s.room.Game.Timeout = model.Timeout(time.Now().Add(time.Second * time.Duration(s.room.Game.TimeLimit)))
-	s.room.Game.Timer = time.AfterFunc(time.Second*time.Duration(s.room.Game.TimeLimit), func() {
-		if err := s.sendAnswerFinishEvent(); err != nil {
-			logger.Echo.Error(s.sendEventErr(err, oapi.WsEventANSWERFINISH).Error())
-		}
-	})
-
 	return nil
 }
 
@@ -309,14 +373,6 @@ func (s *Server) sendAnswerFinishEvent() error {
 		return errWrongPhase
 	}
 
-	// ANSWERのカウントダウン停止
-	if !s.room.Game.Timer.Stop() {
-		select {
-		case <-s.room.Game.Timer.C:
-		default:
-		}
-	}
-
 	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
 		Type: oapi.WsEventANSWERFINISH,
 	})
@@ -363,12 +419,19 @@ func (s *Server) sendShowOdaiEvent() error {
 		}
 	}
 
+	var teamId *int
+	if len(game.Teams) > 0 {
+		tid := game.Odais[sc].TeamId.Int()
+		teamId = &tid
+	}
+
 	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
 		Type: oapi.WsEventSHOWODAI,
 		Body: &oapi.WsShowOdaiEventBody{
 			Sender: sender,
 			Next:   oapi.WsNextShowStatus("canvas"),
 			Odai:   game.Odais[sc].Title.String(),
+			TeamId: teamId,
 		},
 	})
 
@@ -394,8 +457,9 @@ func (s *Server) sendShowCanvasEvent() error {
 	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
 		Type: oapi.WsEventSHOWCANVAS,
 		Body: &oapi.WsShowCanvasEventBody{
-			Next: oapi.WsNextShowStatus("answer"),
-			Img:  game.Odais[sc].Img.AddPrefix(),
+			Next:     oapi.WsNextShowStatus("answer"),
+			Img:      game.Odais[sc].Img.DataURL(),
+			Template: templateOf(game.Odais[sc]),
 		},
 	})
 
@@ -471,9 +535,14 @@ func (s *Server) sendChangeHostEvent() error {
 	found := false
 
 	for _, v := range room.Members {
-		if _, ok := s.hub.userIdToClient.Load(v.Id); ok && v.Id != room.HostId {
+		if c, ok := s.hub.userIdToClient.Load(v.Id); ok && !c.bot && v.Id != room.HostId {
 			found = true
 			room.HostId = v.Id
+			s.hub.publish(roomsTopic, &busMessage{
+				Kind:   busMessageChangeHost,
+				RoomId: room.Id,
+				UserId: v.Id.UUID(),
+			})
 			break
 		}
 	}
@@ -505,6 +574,32 @@ func (s *Server) sendBreakRoomEvent() error {
 		return fmt.Errorf("failed to delete room: %w", err)
 	}
 
+	s.hub.roomIdToOwner.Delete(s.room.Id)
+	s.hub.publish(roomsTopic, &busMessage{
+		Kind:   busMessageDeleteRoom,
+		RoomId: s.room.Id,
+	})
+
+	return nil
+}
+
+// MAINTENANCE
+// サーバーが停止することを通知する (サーバー -> ルーム全員)
+// 進行中のタイマーはすべて停止する
+func (s *Server) sendMaintenanceEvent() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.stopPhaseTimer()
+	s.stopBreakTimer()
+
+	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+		Type: oapi.WsEventMAINTENANCE,
+		Body: &oapi.WsMaintenanceEventBody{
+			Content: "The server is going down for maintenance.",
+		},
+	})
+
 	return nil
 }
 
@@ -512,6 +607,10 @@ func (s *Server) sendBreakRoomEvent() error {
 
 // Send message to a client
 func (s *Server) sendMsgTo(c *Client, msg *oapi.WsSendMessage) {
+	s.sendLinkedMsgTo(c, s.hub.imageLinksOf(msg))
+}
+
+func (s *Server) sendLinkedMsgTo(c *Client, msg *imageLinks) {
 	// If the client is not connected, remove the client from the room
 	// If the client is the host, change the host
 	if c.send == nil {
@@ -526,11 +625,14 @@ func (s *Server) sendMsgTo(c *Client, msg *oapi.WsSendMessage) {
 		return
 	}
 
-	c.send <- msg
+	c.push(msg.messageFor(c))
 }
 
 // Send message to all clients in the room
 func (s *Server) sendMsgToEachClientInRoom(msg *oapi.WsSendMessage) {
+	// 画像のURLは宛先によらないので，保存と署名はメッセージごとに一度だけ行う
+	links := s.hub.imageLinksOf(msg)
+
 	var wg sync.WaitGroup
 	for _, m := range s.room.Members {
 		c, ok := s.hub.userIdToClient.Load(m.Id)
@@ -541,7 +643,7 @@ func (s *Server) sendMsgToEachClientInRoom(msg *oapi.WsSendMessage) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			s.sendMsgTo(c, msg)
+			s.sendLinkedMsgTo(c, links)
 		}()
 	}
 	wg.Wait()
@@ -567,12 +669,7 @@ func (s *Server) allMembersAreReady() bool {
 func (s *Server) resetBreakTimer() {
 	// BREAK_ROOMのカウントダウン開始
 	// 60(分)後に次のゲームが始まらなければルームを削除する
-	if !s.room.Game.BreakTimer.Stop() {
-		select {
-		case <-s.room.Game.BreakTimer.C:
-		default:
-		}
-	}
+	s.stopBreakTimer()
 	s.room.Game.BreakTimer.Reset(time.Minute * 60)
 
 	go func() {
@@ -0,0 +1,478 @@
+package ws
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+	"github.com/21hack02win/nascalay-backend/util/logger"
+	"github.com/21hack02win/nascalay-backend/util/random"
+)
+
+// Time allowed for clients to submit their inputs after the FINISH event.
+// After that the server fills the missing inputs and moves to the next phase.
+const submitWait = 5 * time.Second
+
+// phase declares the guard and the entry/exit actions of a game phase.
+// The transitions themselves are declared in model.
+type phase struct {
+	// guard is checked before entering the phase
+	guard func(from model.GameStatus) error
+	// enter is called after the status has changed
+	enter func(from model.GameStatus) error
+	// exit is called before leaving the phase
+	exit func()
+	// finish is called when the time limit comes or all members are ready
+	finish      func() error
+	finishEvent oapi.WsEvent
+	// complete fills the inputs which have not been submitted
+	// and returns the next phase
+	complete func() model.GameStatus
+}
+
+func (s *Server) phase(status model.GameStatus) phase {
+	switch status {
+	case model.GameStatusRoom:
+		return phase{
+			guard: s.guardRoomPhase,
+			enter: s.enterRoomPhase,
+			exit:  s.stopBreakTimer,
+		}
+	case model.GameStatusOdai:
+		return phase{
+			guard:       s.guardOdaiPhase,
+			enter:       s.enterOdaiPhase,
+			exit:        s.stopPhaseTimer,
+			finish:      s.sendOdaiFinishEvent,
+			finishEvent: oapi.WsEventODAIFINISH,
+			complete:    s.completeOdaiPhase,
+		}
+	case model.GameStatusDraw:
+		return phase{
+			guard:       s.guardDrawPhase,
+			enter:       s.enterDrawPhase,
+			exit:        s.stopPhaseTimer,
+			finish:      s.sendDrawFinishEvent,
+			finishEvent: oapi.WsEventDRAWFINISH,
+			complete:    s.completeDrawPhase,
+		}
+	case model.GameStatusAnswer:
+		return phase{
+			guard:       s.guardAnswerPhase,
+			enter:       s.enterAnswerPhase,
+			exit:        s.stopPhaseTimer,
+			finish:      s.sendAnswerFinishEvent,
+			finishEvent: oapi.WsEventANSWERFINISH,
+			complete:    s.completeAnswerPhase,
+		}
+	case model.GameStatusShow:
+		return phase{
+			guard: s.guardShowPhase,
+			enter: s.enterShowPhase,
+			exit:  s.exitShowPhase,
+		}
+	default:
+		return phase{}
+	}
+}
+
+// transit moves the game to the next phase.
+// Invalid transitions are rejected and logged here.
+func (s *Server) transit(next model.GameStatus) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.transitLocked(next)
+}
+
+func (s *Server) transitLocked(next model.GameStatus) error {
+	cur := s.room.Game.Status
+
+	// MAINTENANCE を送った後は，届いていたメッセージやタイマーでフェーズを進めない
+	if s.hub.IsClosing() {
+		return s.rejectTransition(cur, next, errServerClosing)
+	}
+
+	if !s.room.Game.CanTransitTo(next) {
+		return s.rejectTransition(cur, next, errInvalidTransition)
+	}
+
+	if guard := s.phase(next).guard; guard != nil {
+		if err := guard(cur); err != nil {
+			return s.rejectTransition(cur, next, err)
+		}
+	}
+
+	if exit := s.phase(cur).exit; exit != nil {
+		exit()
+	}
+
+	s.room.Game.Status = next
+	s.room.Game.Paused = false
+	s.room.Game.Remaining = 0
+	s.phaseSeq++
+
+	logger.Echo.Debugf("transit (roomId:%s): %s -> %s", s.room.Id.String(), cur, next)
+
+	if enter := s.phase(next).enter; enter != nil {
+		return enter(cur)
+	}
+
+	return nil
+}
+
+// finishPhaseLocked finishes the current phase.
+// Both of the time limit and the readiness of all members come here.
+func (s *Server) finishPhaseLocked(status model.GameStatus) error {
+	if !s.room.GameStatusIs(status) {
+		return errWrongPhase
+	}
+
+	p := s.phase(status)
+	if p.finish == nil {
+		return errWrongPhase
+	}
+
+	s.stopPhaseTimer()
+
+	if err := p.finish(); err != nil {
+		return err
+	}
+
+	if p.complete != nil {
+		s.startSubmitTimer()
+	}
+
+	return nil
+}
+
+func (s *Server) rejectTransition(cur model.GameStatus, next model.GameStatus, err error) error {
+	logger.Echo.Errorf("rejected transition (roomId:%s): %s -> %s: %s", s.room.Id.String(), cur, next, err.Error())
+	return fmt.Errorf("%s -> %s: %w", cur, next, err)
+}
+
+// Guards
+
+func (s *Server) guardRoomPhase(from model.GameStatus) error {
+	// 最後のラウンドが終わるまではルームに戻らない
+	if from == model.GameStatusShow && !s.room.Game.IsFinalRound() {
+		return errRoundsRemaining
+	}
+
+	return nil
+}
+
+func (s *Server) guardOdaiPhase(from model.GameStatus) error {
+	if from == model.GameStatusShow && s.room.Game.IsFinalRound() {
+		return errNoRoundsLeft
+	}
+
+	if len(s.room.Members) < 2 {
+		return errNotEnoughMember
+	}
+
+	if s.room.Game.Mode == model.GameModeRelay && len(s.room.Members) < model.MinRelayMembers {
+		return errNotEnoughMember
+	}
+
+	if s.room.Game.Mode == model.GameModeRelay && !s.allMembersSupport(oapi.WsFeatureRelayMode) {
+		return errUnsupportedFeature
+	}
+
+	if !canvas.IsGridBoard(s.room.Game.Canvas.BoardName) && !s.allMembersSupport(oapi.WsFeatureBoards) {
+		return errUnsupportedFeature
+	}
+
+	if s.room.Game.Mode == model.GameModeGrid && s.room.Game.HasTemplate() && !s.allMembersSupport(oapi.WsFeatureTemplate) {
+		return errUnsupportedFeature
+	}
+
+	if s.room.Game.Palette != model.PaletteFree && !s.allMembersSupport(oapi.WsFeaturePalette) {
+		return errUnsupportedFeature
+	}
+
+	if s.room.TeamModeEnabled() {
+		if s.room.Game.Mode == model.GameModeRelay {
+			return errTeamsInRelayMode
+		}
+
+		if !s.room.TeamsAreBalanced() {
+			return errUnbalancedTeams
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) guardDrawPhase(from model.GameStatus) error {
+	game := s.room.Game
+	if game.Mode == model.GameModeRelay && from == model.GameStatusAnswer {
+		if s.nextOfRelayStep() != model.GameStatusDraw {
+			return errInvalidDrawCount
+		}
+
+		return nil
+	}
+
+	if from == model.GameStatusDraw {
+		if game.DrawCount.Int()+1 >= s.room.AllDrawPhase() {
+			return errInvalidDrawCount
+		}
+
+		return nil
+	}
+
+	if len(game.Odais) != len(s.room.Members) {
+		return errOdaiNotCollected
+	}
+
+	return nil
+}
+
+func (s *Server) guardAnswerPhase(_ model.GameStatus) error {
+	if s.room.Game.Mode == model.GameModeRelay {
+		if s.nextOfRelayStep() != model.GameStatusAnswer {
+			return errInvalidDrawCount
+		}
+
+		return nil
+	}
+
+	if s.room.Game.DrawCount.Int()+1 < s.room.AllDrawPhase() {
+		return errInvalidDrawCount
+	}
+
+	return nil
+}
+
+func (s *Server) guardShowPhase(_ model.GameStatus) error {
+	if s.room.Game.Mode == model.GameModeRelay && s.nextOfRelayStep() != model.GameStatusShow {
+		return errInvalidDrawCount
+	}
+
+	return nil
+}
+
+// Completions
+
+// nextOfDrawPhase returns the phase after all drawings of the current turn are sent.
+func (s *Server) nextOfDrawPhase() model.GameStatus {
+	if s.room.Game.DrawCount.Int()+1 < s.room.AllDrawPhase() {
+		return model.GameStatusDraw
+	}
+
+	return model.GameStatusAnswer
+}
+
+func (s *Server) completeOdaiPhase() model.GameStatus {
+	game := s.room.Game
+
+	sent := make(map[model.UserId]bool, len(game.Odais))
+	for _, o := range game.Odais {
+		sent[o.SenderId] = true
+	}
+
+	// 送信されなかったお題はランダムに決める
+	for _, m := range s.room.Members {
+		if !sent[m.Id] {
+			game.AddOdai(m.Id, model.OdaiTitle(random.OdaiExample()))
+		}
+	}
+
+	return model.GameStatusDraw
+}
+
+func (s *Server) completeDrawPhase() model.GameStatus {
+	if s.room.Game.Mode == model.GameModeRelay {
+		return s.completeRelayStep()
+	}
+
+	for _, o := range s.room.Game.Odais {
+		// 送信されなかった絵は前の状態のままにする
+		o.ImgUpdated = true
+	}
+
+	return s.nextOfDrawPhase()
+}
+
+func (s *Server) completeAnswerPhase() model.GameStatus {
+	if s.room.Game.Mode == model.GameModeRelay {
+		return s.completeRelayStep()
+	}
+
+	for _, o := range s.room.Game.Odais {
+		if o.Answer == nil {
+			noAnswer := model.OdaiAnswer("")
+			o.Answer = &noAnswer
+		}
+	}
+
+	return model.GameStatusShow
+}
+
+// Entry actions
+
+func (s *Server) enterRoomPhase(_ model.GameStatus) error {
+	return s.sendNextRoomEvent()
+}
+
+func (s *Server) enterOdaiPhase(from model.GameStatus) error {
+	if from == model.GameStatusShow {
+		s.room.Game.NextRound()
+	} else {
+		// ゲーム中にチーム分けが変わらないようにコピーしておく
+		s.room.Game.Teams = s.room.CopyTeams()
+	}
+
+	// 開始イベントで締め切りを送るので，先にタイマーを動かす
+	s.startPhaseTimer()
+
+	if err := s.sendGameStartEvent(); err != nil {
+		return s.sendEventErr(err, oapi.WsEventGAMESTART)
+	}
+
+	return nil
+}
+
+func (s *Server) enterDrawPhase(from model.GameStatus) error {
+	game := s.room.Game
+	if game.Mode == model.GameModeRelay {
+		return s.enterRelayStep(from)
+	}
+
+	game.ResetReady()
+
+	if from == model.GameStatusDraw {
+		game.DrawCount++
+		game.ResetImgUpdated()
+	} else {
+		game.DrawCount = 0
+		// 不具合の再現のためにシードを残しておく
+		logger.Echo.Infof("setup member roles (roomId:%s, seed:%d)", s.room.Id.String(), game.Seed)
+		random.SetupMemberRoles(game, s.room.Members)
+	}
+
+	s.startPhaseTimer()
+
+	if err := s.sendDrawStartEvent(); err != nil {
+		return s.sendEventErr(err, oapi.WsEventDRAWSTART)
+	}
+
+	return nil
+}
+
+func (s *Server) enterAnswerPhase(from model.GameStatus) error {
+	if s.room.Game.Mode == model.GameModeRelay {
+		return s.enterRelayStep(from)
+	}
+
+	s.room.Game.ResetReady()
+
+	s.startPhaseTimer()
+
+	if err := s.sendAnswerStartEvent(); err != nil {
+		return s.sendEventErr(err, oapi.WsEventANSWERSTART)
+	}
+
+	return nil
+}
+
+func (s *Server) enterShowPhase(_ model.GameStatus) error {
+	if err := s.sendShowStartEvent(); err != nil {
+		return s.sendEventErr(err, oapi.WsEventSHOWSTART)
+	}
+
+	return nil
+}
+
+// exitShowPhase stops the countdown to the next round and to BREAK_ROOM.
+// 次のラウンドを手動で始めたときに，どちらのタイマーも残らないようにする
+func (s *Server) exitShowPhase() {
+	// 次のラウンドまでのカウントダウンは game.Timer を使う
+	s.stopPhaseTimer()
+	s.stopBreakTimer()
+}
+
+// Timers
+
+// startPhaseTimer starts the countdown of the current phase.
+func (s *Server) startPhaseTimer() {
+	s.startCountdown(time.Second * time.Duration(s.room.Game.TimeLimit))
+}
+
+// startCountdown finishes the current phase after limit.
+// A timer fired after the phase has changed is ignored, and no timer starts while the hub is closing.
+// 遅いクライアントの入力が間に合うように，締め切りから猶予を置いて FINISH を送る
+func (s *Server) startCountdown(limit time.Duration) {
+	if s.hub.IsClosing() {
+		return
+	}
+
+	game := s.room.Game
+	status := game.Status
+	seq := s.phaseSeq
+
+	s.stopPhaseTimer()
+	s.counting = true
+	game.Timeout = model.Timeout(time.Now().Add(limit))
+	game.Timer = time.AfterFunc(limit+s.finishGrace(), func() {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+
+		if s.phaseSeq != seq {
+			return
+		}
+
+		if err := s.finishPhaseLocked(status); err != nil {
+			logger.Echo.Error(s.sendEventErr(err, s.phase(status).finishEvent).Error())
+		}
+	})
+}
+
+// startSubmitTimer starts the countdown for the submissions after the FINISH event.
+func (s *Server) startSubmitTimer() {
+	if s.hub.IsClosing() {
+		return
+	}
+
+	game := s.room.Game
+	status := game.Status
+	seq := s.phaseSeq
+
+	s.stopPhaseTimer()
+	game.Timer = time.AfterFunc(submitWait, func() {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+
+		if s.phaseSeq != seq {
+			return
+		}
+
+		logger.Echo.Infof("complete %s phase without waiting for the clients (roomId:%s)", status, s.room.Id.String())
+
+		if err := s.transitLocked(s.phase(status).complete()); err != nil {
+			logger.Echo.Error(err.Error())
+		}
+	})
+}
+
+func (s *Server) stopPhaseTimer() {
+	s.counting = false
+	if !s.room.Game.Timer.Stop() {
+		select {
+		case <-s.room.Game.Timer.C:
+		default:
+		}
+	}
+}
+
+func (s *Server) stopBreakTimer() {
+	if !s.room.Game.BreakTimer.Stop() {
+		select {
+		case <-s.room.Game.BreakTimer.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package ws
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+)
+
+func TestShowToNextRoundStopsTimers(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	newTestClient(t, h, joinTestRoom(t, h, room, "guest"))
+
+	s, game := host.server, room.Game
+	game.RoundNum = 2
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	// 結果表示の後，次のラウンドまでのカウントダウンとルーム削除のカウントダウンが動いている
+	game.Status = model.GameStatusShow
+	s.resetBreakTimer()
+	s.startRoundTimer()
+	roundTimer := game.Timer
+
+	if err := s.transitLocked(model.GameStatusOdai); err != nil {
+		t.Fatal(err)
+	}
+	defer s.stopPhaseTimer()
+
+	if roundTimer.Stop() {
+		t.Error("the round timer is still running after the next round has started")
+	}
+	if game.BreakTimer.Stop() {
+		t.Error("the break timer is still running after the next round has started")
+	}
+}
+
+func TestFilledOdaiHasTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		// miss makes the guest miss sending the odai while the host sends one by send
+		miss func(t *testing.T, s *Server, guest *Client, send func())
+	}{
+		{
+			name: "time is up",
+			miss: func(t *testing.T, s *Server, _ *Client, send func()) {
+				send()
+
+				s.mux.Lock()
+				defer s.mux.Unlock()
+
+				if err := s.transitLocked(s.phase(model.GameStatusOdai).complete()); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "disconnected",
+			miss: func(_ *testing.T, s *Server, guest *Client, send func()) {
+				s.hub.unregister(guest)
+				send()
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHub(t, broker.NewLocalBroker())
+			room := newTestRoom(t, h)
+			host := newTestClient(t, h, room.HostId)
+			guestId := joinTestRoom(t, h, room, "guest")
+			guest := newTestClient(t, h, guestId)
+			for _, c := range []*Client{host, guest} {
+				c.features = newFeatureSet([]oapi.WsFeature{oapi.WsFeatureTemplate})
+			}
+
+			game := room.Game
+			template := model.Img(testDrawing(t, game.Canvas.BoardName))
+			game.SetTemplate(&guestId, template)
+
+			if err := request(t, host, oapi.WsEventREQUESTGAMESTART, struct{}{}); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.miss(t, host.server, guest, func() {
+				if err := request(t, host, oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{Odai: "ねこ"}); err != nil {
+					t.Fatal(err)
+				}
+			})
+
+			if len(game.Odais) != 2 {
+				t.Fatalf("%d odais, want 2", len(game.Odais))
+			}
+			for _, o := range game.Odais {
+				if o.SenderId == guestId && o.Template != template {
+					t.Errorf("the odai filled for the guest has no template")
+				}
+			}
+		})
+	}
+}
+
+func TestOdaiCompletion(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	guestId := joinTestRoom(t, h, room, "guest")
+	newTestClient(t, h, guestId)
+
+	if err := request(t, host, oapi.WsEventREQUESTGAMESTART, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := request(t, host, oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{Odai: "ねこ"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, game := host.server, room.Game
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	// ゲストはお題を送らないまま締め切られる
+	next := s.phase(model.GameStatusOdai).complete()
+	if next != model.GameStatusDraw {
+		t.Fatalf("next phase = %s, want %s", next, model.GameStatusDraw)
+	}
+
+	titles := make(map[model.UserId]model.OdaiTitle, len(game.Odais))
+	for _, o := range game.Odais {
+		titles[o.SenderId] = o.Title
+	}
+	if len(titles) != 2 || titles[room.HostId] != "ねこ" || titles[guestId] == "" {
+		t.Errorf("odais after completion = %v, want the sent one and a filled one", titles)
+	}
+}
+
+func TestConcurrentShowNext(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host := newTestClient(t, h, room.HostId)
+	guest := newTestClient(t, h, joinTestRoom(t, h, room, "guest"))
+
+	s, game := host.server, room.Game
+	game.RoundNum = 2
+
+	if err := request(t, host, oapi.WsEventREQUESTGAMESTART, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range []*Client{host, guest} {
+		if err := request(t, c, oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{Odai: []string{"ねこ", "いぬ"}[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 誰も送らないまま SHOW フェーズまで進める
+	s.mux.Lock()
+	for !room.GameStatusIs(model.GameStatusShow) {
+		if err := s.transitLocked(s.phase(game.Status).complete()); err != nil {
+			s.mux.Unlock()
+			t.Fatal(err)
+		}
+	}
+	s.mux.Unlock()
+
+	// お題ごとに SHOW_ODAI, SHOW_CANVAS, SHOW_ANSWER の3回で進むので，多めに送っても最後で止まる
+	var wg sync.WaitGroup
+	for i := 0; i < 3*len(game.Odais)+4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = request(t, host, oapi.WsEventSHOWNEXT, struct{}{})
+		}()
+	}
+	wg.Wait()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	defer s.stopPhaseTimer()
+
+	if game.NextShowPhase != model.GameShowPhaseEnd || game.ShowCount.Int() != len(game.Odais) {
+		t.Errorf("show = {next: %v, count: %d}, want {end, %d}", game.NextShowPhase, game.ShowCount, len(game.Odais))
+	}
+}
+
+func TestDrawStartFog(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	host, msgs := newRecordingClient(t, h, room.HostId)
+	guest := newTestClient(t, h, joinTestRoom(t, h, room, "guest"))
+
+	fogRadius := 1
+	if err := request(t, host, oapi.WsEventROOMSETOPTION, &oapi.WsRoomSetOptionEventBody{FogRadius: &fogRadius}); err != nil {
+		t.Fatal(err)
+	}
+	if err := request(t, host, oapi.WsEventREQUESTGAMESTART, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range []*Client{host, guest} {
+		if err := request(t, c, oapi.WsEventODAISEND, &oapi.WsOdaiSendEventBody{Odai: []string{"ねこ", "いぬ"}[i]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, game := host.server, room.Game
+	boardName := game.Canvas.BoardName
+
+	// 最初のターンで全体が塗られたことにして，次のターンに進める
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	s.mux.Lock()
+	for _, o := range game.Odais {
+		img := image.NewRGBA(image.Rect(0, 0, canvas.GridWidth, canvas.GridHeight))
+		draw.Draw(img, img.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+		o.Img = model.NewRaster(img)
+	}
+	err := s.transitLocked(model.GameStatusDraw)
+	s.mux.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body oapi.WsDrawStartEventBody
+	for body.DrawPhaseNum != 1 {
+		select {
+		case msg := <-msgs:
+			if msg.Type != oapi.WsEventDRAWSTART {
+				continue
+			}
+			if err := convertBody(msg.Body, &body); err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("DRAW_START of the second turn is not sent")
+		}
+	}
+
+	// クライアントはこの大きさで描く
+	if body.Canvas.Width != canvas.GridWidth || body.Canvas.Height != canvas.GridHeight {
+		t.Errorf("canvas size = %dx%d, want %dx%d", body.Canvas.Width, body.Canvas.Height, canvas.GridWidth, canvas.GridHeight)
+	}
+
+	want, err := canvas.NeighborAreas(boardName, body.Canvas.AreaId, fogRadius)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body.VisibleArea == nil || !reflect.DeepEqual(*body.VisibleArea, want) {
+		t.Fatalf("visibleArea = %v, want %v", body.VisibleArea, want)
+	}
+
+	img, err := canvas.DecodeImage(body.Img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	visible := make(map[int]bool, len(want))
+	for _, a := range want {
+		visible[a] = true
+	}
+
+	// 各エリアの中央の画素は，見えるエリアだけ塗られている
+	for a := 0; a < game.Canvas.AllArea; a++ {
+		rect, err := canvas.AreaRect(img.Bounds(), boardName, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		center := rect.Min.Add(rect.Size().Div(2))
+
+		_, _, _, alpha := img.At(center.X, center.Y).RGBA()
+		if visible[a] && alpha == 0 {
+			t.Errorf("area %d is hidden though it is next to area %d", a, body.Canvas.AreaId)
+		}
+		if !visible[a] && alpha != 0 {
+			t.Errorf("area %d is shown though it is far from area %d", a, body.Canvas.AreaId)
+		}
+	}
+}
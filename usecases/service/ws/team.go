@@ -0,0 +1,130 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/random"
+	"github.com/gofrs/uuid"
+)
+
+// ROOM_SET_TEAM
+// メンバーのチームを変更する (ホスト -> サーバー)
+func (c *Client) sendRoomSetTeamEvent(body json.RawMessage) error {
+	room := c.server.room
+	if !room.GameStatusIs(model.GameStatusRoom) {
+		return errWrongPhase
+	}
+
+	if c.userId != room.HostId {
+		return errUnAuthorized
+	}
+
+	e := new(oapi.WsRoomSetTeamEventBody)
+	if err := decodeBody(body, e); err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	uid := model.UserId(e.UserId)
+	if _, ok := room.TeamOf(uid); !ok {
+		return errNotFound
+	}
+
+	if !room.MoveMemberToTeam(uid, model.TeamId(e.TeamId)) {
+		return errNotFound
+	}
+
+	if err := c.server.sendRoomUpdateTeamsEvent(); err != nil {
+		return c.server.sendEventErr(err, oapi.WsEventROOMUPDATETEAMS)
+	}
+
+	return nil
+}
+
+// checkTeamNum rejects the number of teams which the members cannot be split into.
+func (s *Server) checkTeamNum(num int) error {
+	if num != 0 && (num < 2 || len(s.room.Members) < num) {
+		return errInvalidTeamNum
+	}
+
+	return nil
+}
+
+// setTeamNum splits the members into teams, or stops the team mode when num is 0.
+// checkTeamNum で確かめてから呼ぶ
+func (s *Server) setTeamNum(num int) {
+	if num == 0 {
+		s.room.Teams = nil
+		return
+	}
+
+	s.room.Teams = random.BalanceTeams(s.room.Game, s.room.Members, num)
+}
+
+// ROOM_UPDATE_TEAMS
+// チーム分けを更新する (サーバー -> ルーム全員)
+func (s *Server) sendRoomUpdateTeamsEvent() error {
+	if !s.room.GameStatusIs(model.GameStatusRoom) {
+		return errWrongPhase
+	}
+
+	teams := make([]oapi.Team, len(s.room.Teams))
+	for i, t := range s.room.Teams {
+		members := make([]uuid.UUID, len(t.MemberIds))
+		for j, m := range t.MemberIds {
+			members[j] = m.UUID()
+		}
+
+		teams[i] = oapi.Team{
+			TeamId:  t.Id.Int(),
+			Members: members,
+		}
+	}
+
+	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+		Type: oapi.WsEventROOMUPDATETEAMS,
+		Body: &oapi.WsRoomUpdateTeamsEventBody{
+			Teams: teams,
+		},
+	})
+
+	return nil
+}
+
+// TEAM_STANDINGS
+// チームの順位を送信する (サーバー -> ルーム全員)
+func (s *Server) sendTeamStandingsEvent() error {
+	if !s.room.GameStatusIs(model.GameStatusShow) {
+		return errWrongPhase
+	}
+
+	game := s.room.Game
+	if len(game.Teams) == 0 {
+		return nil
+	}
+
+	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+		Type: oapi.WsEventTEAMSTANDINGS,
+		Body: &oapi.WsTeamStandingsEventBody{
+			Standings: refillTeamStandings(game.TeamStandings(game.ShowCount.Int())),
+			Final:     game.NextShowPhase == model.GameShowPhaseEnd && game.IsFinalRound(),
+		},
+	})
+
+	return nil
+}
+
+func refillTeamStandings(standings []model.TeamStanding) []oapi.TeamStanding {
+	res := make([]oapi.TeamStanding, len(standings))
+	for i, v := range standings {
+		res[i] = oapi.TeamStanding{
+			TeamId: v.TeamId.Int(),
+			Score:  v.Score,
+			Rank:   v.Rank,
+		}
+	}
+
+	return res
+}
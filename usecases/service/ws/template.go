@@ -0,0 +1,143 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+)
+
+// ROOM_SET_TEMPLATE
+// 下絵を設定する (ホスト -> サーバー)
+func (c *Client) sendRoomSetTemplateEvent(body json.RawMessage) error {
+	room := c.server.room
+	if !room.GameStatusIs(model.GameStatusRoom) {
+		return errWrongPhase
+	}
+
+	if c.userId != room.HostId {
+		return errUnAuthorized
+	}
+
+	e := new(oapi.WsRoomSetTemplateEventBody)
+	if err := decodeBody(body, e); err != nil {
+		return fmt.Errorf("failed to decode body: %w", err)
+	}
+
+	var uid *model.UserId
+	if e.UserId != nil {
+		id := model.UserId(*e.UserId)
+		if !isMemberOf(room, id) {
+			return errNotFound
+		}
+		uid = &id
+	}
+
+	var img model.Img
+	if len(e.Img) > 0 {
+		normalized, err := canvas.NormalizeTemplate(e.Img[strings.IndexByte(e.Img, ',')+1:], room.Game.Canvas.BoardName)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+		img = model.Img(normalized)
+	}
+
+	room.Game.SetTemplate(uid, img)
+
+	if err := c.server.sendRoomUpdateTemplateEvent(uid, img); err != nil {
+		return c.server.sendEventErr(err, oapi.WsEventROOMUPDATETEMPLATE)
+	}
+
+	return nil
+}
+
+// ROOM_UPDATE_TEMPLATE
+// 下絵を更新する (サーバー -> ルーム全員)
+func (s *Server) sendRoomUpdateTemplateEvent(uid *model.UserId, img model.Img) error {
+	if !s.room.GameStatusIs(model.GameStatusRoom) {
+		return errWrongPhase
+	}
+
+	body := &oapi.WsRoomUpdateTemplateEventBody{}
+	if len(img) > 0 {
+		body.Img = img.AddPrefix()
+	}
+
+	if uid != nil {
+		id := uid.UUID()
+		body.UserId = &id
+	}
+
+	s.sendMsgToEachClientInRoom(&oapi.WsSendMessage{
+		Type: oapi.WsEventROOMUPDATETEMPLATE,
+		Body: body,
+	})
+
+	return nil
+}
+
+// resizeTemplates returns the templates fitted in the canvas of the board to, without changing the game.
+// 大きさが同じボードのときはそのまま返す
+func (s *Server) resizeTemplates(from string, to string) (model.Img, map[model.UserId]model.Img, error) {
+	game := s.room.Game
+	if !game.HasTemplate() {
+		return game.Template, game.OdaiTemplates, nil
+	}
+
+	prev, err := canvas.BoardSize(from)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get board size: %w", err)
+	}
+
+	size, err := canvas.BoardSize(to)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get board size: %w", err)
+	}
+
+	if prev == size {
+		return game.Template, game.OdaiTemplates, nil
+	}
+
+	resize := func(img model.Img) (model.Img, error) {
+		if len(img) == 0 {
+			return img, nil
+		}
+
+		resized, err := canvas.NormalizeTemplate(string(img), to)
+		if err != nil {
+			return "", fmt.Errorf("failed to resize template: %w", err)
+		}
+
+		return model.Img(resized), nil
+	}
+
+	template, err := resize(game.Template)
+	if err != nil {
+		return "", nil, err
+	}
+
+	odaiTemplates := make(map[model.UserId]model.Img, len(game.OdaiTemplates))
+	for uid, img := range game.OdaiTemplates {
+		resized, err := resize(img)
+		if err != nil {
+			return "", nil, err
+		}
+		odaiTemplates[uid] = resized
+	}
+
+	return template, odaiTemplates, nil
+}
+
+// templateOf returns the data URL of the template of the odai, or nil when it has no template.
+func templateOf(o *model.Odai) *string {
+	if len(o.Template) == 0 {
+		return nil
+	}
+
+	t := o.Template.AddPrefix()
+
+	return &t
+}
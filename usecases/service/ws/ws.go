@@ -1,43 +1,83 @@
 package ws
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/21hack02win/nascalay-backend/model"
 	"github.com/21hack02win/nascalay-backend/oapi"
+	"github.com/21hack02win/nascalay-backend/usecases/broker"
 	"github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/util/errcode"
 	"github.com/21hack02win/nascalay-backend/util/logger"
 	"github.com/21hack02win/nascalay-backend/util/safe"
+	"github.com/gofrs/uuid"
 	"github.com/gorilla/websocket"
 )
 
 type Hub struct {
 	upgrader       websocket.Upgrader
 	repo           repository.Repository
+	broker         broker.Broker
+	instanceId     string
 	userIdToClient *safe.Map[model.UserId, *Client]
 	roomIdToServer *safe.Map[model.RoomId, *Server]
+	roomIdToOwner  *safe.Map[model.RoomId, string]
 	registerCh     chan *Client
 	unregisterCh   chan *Client
+	closing        atomic.Bool
+	writePumps     sync.WaitGroup
+	// Time to wait for more messages to send in a frame to the clients which enabled batching.
+	batchWindow time.Duration
+	images      *imageLinker
+	// Connect requests from the other instances which arrived before the members joined.
+	// 参加の複製とは別のトピックで届くので，参加を待ってからクライアントを作る
+	pendingMux      sync.Mutex
+	pendingConnects map[model.UserId]*busMessage
 }
 
-func InitHub(repo repository.Repository) *Hub {
+func InitHub(repo repository.Repository, broker broker.Broker, batchWindow time.Duration, images ImageOptions) (*Hub, error) {
+	linker, err := newImageLinker(images)
+	if err != nil {
+		return nil, err
+	}
+
 	hub := &Hub{
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
+			// 有効にしないと permessage-deflate をネゴシエーションしない
+			EnableCompression: true,
 		},
-		repo:           repo,
-		userIdToClient: safe.NewMap[model.UserId, *Client](),
-		roomIdToServer: safe.NewMap[model.RoomId, *Server](),
-		registerCh:     make(chan *Client),
-		unregisterCh:   make(chan *Client),
+		repo:            repo,
+		broker:          broker,
+		instanceId:      uuid.Must(uuid.NewV4()).String(),
+		userIdToClient:  safe.NewMap[model.UserId, *Client](),
+		roomIdToServer:  safe.NewMap[model.RoomId, *Server](),
+		roomIdToOwner:   safe.NewMap[model.RoomId, string](),
+		registerCh:      make(chan *Client),
+		unregisterCh:    make(chan *Client),
+		batchWindow:     batchWindow,
+		images:          linker,
+		pendingConnects: make(map[model.UserId]*busMessage),
+	}
+
+	if _, err := broker.Subscribe(instanceTopic(hub.instanceId), hub.handleInstanceMessage); err != nil {
+		return nil, fmt.Errorf("failed to subscribe instance topic: %w", err)
+	}
+
+	if _, err := broker.Subscribe(roomsTopic, hub.handleRoomsMessage); err != nil {
+		return nil, fmt.Errorf("failed to subscribe rooms topic: %w", err)
 	}
 
 	go hub.run()
 
-	return hub
+	return hub, nil
 }
 
 func (h *Hub) run() {
@@ -46,40 +86,92 @@ func (h *Hub) run() {
 		case cli := <-h.registerCh:
 			h.register(cli)
 		case cli := <-h.unregisterCh:
-			if _, ok := h.userIdToClient.Load(cli.userId); ok {
-				h.unregister(cli)
-			}
+			h.unregister(cli)
 		}
 	}
 }
 
-func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request, userId model.UserId) error {
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request, userId model.UserId, hs Handshake) error {
+	if h.IsClosing() {
+		return errServerClosing
+	}
+
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return fmt.Errorf("failed to upgrade the HTTP server connection to the WebSocket protocol: %w", err)
 	}
 
-	cli, err := h.addNewClient(userId, conn)
+	// アップグレードで permessage-deflate が使えるようになったときだけ compression を有効にする
+	version, features := negotiate(hs, h.upgrader.EnableCompression && offersCompression(r))
+	conn.EnableWriteCompression(features.has(oapi.WsFeatureCompression))
+
+	cli, err := h.addNewClient(userId, conn, errcode.LangOf(r.Header.Get("Accept-Language")), version, features)
 	if err != nil {
 		return fmt.Errorf("failed to add new client: %w", err)
 	}
 
+	// The game of the room is running on another instance
+	if len(cli.owner) > 0 {
+		if err := h.connectToOwner(cli); err != nil {
+			h.unregisterCh <- cli
+			conn.Close()
+			return fmt.Errorf("failed to connect to the owner instance: %w", err)
+		}
+	}
+
 	// Allow collection of memory referenced by the caller by doing all work in
 	// new goroutines.
-	go cli.writePump()
+	h.writePumps.Add(1)
+	go func() {
+		defer h.writePumps.Done()
+		cli.writePump()
+	}()
 	go cli.readPump()
 
-	cli.send <- &oapi.WsSendMessage{
+	cli.push(&oapi.WsSendMessage{
 		Type: oapi.WsEventWELCOMENEWCLIENT,
 		Body: oapi.WsWelcomeNewClientBody{
-			Content: "Welcome to nascalay-backend!",
+			Content:         "Welcome to nascalay-backend!",
+			ServerVersion:   serverVersion(),
+			ProtocolVersion: version,
+			Features:        features.list(),
 		},
-	}
+	})
 
 	return nil
 }
 
+// NotifyOfNewRoom shares the room created on this instance with the other instances.
+func (h *Hub) NotifyOfNewRoom(room *model.Room) {
+	h.roomIdToOwner.Store(room.Id, h.instanceId)
+
+	r := oapi.RefillRoom(room, model.UserId{})
+	h.publish(roomsTopic, &busMessage{
+		Kind:   busMessageCreateRoom,
+		RoomId: room.Id,
+		Room:   &r,
+	})
+}
+
 func (h *Hub) NotifyOfNewRoomMember(room *model.Room) error {
+	if len(room.Members) > 0 {
+		u := oapi.RefillUser(&room.Members[len(room.Members)-1])
+		h.publish(roomsTopic, &busMessage{
+			Kind:   busMessageJoinRoom,
+			RoomId: room.Id,
+			User:   &u,
+		})
+	}
+
+	// The owner instance notifies when it receives the new member
+	if h.ownerOf(room.Id) != h.instanceId {
+		return nil
+	}
+
+	return h.notifyOfNewRoomMember(room)
+}
+
+func (h *Hub) notifyOfNewRoomMember(room *model.Room) error {
 	c, ok := h.userIdToClient.Load(room.HostId)
 	if !ok {
 		return errNotFound
@@ -89,27 +181,102 @@ func (h *Hub) NotifyOfNewRoomMember(room *model.Room) error {
 		return c.server.sendEventErr(err, oapi.WsEventROOMNEWMEMBER)
 	}
 
+	// チーム戦のときは人数の少ないチームに入れる
+	if room.TeamModeEnabled() && len(room.Members) > 0 {
+		room.AddMemberToTeam(room.Members[len(room.Members)-1].Id)
+		if err := c.server.sendRoomUpdateTeamsEvent(); err != nil {
+			return c.server.sendEventErr(err, oapi.WsEventROOMUPDATETEAMS)
+		}
+	}
+
 	return nil
 }
 
+// IsClosing reports whether the hub has started shutting down.
+func (h *Hub) IsClosing() bool {
+	return h.closing.Load()
+}
+
+// Shutdown notifies every room of the maintenance, closes all connections
+// with the "going away" close code and waits for them to be drained.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.closing.Store(true)
+
+	servers := make([]*Server, 0)
+	h.roomIdToServer.Range(func(_ model.RoomId, s *Server) bool {
+		servers = append(servers, s)
+		return true
+	})
+
+	for _, s := range servers {
+		if err := s.sendMaintenanceEvent(); err != nil {
+			logger.Echo.Error(s.sendEventErr(err, oapi.WsEventMAINTENANCE))
+		}
+	}
+
+	clients := make([]*Client, 0)
+	h.userIdToClient.Range(func(_ model.UserId, c *Client) bool {
+		clients = append(clients, c)
+		return true
+	})
+
+	for _, c := range clients {
+		c.closeMsg = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+		h.unregisterCh <- c
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.writePumps.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain connections: %w", ctx.Err())
+	}
+}
+
 func (h *Hub) register(cli *Client) {
 	logger.Echo.Infof("new client(userId:%s) has registered", cli.userId.UUID().String())
+
+	// 再接続したメンバーの代わりに遊んでいたボットを止める
+	if old, ok := h.userIdToClient.Load(cli.userId); ok && old.bot {
+		h.unregister(old)
+	}
+
 	h.userIdToClient.Store(cli.userId, cli)
 }
 
 func (h *Hub) unregister(cli *Client) {
+	// 解除済みのクライアントは何もしない (同じユーザーの新しいクライアントを消さないようにする)
+	if !cli.closeSend() {
+		return
+	}
+
 	logger.Echo.Infof("client(userId:%s) has unregistered", cli.userId.UUID().String())
 
-	close(cli.send)
-	h.userIdToClient.Delete(cli.userId)
+	h.userIdToClient.DeleteIf(cli.userId, func(c *Client) bool { return c == cli })
+
+	if len(cli.owner) > 0 {
+		h.disconnectFromOwner(cli)
+	}
 }
 
-func (h *Hub) addNewClient(userId model.UserId, conn *websocket.Conn) (*Client, error) {
+func (h *Hub) addNewClient(userId model.UserId, conn *websocket.Conn, lang errcode.Lang, version int, features featureSet) (*Client, error) {
 	cli, err := NewClient(h, userId, conn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new client: %w", err)
 	}
 
+	cli.lang = lang
+	cli.protocolVersion = version
+	cli.features = features
+	cli.codec = codecOf(features)
+	cli.batchWindow = h.batchWindow
+
 	h.registerCh <- cli
 
 	return cli, nil
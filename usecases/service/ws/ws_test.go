@@ -0,0 +1,253 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/21hack02win/nascalay-backend/interfaces/broker"
+	"github.com/21hack02win/nascalay-backend/interfaces/repository"
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/21hack02win/nascalay-backend/oapi"
+	usecasesbroker "github.com/21hack02win/nascalay-backend/usecases/broker"
+	usecases "github.com/21hack02win/nascalay-backend/usecases/repository"
+	"github.com/21hack02win/nascalay-backend/util/canvas"
+	"github.com/21hack02win/nascalay-backend/util/logger"
+	"github.com/gofrs/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMain(m *testing.M) {
+	// main() の代わりにロガーを設定する
+	e := echo.New()
+	e.Logger.SetOutput(io.Discard)
+	logger.Echo = e.Logger
+
+	os.Exit(m.Run())
+}
+
+// eventually waits until cond reports true.
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestHub(t *testing.T, br usecasesbroker.Broker) *Hub {
+	t.Helper()
+
+	h, err := InitHub(repository.NewRepository(), br, 0, ImageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+// newTestRoom creates a room owned by the hub and waits until the other hubs replicate it.
+func newTestRoom(t *testing.T, owner *Hub, others ...*Hub) *model.Room {
+	t.Helper()
+
+	room, err := owner.repo.CreateRoom(&usecases.CreateRoomArgs{
+		Capacity: 8,
+		Username: "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner.NotifyOfNewRoom(room)
+	for _, h := range others {
+		eventually(t, "the room is replicated", func() bool {
+			_, ok := h.roomIdToOwner.Load(room.Id)
+			return ok
+		})
+	}
+
+	return room
+}
+
+// joinTestRoom adds a member to the room and returns the id.
+func joinTestRoom(t *testing.T, h *Hub, room *model.Room, name string) model.UserId {
+	t.Helper()
+
+	_, uid, err := h.repo.JoinRoom(&usecases.JoinRoomArgs{
+		RoomId:   room.Id,
+		Username: model.Username(name),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return uid
+}
+
+// newTestClient registers a client without a connection, which drops the messages sent to it.
+func newTestClient(t *testing.T, h *Hub, uid model.UserId) *Client {
+	t.Helper()
+
+	c, err := NewClient(h, uid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.register(c)
+	go func() {
+		for range c.send {
+		}
+	}()
+	t.Cleanup(func() { h.unregister(c) })
+
+	return c
+}
+
+// newRecordingClient registers a client without a connection, which keeps the messages sent to it.
+func newRecordingClient(t *testing.T, h *Hub, uid model.UserId) (*Client, <-chan *oapi.WsSendMessage) {
+	t.Helper()
+
+	c, err := NewClient(h, uid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.register(c)
+	msgs := make(chan *oapi.WsSendMessage, 1024)
+	go func() {
+		for msg := range c.send {
+			select {
+			case msgs <- msg:
+			default:
+			}
+		}
+	}()
+	t.Cleanup(func() { h.unregister(c) })
+
+	return c, msgs
+}
+
+// request calls the event handler as if the client sent the event.
+func request(t *testing.T, c *Client, event oapi.WsEvent, body interface{}) error {
+	t.Helper()
+
+	buf, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.callEventHandler(&oapi.WsJSONRequestBody{Type: event, Body: buf})
+}
+
+// testDrawing returns a transparent drawing of the size of the board.
+func testDrawing(t *testing.T, boardName string) string {
+	t.Helper()
+
+	size, err := canvas.BoardSize(boardName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b64, err := canvas.EncodeImage(image.NewRGBA(image.Rectangle{Max: size}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return imgPrefix + b64
+}
+
+func TestShutdown(t *testing.T) {
+	h := newTestHub(t, broker.NewLocalBroker())
+	room := newTestRoom(t, h)
+	guestId := joinTestRoom(t, h, room, "guest")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid := model.UserId(uuid.FromStringOrNil(r.URL.Query().Get("user")))
+		if err := h.ServeWS(w, r, uid, Handshake{}); errors.Is(err, errServerClosing) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	dial := func(uid model.UserId) (*websocket.Conn, error) {
+		url := "ws" + strings.TrimPrefix(srv.URL, "http") + "?user=" + uid.UUID().String()
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		return conn, err
+	}
+
+	conns := make([]*websocket.Conn, 0, 2)
+	for _, uid := range []model.UserId{room.HostId, guestId} {
+		conn, err := dial(uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	eventually(t, "the clients are registered", func() bool {
+		_, host := h.userIdToClient.Load(room.HostId)
+		_, guest := h.userIdToClient.Load(guestId)
+		return host && guest
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		maintenance := false
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+					t.Errorf("client %d: connection closed with %v, want %d (going away)", i, err, websocket.CloseGoingAway)
+				}
+				break
+			}
+
+			msg := new(oapi.WsSendMessage)
+			if err := json.Unmarshal(data, msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Type == oapi.WsEventMAINTENANCE {
+				maintenance = true
+			}
+		}
+		if !maintenance {
+			t.Errorf("client %d: closed without MAINTENANCE", i)
+		}
+	}
+
+	// 停止中は新しい接続もゲームの進行も受け付けない
+	if _, err := dial(joinTestRoom(t, h, room, "late")); err == nil {
+		t.Error("a new connection is accepted during the shutdown")
+	}
+
+	s, ok := h.roomIdToServer.Load(room.Id)
+	if !ok {
+		t.Fatal("the server of the room is not found")
+	}
+	if err := s.transit(model.GameStatusOdai); !errors.Is(err, errServerClosing) {
+		t.Errorf("transit() error = %v during the shutdown, want %v", err, errServerClosing)
+	}
+	if !h.IsClosing() {
+		t.Error("IsClosing() = false, which makes the handlers accept new rooms and joins")
+	}
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+var ErrNotFound = errors.New("image not found")
+
+// ImageStore keeps the images which the clients fetch by URL.
+// Images are saved by the hash of their content, so saving the same image again only keeps it longer.
+type ImageStore interface {
+	// Put saves the image and returns its key.
+	Put(data []byte) (key string, err error)
+	// Get returns the image of the key or ErrNotFound.
+	Get(key string) ([]byte, error)
+}
+
+// KeyOf returns the key of the image, which is the hex encoded SHA-256 of the content.
+func KeyOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// IsKey reports whether the string can be a key returned by KeyOf.
+// ファイル名に使うので，それ以外の文字を含むキーは受け付けない
+func IsKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+
+	for _, r := range key {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
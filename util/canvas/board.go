@@ -0,0 +1,147 @@
+package canvas
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+)
+
+// Size in pixels of the canvas of the grid boards.
+// 描いた絵はこの大きさにそろえて保存する
+const (
+	GridWidth  = 640
+	GridHeight = 480
+)
+
+// Board is the layout of the areas on a canvas.
+type Board interface {
+	// AreaNum returns the number of the areas.
+	AreaNum() int
+	// Size returns the size in pixels of the canvas of the board.
+	Size() image.Point
+	// Area returns the smallest rectangle containing the area on the canvas of the bounds
+	// and the mask which is opaque inside the area.
+	Area(bounds image.Rectangle, areaId int) (image.Rectangle, image.Image, error)
+	// Neighbors returns the areas next to the area.
+	Neighbors(areaId int) []int
+	// Region returns the geometry of the area sent to the clients, or nil when the board name tells it.
+	Region(areaId int) *Region
+}
+
+// Region is the geometry of an area of a board defined by masks.
+// 位置と大きさはキャンバスに対する割合
+type Region struct {
+	X, Y, Width, Height float64
+	// Mask is a base64 encoded PNG of the bounding rectangle which is opaque inside the area.
+	Mask string
+}
+
+var (
+	boardsMux sync.RWMutex
+	boards    = map[string]Board{
+		"4x4": gridBoard{cols: 4, rows: 4},
+		"5x5": gridBoard{cols: 5, rows: 5},
+		"4x3": gridBoard{cols: 4, rows: 3},
+		"1x1": gridBoard{cols: 1, rows: 1},
+	}
+)
+
+// BoardOf returns the registered board of the name.
+func BoardOf(boardName string) (Board, error) {
+	boardsMux.RLock()
+	defer boardsMux.RUnlock()
+
+	b, ok := boards[strings.Replace(boardName, "×", "x", 1)]
+	if !ok {
+		return nil, fmt.Errorf("unknown board: %s", boardName)
+	}
+
+	return b, nil
+}
+
+// IsGridBoard reports whether the board is a grid which the clients can split by its name.
+func IsGridBoard(boardName string) bool {
+	b, err := BoardOf(boardName)
+	if err != nil {
+		return false
+	}
+
+	_, ok := b.(gridBoard)
+
+	return ok
+}
+
+func registerBoard(name string, b Board) error {
+	boardsMux.Lock()
+	defer boardsMux.Unlock()
+
+	if _, ok := boards[name]; ok {
+		return fmt.Errorf("board %s already exists", name)
+	}
+	boards[name] = b
+
+	return nil
+}
+
+// AreaRect returns the rectangle containing the area on the board.
+func AreaRect(bounds image.Rectangle, boardName string, areaId int) (image.Rectangle, error) {
+	b, err := BoardOf(boardName)
+	if err != nil {
+		return image.Rectangle{}, err
+	}
+
+	rect, _, err := b.Area(bounds, areaId)
+
+	return rect, err
+}
+
+// gridBoard is a board such as "4x3" (columns x rows).
+type gridBoard struct {
+	cols, rows int
+}
+
+func (g gridBoard) AreaNum() int {
+	return g.cols * g.rows
+}
+
+// Size returns the size of the canvas of the grid boards, since the grid can be split at any size.
+func (gridBoard) Size() image.Point {
+	return image.Pt(GridWidth, GridHeight)
+}
+
+func (g gridBoard) Area(bounds image.Rectangle, areaId int) (image.Rectangle, image.Image, error) {
+	if areaId < 0 || g.AreaNum() <= areaId {
+		return image.Rectangle{}, nil, fmt.Errorf("area %d is out of the board %dx%d", areaId, g.cols, g.rows)
+	}
+
+	w, h := bounds.Dx(), bounds.Dy()
+	col, row := areaId%g.cols, areaId/g.cols
+
+	return image.Rect(
+		bounds.Min.X+w*col/g.cols,
+		bounds.Min.Y+h*row/g.rows,
+		bounds.Min.X+w*(col+1)/g.cols,
+		bounds.Min.Y+h*(row+1)/g.rows,
+	), image.Opaque, nil
+}
+
+// Neighbors returns the areas around the area including the diagonal ones.
+func (g gridBoard) Neighbors(areaId int) []int {
+	col, row := areaId%g.cols, areaId/g.cols
+	neighbors := make([]int, 0, 8)
+	for r := row - 1; r <= row+1; r++ {
+		for c := col - 1; c <= col+1; c++ {
+			if (r == row && c == col) || r < 0 || g.rows <= r || c < 0 || g.cols <= c {
+				continue
+			}
+			neighbors = append(neighbors, r*g.cols+c)
+		}
+	}
+
+	return neighbors
+}
+
+func (gridBoard) Region(int) *Region {
+	return nil
+}
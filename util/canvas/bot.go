@@ -0,0 +1,180 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+	"strings"
+)
+
+// DrawStyle is the way a bot fills its area.
+type DrawStyle int
+
+const (
+	DrawStyleShapes  DrawStyle = iota // 円と四角を並べる
+	DrawStyleStrokes                  // ランダムな線を引く
+	DrawStyleEdges                    // 隣のエリアの端の色を引き伸ばす
+	drawStyleLimit
+)
+
+func RandDrawStyle(rng *rand.Rand) DrawStyle {
+	return DrawStyle(rng.Intn(int(drawStyleLimit)))
+}
+
+// DecodeImage decodes a base64 encoded image with or without the data URL prefix.
+func DecodeImage(b64 string) (image.Image, error) {
+	b64 = b64[strings.IndexByte(b64, ',')+1:]
+	img, _, err := image.Decode(base64.NewDecoder(base64.StdEncoding, strings.NewReader(b64)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	return img, nil
+}
+
+// DrawArea draws procedural content into the area and returns it as a base64 encoded PNG.
+// The result is transparent outside of the area so that it can be drawn over the drawing so far.
+// prev は隣のエリアの色を参照するために使う (nilでもよい)
+func DrawArea(rng *rand.Rand, style DrawStyle, bounds image.Rectangle, area image.Rectangle, prev image.Image) (string, error) {
+	img := image.NewRGBA(bounds)
+
+	switch style {
+	case DrawStyleShapes:
+		drawShapes(rng, img, area)
+	case DrawStyleStrokes:
+		drawStrokes(rng, img, area)
+	case DrawStyleEdges:
+		if prev == nil || !drawEdges(rng, img, area, prev) {
+			drawStrokes(rng, img, area)
+		}
+	default:
+		return "", fmt.Errorf("unknown draw style: %d", style)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return "", fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func randColor(rng *rand.Rand) color.RGBA {
+	return color.RGBA{
+		R: uint8(rng.Intn(256)),
+		G: uint8(rng.Intn(256)),
+		B: uint8(rng.Intn(256)),
+		A: 0xff,
+	}
+}
+
+func drawShapes(rng *rand.Rand, img *image.RGBA, area image.Rectangle) {
+	draw.Draw(img, area, image.NewUniform(randColor(rng)), image.Point{}, draw.Src)
+
+	size := area.Dx()
+	if area.Dy() < size {
+		size = area.Dy()
+	}
+
+	for i := 0; i < 2+rng.Intn(4); i++ {
+		r := 1 + rng.Intn(size/4+1)
+		cx := area.Min.X + rng.Intn(area.Dx())
+		cy := area.Min.Y + rng.Intn(area.Dy())
+		c := randColor(rng)
+
+		if rng.Intn(2) == 0 {
+			fillCircle(img, area, cx, cy, r, c)
+		} else {
+			rect := image.Rect(cx-r, cy-r, cx+r, cy+r).Intersect(area)
+			draw.Draw(img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+		}
+	}
+}
+
+func drawStrokes(rng *rand.Rand, img *image.RGBA, area image.Rectangle) {
+	if area.Empty() {
+		return
+	}
+
+	for i := 0; i < 1+rng.Intn(3); i++ {
+		c := randColor(rng)
+		width := 1 + rng.Intn(4)
+		x := area.Min.X + rng.Intn(area.Dx())
+		y := area.Min.Y + rng.Intn(area.Dy())
+
+		for j := 0; j < area.Dx()+area.Dy(); j++ {
+			fillCircle(img, area, x, y, width, c)
+			x += rng.Intn(5) - 2
+			y += rng.Intn(5) - 2
+			x = clamp(x, area.Min.X, area.Max.X-1)
+			y = clamp(y, area.Min.Y, area.Max.Y-1)
+		}
+	}
+}
+
+// drawEdges smears the colors on the borders of the neighbor areas into the area.
+// 隣のエリアに何も描かれていなければ false を返す
+func drawEdges(rng *rand.Rand, img *image.RGBA, area image.Rectangle, prev image.Image) bool {
+	b := prev.Bounds()
+	drawn := false
+
+	smear := func(x, y, dx, dy int) {
+		if !(image.Point{x, y}).In(b) {
+			return
+		}
+
+		c := color.RGBAModel.Convert(prev.At(x, y)).(color.RGBA)
+		if c.A == 0 {
+			return
+		}
+
+		drawn = true
+		depth := 1 + rng.Intn(area.Dx()/2+area.Dy()/2+1)
+		for i := 1; i <= depth; i++ {
+			p := image.Point{x + dx*i, y + dy*i}
+			if !p.In(area) {
+				break
+			}
+			img.SetRGBA(p.X, p.Y, c)
+		}
+	}
+
+	for x := area.Min.X; x < area.Max.X; x++ {
+		smear(x, area.Min.Y-1, 0, 1)
+		smear(x, area.Max.Y, 0, -1)
+	}
+
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		smear(area.Min.X-1, y, 1, 0)
+		smear(area.Max.X, y, -1, 0)
+	}
+
+	return drawn
+}
+
+func fillCircle(img *image.RGBA, clip image.Rectangle, cx, cy, r int, c color.RGBA) {
+	for y := cy - r; y <= cy+r; y++ {
+		for x := cx - r; x <= cx+r; x++ {
+			if (x-cx)*(x-cx)+(y-cy)*(y-cy) <= r*r && (image.Point{x, y}).In(clip) {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+
+	if v > max {
+		return max
+	}
+
+	return v
+}
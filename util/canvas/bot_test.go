@@ -0,0 +1,71 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+func TestDrawArea(t *testing.T) {
+	bounds := image.Rect(0, 0, GridWidth, GridHeight)
+
+	// 隣のエリアに色がある絵 (DrawStyleEdges が引き伸ばす)
+	prev := image.NewRGBA(bounds)
+	draw.Draw(prev, bounds, image.NewUniform(color.RGBA{0x20, 0x80, 0x40, 0xff}), image.Point{}, draw.Src)
+
+	tests := []struct {
+		name string
+		area int
+		prev image.Image
+	}{
+		{name: "corner", area: 0},
+		{name: "edge", area: 7},
+		{name: "inside", area: 5},
+		{name: "corner over the drawing", area: 15, prev: prev},
+		{name: "inside over the drawing", area: 10, prev: prev},
+	}
+	for style := DrawStyle(0); style < drawStyleLimit; style++ {
+		for _, tt := range tests {
+			area, err := AreaRect(bounds, "4x4", tt.area)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for seed := int64(0); seed < 5; seed++ {
+				b64, err := DrawArea(rand.New(rand.NewSource(seed)), style, bounds, area, tt.prev)
+				if err != nil {
+					t.Fatalf("style %d, %s: DrawArea() error = %v", style, tt.name, err)
+				}
+
+				// ボットの絵もクライアントの絵と同じ検証を通る
+				img, err := DecodeDrawing(b64, "4x4")
+				if err != nil {
+					t.Fatalf("style %d, %s: DecodeDrawing() error = %v", style, tt.name, err)
+				}
+
+				painted := 0
+				b := img.Bounds()
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						if _, _, _, a := img.At(x, y).RGBA(); a == 0 {
+							continue
+						}
+						if !(image.Point{x, y}).In(area) {
+							t.Fatalf("style %d, %s: pixel (%d, %d) outside the area %v is painted", style, tt.name, x, y, area)
+						}
+						painted++
+					}
+				}
+				if painted == 0 {
+					t.Errorf("style %d, %s: nothing is painted", style, tt.name)
+				}
+			}
+		}
+	}
+
+	if _, err := DrawArea(rand.New(rand.NewSource(1)), drawStyleLimit, bounds, bounds, nil); err == nil {
+		t.Error("DrawArea() with an unknown style error = nil")
+	}
+}
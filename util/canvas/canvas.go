@@ -5,30 +5,30 @@ import (
 	"encoding/base64"
 	"fmt"
 	"image"
-	"image/draw"
 	"image/png"
-	"strings"
 )
 
-func MergeImage(a string, b string) (string, error) {
-	reader := base64.NewDecoder(base64.StdEncoding, strings.NewReader(a))
-	ai, _, err := image.Decode(reader)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode image: %w", err)
-	}
-	reader = base64.NewDecoder(base64.StdEncoding, strings.NewReader(b))
-	bi, _, err := image.Decode(reader)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode image: %w", err)
-	}
-	rect := image.Rectangle{image.Point{0, 0}, ai.Bounds().Size()}
-	rgba := image.NewRGBA(rect)
-	draw.Draw(rgba, rect, ai, image.Point{0, 0}, draw.Src)
-	draw.Draw(rgba, rect, bi, image.Point{0, 0}, draw.Over)
+// EncodeImage encodes the image as a base64 encoded PNG.
+func EncodeImage(img image.Image) (string, error) {
 	buf := new(bytes.Buffer)
-	err = png.Encode(buf, rgba)
-	if err != nil {
+	if err := png.Encode(buf, img); err != nil {
 		return "", fmt.Errorf("failed to encode image: %w", err)
 	}
+
 	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
 }
+
+// ClipArea makes the image transparent outside of the area on the board.
+// 名前で分け方がわかるグリッドのボードでは，これまでどおり切り抜かずにそのまま返す
+func ClipArea(img image.Image, boardName string, areaId int) (image.Image, error) {
+	b, err := BoardOf(boardName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := b.(gridBoard); ok {
+		return img, nil
+	}
+
+	return MaskImage(img, boardName, []int{areaId})
+}
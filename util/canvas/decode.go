@@ -0,0 +1,86 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+)
+
+// Errors of decoding the images sent by the clients.
+var (
+	ErrInvalidImage      = errors.New("invalid image")
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrImageTooLarge     = errors.New("image is too large")
+)
+
+// maxDrawingScale is how many times larger than the canvas of the board a drawing can be.
+// 高解像度の画面で描いた絵は受け付けつつ，小さな PNG に巨大な大きさを書いて展開させるものは弾く
+const maxDrawingScale = 2
+
+// DecodeDrawing decodes a base64 encoded PNG drawn on the board, with or without the data URL prefix,
+// and returns it in the size of the canvas of the board.
+// 大きさが違うときは，エリアの位置がずれないように縦横それぞれ伸縮する
+func DecodeDrawing(b64 string, boardName string) (image.Image, error) {
+	size, err := BoardSize(boardName)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeLimited(b64[strings.IndexByte(b64, ',')+1:], size.Mul(maxDrawingScale), "png")
+	if err != nil {
+		return nil, err
+	}
+
+	if img.Bounds().Size() == size {
+		return img, nil
+	}
+
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+	resample(dst, dst.Bounds(), img)
+
+	return dst, nil
+}
+
+// decodeLimited decodes a base64 encoded image after checking its format and size with image.DecodeConfig,
+// so that the decoder never allocates the pixels of an image larger than maxSize.
+func decodeLimited(b64 string, maxSize image.Point, formats ...string) (image.Image, error) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupportedFormat
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+
+	if !slices.Contains(formats, format) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("%w: empty image", ErrInvalidImage)
+	}
+
+	if maxSize.X < cfg.Width || maxSize.Y < cfg.Height {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %dx%d", ErrImageTooLarge, cfg.Width, cfg.Height, maxSize.X, maxSize.Y)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+	}
+
+	// ヘッダーと違う大きさの画像は信用しない
+	if img.Bounds().Dx() != cfg.Width || img.Bounds().Dy() != cfg.Height {
+		return nil, fmt.Errorf("%w: size differs from the header", ErrInvalidImage)
+	}
+
+	return img, nil
+}
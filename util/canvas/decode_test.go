@@ -0,0 +1,231 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testPNG(tb testing.TB, w, h int) []byte {
+	tb.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		tb.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// headerPNG returns a PNG which only has the header declaring the size, like the ones sent to exhaust memory.
+func headerPNG(w, h uint32) []byte {
+	chunk := func(typ string, data []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		b = append(b, typ...)
+		b = append(b, data...)
+		return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+	}
+
+	ihdr := binary.BigEndian.AppendUint32(nil, w)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, h)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0) // 8bit RGBA
+
+	b := []byte("\x89PNG\r\n\x1a\n")
+	b = append(b, chunk("IHDR", ihdr)...)
+	return append(b, chunk("IEND", nil)...)
+}
+
+func testJPEG(tb testing.TB) []byte {
+	tb.Helper()
+
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		tb.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func testGIF(tb testing.TB) []byte {
+	tb.Helper()
+
+	buf := new(bytes.Buffer)
+	if err := gif.Encode(buf, image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.Black}), nil); err != nil {
+		tb.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func isDecodeError(err error) bool {
+	return errors.Is(err, ErrInvalidImage) || errors.Is(err, ErrUnsupportedFormat) || errors.Is(err, ErrImageTooLarge)
+}
+
+func TestDecodeDrawing(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+	valid := testPNG(t, GridWidth, GridHeight)
+
+	tests := []struct {
+		name    string
+		b64     string
+		wantErr error
+	}{
+		{name: "same size", b64: b64(valid)},
+		{name: "data URL", b64: "data:image/png;base64," + b64(valid)},
+		{name: "smaller", b64: b64(testPNG(t, 64, 48))},
+		{name: "high DPI", b64: b64(testPNG(t, GridWidth*2, GridHeight*2))},
+		{name: "wide", b64: b64(testPNG(t, 1280, 720))},
+		{name: "tall", b64: b64(testPNG(t, 480, 640))},
+		{name: "square", b64: b64(testPNG(t, 500, 500))},
+		{name: "too large", b64: b64(headerPNG(GridWidth*2+1, GridHeight)), wantErr: ErrImageTooLarge},
+		{name: "huge header", b64: b64(headerPNG(100000, 100000)), wantErr: ErrImageTooLarge},
+		{name: "empty header", b64: b64(headerPNG(0, 0)), wantErr: ErrInvalidImage},
+		{name: "no pixels", b64: b64(headerPNG(8, 8)), wantErr: ErrInvalidImage},
+		{name: "truncated", b64: b64(valid[:len(valid)/2]), wantErr: ErrInvalidImage},
+		{name: "jpeg", b64: b64(testJPEG(t)), wantErr: ErrUnsupportedFormat},
+		{name: "gif", b64: b64(testGIF(t)), wantErr: ErrUnsupportedFormat},
+		{name: "not an image", b64: b64([]byte("hello")), wantErr: ErrUnsupportedFormat},
+		{name: "not base64", b64: "!!!", wantErr: ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := DecodeDrawing(tt.b64, "4x4")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DecodeDrawing() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("DecodeDrawing() error = %v", err)
+			}
+			if got := img.Bounds().Size(); got != image.Pt(GridWidth, GridHeight) {
+				t.Errorf("DecodeDrawing() size = %v, want %dx%d", got, GridWidth, GridHeight)
+			}
+		})
+	}
+}
+
+func TestDecodeDrawingStretch(t *testing.T) {
+	// 16:9 の画面で描いた絵の左上のエリアだけを塗る
+	const w, h = 1280, 720
+	red := color.NRGBA{0xff, 0, 0, 0xff}
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h/4; y++ {
+		for x := 0; x < w/4; x++ {
+			src.SetNRGBA(x, y, red)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := DecodeDrawing(base64.StdEncoding.EncodeToString(buf.Bytes()), "4x4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 縦横それぞれ伸縮するので，塗ったところは 4x4 のエリア 0 に収まる
+	tests := []struct {
+		p       image.Point
+		painted bool
+	}{
+		{p: image.Pt(0, 0), painted: true},
+		{p: image.Pt(GridWidth/4-2, GridHeight/4-2), painted: true},
+		{p: image.Pt(GridWidth/4+2, GridHeight/8), painted: false},
+		{p: image.Pt(GridWidth/8, GridHeight/4+2), painted: false},
+		{p: image.Pt(GridWidth-1, GridHeight-1), painted: false},
+	}
+	for _, tt := range tests {
+		_, _, _, a := img.At(tt.p.X, tt.p.Y).RGBA()
+		if painted := a != 0; painted != tt.painted {
+			t.Errorf("pixel %v painted = %v, want %v", tt.p, painted, tt.painted)
+		}
+	}
+}
+
+func TestNormalizeTemplateLimits(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+
+	if _, err := NormalizeTemplate(b64(testJPEG(t)), "4x4"); err != nil {
+		t.Errorf("NormalizeTemplate(jpeg) error = %v", err)
+	}
+
+	// 上限はボードのキャンバスの大きさから決まる
+	for _, boardName := range []string{"4x4", "hex19", "puzzle9"} {
+		size, err := BoardSize(boardName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		side := uint32(max(size.X, size.Y) * maxTemplateScale)
+		for _, s := range [][2]uint32{{side + 1, 1}, {1, side + 1}, {4096, 4096}} {
+			if _, err := NormalizeTemplate(b64(headerPNG(s[0], s[1])), boardName); !errors.Is(err, ErrImageTooLarge) {
+				t.Errorf("NormalizeTemplate(%dx%d on %s) error = %v, want %v", s[0], s[1], boardName, err, ErrImageTooLarge)
+			}
+		}
+		if _, err := NormalizeTemplate(b64(headerPNG(side, side)), boardName); errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("NormalizeTemplate(%dx%d on %s) error = %v, want it within the limit", side, side, boardName, err)
+		}
+	}
+
+	if _, err := NormalizeTemplate(b64(testGIF(t)), "4x4"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("NormalizeTemplate(gif) error = %v, want %v", err, ErrUnsupportedFormat)
+	}
+}
+
+func FuzzDecodeDrawing(f *testing.F) {
+	f.Add(testPNG(f, 16, 12))
+	f.Add(testPNG(f, GridWidth, GridHeight))
+	f.Add(headerPNG(1<<20, 1<<20))
+	f.Add(headerPNG(GridWidth, GridHeight))
+	f.Add(testJPEG(f))
+	f.Add(testGIF(f))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img, err := DecodeDrawing(base64.StdEncoding.EncodeToString(data), "4x4")
+		if err != nil {
+			if !isDecodeError(err) {
+				t.Fatalf("DecodeDrawing() error = %v, want a decode error", err)
+			}
+			return
+		}
+
+		if got := img.Bounds().Size(); got != image.Pt(GridWidth, GridHeight) {
+			t.Fatalf("DecodeDrawing() size = %v, want %dx%d", got, GridWidth, GridHeight)
+		}
+	})
+}
+
+func FuzzNormalizeTemplate(f *testing.F) {
+	f.Add(testPNG(f, 16, 12))
+	f.Add(headerPNG(1<<20, 1<<20))
+	f.Add(testJPEG(f))
+	f.Add(testGIF(f))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, err := NormalizeTemplate(base64.StdEncoding.EncodeToString(data), "4x4")
+		if err != nil && !isDecodeError(err) {
+			t.Fatalf("NormalizeTemplate() error = %v, want a decode error", err)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package canvas
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// NeighborAreas returns the areas within the radius of the area on the board, including the area itself.
+// グリッドでは斜めも 1 マスと数える (チェビシェフ距離)
+func NeighborAreas(boardName string, areaId int, radius int) ([]int, error) {
+	b, err := BoardOf(boardName)
+	if err != nil {
+		return nil, err
+	}
+
+	if areaId < 0 || b.AreaNum() <= areaId {
+		return nil, fmt.Errorf("area %d is out of the board %s", areaId, boardName)
+	}
+
+	if radius < 0 {
+		return nil, fmt.Errorf("invalid radius: %d", radius)
+	}
+
+	// 隣のエリアをたどって radius 回まで広げる
+	seen := map[int]bool{areaId: true}
+	frontier := []int{areaId}
+	for d := 0; d < radius && len(frontier) > 0; d++ {
+		next := make([]int, 0)
+		for _, a := range frontier {
+			for _, n := range b.Neighbors(a) {
+				if !seen[n] {
+					seen[n] = true
+					next = append(next, n)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	areas := make([]int, 0, len(seen))
+	for a := 0; a < b.AreaNum(); a++ {
+		if seen[a] {
+			areas = append(areas, a)
+		}
+	}
+
+	return areas, nil
+}
+
+// MaskImage makes the image transparent except for the areas on the board.
+// 画像の大きさは変えないので，クライアントはそのまま重ねて表示できる
+func MaskImage(src image.Image, boardName string, areaIds []int) (*image.RGBA, error) {
+	b, err := BoardOf(boardName)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	dst := image.NewRGBA(bounds)
+	for _, id := range areaIds {
+		rect, mask, err := b.Area(bounds, id)
+		if err != nil {
+			return nil, err
+		}
+		draw.DrawMask(dst, rect, src, rect.Min, mask, rect.Min, draw.Over)
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,164 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"github.com/21hack02win/nascalay-backend/model"
+)
+
+func allAreas(n int) []int {
+	areas := make([]int, n)
+	for i := range areas {
+		areas[i] = i
+	}
+
+	return areas
+}
+
+func TestNeighborAreas(t *testing.T) {
+	// hex19 は上から 3, 4, 5, 4, 3 個の六角形が並ぶ
+	//     0  1  2
+	//   3  4  5  6
+	//  7  8  9 10 11
+	//   12 13 14 15
+	//     16 17 18
+	tests := []struct {
+		name   string
+		board  string
+		areaId int
+		radius int
+		want   []int
+	}{
+		{name: "grid corner radius 0", board: "4x4", areaId: 0, radius: 0, want: []int{0}},
+		{name: "grid corner radius 1", board: "4x4", areaId: 0, radius: 1, want: []int{0, 1, 4, 5}},
+		{name: "grid edge radius 1", board: "4x4", areaId: 7, radius: 1, want: []int{2, 3, 6, 7, 10, 11}},
+		{name: "grid inside radius 1", board: "5x5", areaId: 12, radius: 1, want: []int{6, 7, 8, 11, 12, 13, 16, 17, 18}},
+		{name: "grid corner radius 3", board: "5x5", areaId: 0, radius: 3, want: []int{0, 1, 2, 3, 5, 6, 7, 8, 10, 11, 12, 13, 15, 16, 17, 18}},
+		{name: "grid corner max radius", board: "5x5", areaId: 0, radius: model.MaxFogRadius, want: allAreas(25)},
+		{name: "grid edge max radius", board: "4x3", areaId: 4, radius: model.MaxFogRadius, want: allAreas(12)},
+		{name: "mask corner radius 0", board: "hex19", areaId: 0, radius: 0, want: []int{0}},
+		{name: "mask corner radius 1", board: "hex19", areaId: 0, radius: 1, want: []int{0, 1, 3, 4}},
+		{name: "mask edge radius 1", board: "hex19", areaId: 7, radius: 1, want: []int{3, 7, 8, 12}},
+		{name: "mask center radius 1", board: "hex19", areaId: 9, radius: 1, want: []int{4, 5, 8, 9, 10, 13, 14}},
+		{name: "mask corner max radius", board: "hex19", areaId: 18, radius: model.MaxFogRadius, want: allAreas(19)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NeighborAreas(tt.board, tt.areaId, tt.radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NeighborAreas(%s, %d, %d) = %v, want %v", tt.board, tt.areaId, tt.radius, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeighborAreasMaxRadius(t *testing.T) {
+	// MaxFogRadius ならどのボードのどのエリアからでも全体が見える
+	for _, name := range []string{"4x4", "5x5", "4x3", "hex19", "rings13", "puzzle9"} {
+		b, err := BoardOf(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for a := 0; a < b.AreaNum(); a++ {
+			got, err := NeighborAreas(name, a, model.MaxFogRadius)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != b.AreaNum() {
+				t.Errorf("NeighborAreas(%s, %d, MaxFogRadius) has %d areas, want %d", name, a, len(got), b.AreaNum())
+			}
+		}
+	}
+}
+
+func TestNeighborAreasInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		board  string
+		areaId int
+		radius int
+	}{
+		{name: "unknown board", board: "3x7", areaId: 0, radius: 1},
+		{name: "negative area", board: "4x4", areaId: -1, radius: 1},
+		{name: "area out of the board", board: "hex19", areaId: 19, radius: 1},
+		{name: "negative radius", board: "4x4", areaId: 0, radius: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NeighborAreas(tt.board, tt.areaId, tt.radius); err == nil {
+				t.Error("NeighborAreas() error = nil")
+			}
+		})
+	}
+}
+
+func TestMaskImage(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	src := image.NewRGBA(image.Rect(0, 0, GridWidth, GridHeight))
+	draw.Draw(src, src.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+
+	tests := []struct {
+		name    string
+		board   string
+		areaIds []int
+		visible []image.Point
+		hidden  []image.Point
+	}{
+		{
+			name:    "grid",
+			board:   "4x4",
+			areaIds: []int{0, 5},
+			// 1マスは 160x120
+			visible: []image.Point{{0, 0}, {159, 119}, {200, 150}, {319, 239}},
+			hidden:  []image.Point{{160, 0}, {0, 120}, {320, 240}, {639, 479}, {480, 60}},
+		},
+		{
+			name:    "grid without areas",
+			board:   "4x4",
+			areaIds: []int{},
+			hidden:  []image.Point{{0, 0}, {320, 240}, {639, 479}},
+		},
+		{
+			name:    "mask",
+			board:   "hex19",
+			areaIds: []int{9},
+			visible: []image.Point{{320, 240}, {270, 240}},
+			// エリアを囲む長方形の角は隣のエリアなので見えない
+			hidden: []image.Point{{270, 185}, {216, 60}, {10, 10}, {420, 240}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masked, err := MaskImage(src, tt.board, tt.areaIds)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if masked.Bounds() != src.Bounds() {
+				t.Fatalf("MaskImage() bounds = %v, want %v", masked.Bounds(), src.Bounds())
+			}
+
+			for _, p := range tt.visible {
+				if got := masked.RGBAAt(p.X, p.Y); got != red {
+					t.Errorf("pixel %v = %v, want %v", p, got, red)
+				}
+			}
+			for _, p := range tt.hidden {
+				if got := masked.RGBAAt(p.X, p.Y); got.A != 0 {
+					t.Errorf("pixel %v = %v outside the areas, want transparent", p, got)
+				}
+			}
+		})
+	}
+
+	if _, err := MaskImage(src, "4x4", []int{16}); err == nil {
+		t.Error("MaskImage() with an area out of the board error = nil")
+	}
+}
@@ -0,0 +1,338 @@
+package canvas
+
+import (
+	"bytes"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Limits of the boards defined by masks.
+const (
+	maxBoardSize  = 2048
+	maxRegionNum  = 64
+	maxPolygonLen = 1024
+)
+
+//go:embed boards
+var builtinBoards embed.FS
+
+func init() {
+	sub, err := fs.Sub(builtinBoards, "boards")
+	if err != nil {
+		panic(err)
+	}
+
+	if err := LoadBoards(sub); err != nil {
+		panic(fmt.Sprintf("failed to load builtin boards: %v", err))
+	}
+}
+
+// LoadBoards registers the boards defined by the files in fsys.
+// ファイル名 (拡張子を除く) がボード名になる
+//   - .json: エリアごとの多角形 (jsonBoard を参照)
+//   - .png: 色ごとのエリア (透明な部分はどのエリアでもない)
+func LoadBoards(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("failed to read boards: %w", err)
+	}
+
+	for _, e := range entries {
+		ext := path.Ext(e.Name())
+		if e.IsDir() || (ext != ".json" && ext != ".png") {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read board %s: %w", e.Name(), err)
+		}
+
+		var b *maskBoard
+		if ext == ".json" {
+			b, err = parseJSONBoard(data)
+		} else {
+			b, err = parseImageBoard(data)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid board %s: %w", e.Name(), err)
+		}
+
+		if err := registerBoard(strings.TrimSuffix(e.Name(), ext), b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jsonBoard is the definition of a board by polygons.
+// 座標は width x height のボード上のピクセルで，エリアの多角形は偶奇規則で塗る (穴のあるエリアも書ける)
+type jsonBoard struct {
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	Regions []struct {
+		Polygons [][][2]float64 `json:"polygons"`
+	} `json:"regions"`
+}
+
+func parseJSONBoard(data []byte) (*maskBoard, error) {
+	var def jsonBoard
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+
+	if err := checkBoardSize(def.Width, def.Height, len(def.Regions)); err != nil {
+		return nil, err
+	}
+
+	labels := newLabels(def.Width, def.Height)
+	for id, r := range def.Regions {
+		for _, p := range r.Polygons {
+			if len(p) < 3 || maxPolygonLen < len(p) {
+				return nil, fmt.Errorf("polygon of region %d must have 3 to %d points", id, maxPolygonLen)
+			}
+		}
+
+		// ピクセルの中心が多角形の中にあるかで塗る．重なったところは先のエリアにする
+		for y := 0; y < def.Height; y++ {
+			for x := 0; x < def.Width; x++ {
+				i := y*def.Width + x
+				if labels[i] < 0 && insidePolygons(r.Polygons, float64(x)+0.5, float64(y)+0.5) {
+					labels[i] = int16(id)
+				}
+			}
+		}
+	}
+
+	return newMaskBoard(def.Width, def.Height, labels, len(def.Regions))
+}
+
+// insidePolygons reports whether the point is inside the polygons by the even-odd rule.
+func insidePolygons(polygons [][][2]float64, x, y float64) bool {
+	inside := false
+	for _, p := range polygons {
+		for i, j := 0, len(p)-1; i < len(p); j, i = i, i+1 {
+			xi, yi, xj, yj := p[i][0], p[i][1], p[j][0], p[j][1]
+			if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+				inside = !inside
+			}
+		}
+	}
+
+	return inside
+}
+
+// parseImageBoard reads a board whose areas are painted in different colors.
+// エリアの番号は左上から行ごとに見て，その色が最初に現れた順
+func parseImageBoard(data []byte) (*maskBoard, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := img.Bounds()
+	if err := checkBoardSize(bounds.Dx(), bounds.Dy(), 1); err != nil {
+		return nil, err
+	}
+
+	labels := newLabels(bounds.Dx(), bounds.Dy())
+	ids := make(map[color.NRGBA]int16)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+
+			id, ok := ids[c]
+			if !ok {
+				// アンチエイリアスのかかった画像などは色が多すぎるので弾く
+				if len(ids) == maxRegionNum {
+					return nil, fmt.Errorf("image must have at most %d colors", maxRegionNum)
+				}
+				id = int16(len(ids))
+				ids[c] = id
+			}
+			labels[(y-bounds.Min.Y)*bounds.Dx()+x-bounds.Min.X] = id
+		}
+	}
+
+	return newMaskBoard(bounds.Dx(), bounds.Dy(), labels, len(ids))
+}
+
+func checkBoardSize(width, height, regionNum int) error {
+	if width <= 0 || maxBoardSize < width || height <= 0 || maxBoardSize < height {
+		return fmt.Errorf("size must be between 1 and %d", maxBoardSize)
+	}
+
+	if regionNum <= 0 || maxRegionNum < regionNum {
+		return fmt.Errorf("board must have 1 to %d regions", maxRegionNum)
+	}
+
+	return nil
+}
+
+func newLabels(width, height int) []int16 {
+	labels := make([]int16, width*height)
+	for i := range labels {
+		labels[i] = -1
+	}
+
+	return labels
+}
+
+// maskBoard is a board whose areas are given by a label for each pixel.
+type maskBoard struct {
+	width, height int
+	labels        []int16 // ピクセルごとのエリアの番号 (-1 はどのエリアでもない)
+	rects         []image.Rectangle
+	neighbors     [][]int
+	regions       []Region
+}
+
+func newMaskBoard(width, height int, labels []int16, n int) (*maskBoard, error) {
+	b := &maskBoard{
+		width:     width,
+		height:    height,
+		labels:    labels,
+		rects:     make([]image.Rectangle, n),
+		neighbors: make([][]int, n),
+		regions:   make([]Region, n),
+	}
+
+	adjacent := make([]map[int]bool, n)
+	for i := range adjacent {
+		adjacent[i] = make(map[int]bool)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			id := labels[y*width+x]
+			if id < 0 {
+				continue
+			}
+
+			b.rects[id] = b.rects[id].Union(image.Rect(x, y, x+1, y+1))
+
+			// 右と下のピクセルと比べて，辺で接するエリアを隣とする
+			if x+1 < width {
+				if r := labels[y*width+x+1]; r >= 0 && r != id {
+					adjacent[id][int(r)], adjacent[r][int(id)] = true, true
+				}
+			}
+			if y+1 < height {
+				if d := labels[(y+1)*width+x]; d >= 0 && d != id {
+					adjacent[id][int(d)], adjacent[d][int(id)] = true, true
+				}
+			}
+		}
+	}
+
+	for id := 0; id < n; id++ {
+		if b.rects[id].Empty() {
+			return nil, fmt.Errorf("region %d is empty", id)
+		}
+
+		for a := 0; a < n; a++ {
+			if adjacent[id][a] {
+				b.neighbors[id] = append(b.neighbors[id], a)
+			}
+		}
+
+		region, err := b.region(id)
+		if err != nil {
+			return nil, err
+		}
+		b.regions[id] = region
+	}
+
+	return b, nil
+}
+
+// region makes the geometry of the area sent to the clients.
+func (b *maskBoard) region(id int) (Region, error) {
+	r := b.rects[id]
+	mask := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if int(b.labels[y*b.width+x]) == id {
+				mask.SetNRGBA(x-r.Min.X, y-r.Min.Y, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, mask); err != nil {
+		return Region{}, fmt.Errorf("failed to encode mask: %w", err)
+	}
+
+	return Region{
+		X:      float64(r.Min.X) / float64(b.width),
+		Y:      float64(r.Min.Y) / float64(b.height),
+		Width:  float64(r.Dx()) / float64(b.width),
+		Height: float64(r.Dy()) / float64(b.height),
+		Mask:   base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+func (b *maskBoard) AreaNum() int {
+	return len(b.rects)
+}
+
+func (b *maskBoard) Size() image.Point {
+	return image.Pt(b.width, b.height)
+}
+
+// Area scales the mask of the area to the bounds by the nearest neighbor.
+func (b *maskBoard) Area(bounds image.Rectangle, areaId int) (image.Rectangle, image.Image, error) {
+	if areaId < 0 || b.AreaNum() <= areaId {
+		return image.Rectangle{}, nil, fmt.Errorf("area %d is out of the board", areaId)
+	}
+
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return image.Rectangle{}, image.Transparent, nil
+	}
+
+	r := b.rects[areaId]
+	rect := image.Rect(
+		bounds.Min.X+r.Min.X*w/b.width,
+		bounds.Min.Y+r.Min.Y*h/b.height,
+		bounds.Min.X+(r.Max.X*w+b.width-1)/b.width,
+		bounds.Min.Y+(r.Max.Y*h+b.height-1)/b.height,
+	)
+
+	mask := image.NewAlpha(rect)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		sy := (y - bounds.Min.Y) * b.height / h
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			sx := (x - bounds.Min.X) * b.width / w
+			if int(b.labels[sy*b.width+sx]) == areaId {
+				mask.Pix[mask.PixOffset(x, y)] = 0xff
+			}
+		}
+	}
+
+	return rect, mask, nil
+}
+
+func (b *maskBoard) Neighbors(areaId int) []int {
+	return b.neighbors[areaId]
+}
+
+func (b *maskBoard) Region(areaId int) *Region {
+	if areaId < 0 || b.AreaNum() <= areaId {
+		return nil
+	}
+
+	return &b.regions[areaId]
+}
@@ -0,0 +1,81 @@
+package canvas
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// Palettes which restrict the colors the drawers can use.
+// 背景として白も使えるようにしている (player は描く人の色だけ)
+var (
+	MonochromePalette = color.Palette{
+		color.RGBA{0x00, 0x00, 0x00, 0xff},
+		color.RGBA{0xff, 0xff, 0xff, 0xff},
+	}
+	FourColorPalette = color.Palette{
+		color.RGBA{0x00, 0x00, 0x00, 0xff},
+		color.RGBA{0xe6, 0x39, 0x46, 0xff},
+		color.RGBA{0x1d, 0x6f, 0xd8, 0xff},
+		color.RGBA{0xf4, 0xc4, 0x30, 0xff},
+		color.RGBA{0xff, 0xff, 0xff, 0xff},
+	}
+)
+
+// playerColors are assigned to the drawers in order, and repeat when there are more drawers.
+var playerColors = []color.RGBA{
+	{0xe6, 0x39, 0x46, 0xff},
+	{0x1d, 0x6f, 0xd8, 0xff},
+	{0x2a, 0x9d, 0x3f, 0xff},
+	{0xf4, 0xa2, 0x61, 0xff},
+	{0x7b, 0x2c, 0xbf, 0xff},
+	{0x00, 0xa6, 0xa6, 0xff},
+	{0xd6, 0x3a, 0xa5, 0xff},
+	{0x6b, 0x4f, 0x2a, 0xff},
+}
+
+// PlayerPalette returns the palette with only the color assigned to the i-th drawer.
+func PlayerPalette(i int) color.Palette {
+	if i < 0 {
+		i = -i
+	}
+
+	return color.Palette{playerColors[i%len(playerColors)]}
+}
+
+// HexColors returns the colors of the palette like "#e63946".
+func HexColors(p color.Palette) []string {
+	hex := make([]string, len(p))
+	for i, c := range p {
+		r, g, b, _ := c.RGBA()
+		hex[i] = fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+	}
+
+	return hex
+}
+
+// Quantize replaces the colors of the image with the nearest ones in the palette.
+// 半透明の画素はアルファが半分未満なら透明に，それ以外は不透明なパレットの色にする
+// パレットが空のときは画像をそのまま返す
+func Quantize(src image.Image, p color.Palette) image.Image {
+	if len(p) == 0 {
+		return src
+	}
+
+	// 0番は透明にして，パレットの色は1番から並べる
+	bounds := src.Bounds()
+	dst := image.NewPaletted(bounds, append(color.Palette{color.Transparent}, p...))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 {
+				continue
+			}
+
+			c.A = 0xff
+			dst.SetColorIndex(x, y, uint8(p.Index(c)+1))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,54 @@
+package canvas
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	var (
+		black       = color.RGBA{0x00, 0x00, 0x00, 0xff}
+		white       = color.RGBA{0xff, 0xff, 0xff, 0xff}
+		red         = color.RGBA{0xe6, 0x39, 0x46, 0xff}
+		blue        = color.RGBA{0x1d, 0x6f, 0xd8, 0xff}
+		yellow      = color.RGBA{0xf4, 0xc4, 0x30, 0xff}
+		transparent = color.RGBA{}
+	)
+
+	tests := []struct {
+		name    string
+		palette color.Palette
+		src     color.Color
+		want    color.RGBA
+	}{
+		{name: "monochrome: white background", palette: MonochromePalette, src: color.NRGBA{0xff, 0xff, 0xff, 0xff}, want: white},
+		{name: "monochrome: dark gray", palette: MonochromePalette, src: color.NRGBA{0x30, 0x30, 0x30, 0xff}, want: black},
+		{name: "monochrome: light red", palette: MonochromePalette, src: color.NRGBA{0xff, 0xc0, 0xc0, 0xff}, want: white},
+		{name: "four: white background", palette: FourColorPalette, src: color.NRGBA{0xff, 0xff, 0xff, 0xff}, want: white},
+		{name: "four: off white", palette: FourColorPalette, src: color.NRGBA{0xf0, 0xf0, 0xf0, 0xff}, want: white},
+		{name: "four: pure red", palette: FourColorPalette, src: color.NRGBA{0xff, 0x00, 0x00, 0xff}, want: red},
+		{name: "four: navy", palette: FourColorPalette, src: color.NRGBA{0x10, 0x40, 0xa0, 0xff}, want: blue},
+		{name: "four: orange", palette: FourColorPalette, src: color.NRGBA{0xff, 0xc0, 0x00, 0xff}, want: yellow},
+		{name: "four: half transparent red", palette: FourColorPalette, src: color.NRGBA{0xff, 0x00, 0x00, 0x90}, want: red},
+		{name: "four: almost transparent", palette: FourColorPalette, src: color.NRGBA{0xff, 0x00, 0x00, 0x70}, want: transparent},
+		{name: "player: any color", palette: PlayerPalette(1), src: color.NRGBA{0xff, 0xff, 0xff, 0xff}, want: blue},
+		{name: "player: wraps around", palette: PlayerPalette(len(playerColors)), src: color.NRGBA{0x00, 0x00, 0x00, 0xff}, want: red},
+		{name: "free: unchanged", palette: nil, src: color.NRGBA{0x12, 0x34, 0x56, 0xff}, want: color.RGBA{0x12, 0x34, 0x56, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+			src.Set(0, 0, tt.src)
+
+			dst := Quantize(src, tt.palette)
+			if got := color.RGBAModel.Convert(dst.At(0, 0)); got != tt.want {
+				t.Errorf("Quantize() = %v, want %v", got, tt.want)
+			}
+			// 何も描いていない画素は透明のまま
+			if got := color.RGBAModel.Convert(dst.At(1, 0)); got != transparent {
+				t.Errorf("Quantize() of a transparent pixel = %v, want transparent", got)
+			}
+		})
+	}
+}
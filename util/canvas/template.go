@@ -0,0 +1,106 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	// テンプレートには写真も使えるように JPEG も読む
+	_ "image/jpeg"
+)
+
+// maxTemplateScale is how many times larger than the canvas of the board a template can be.
+// 縦横比を保って置くので，縦長の写真も使えるようにボードの長い方の辺を縦横どちらの上限にもする
+const maxTemplateScale = 3
+
+// BoardSize returns the size in pixels of the canvas of the board.
+func BoardSize(boardName string) (image.Point, error) {
+	b, err := BoardOf(boardName)
+	if err != nil {
+		return image.Point{}, err
+	}
+
+	return b.Size(), nil
+}
+
+// NormalizeTemplate fits a base64 encoded PNG or JPEG image in the canvas of the board
+// and returns it as a base64 encoded PNG.
+// 縦横比を保ったまま中央に置き，余白は透明にする
+func NormalizeTemplate(b64 string, boardName string) (string, error) {
+	size, err := BoardSize(boardName)
+	if err != nil {
+		return "", err
+	}
+
+	side := max(size.X, size.Y) * maxTemplateScale
+	src, err := decodeLimited(b64, image.Pt(side, side), "png", "jpeg")
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, fitImage(src, size)); err != nil {
+		return "", fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// fitImage scales the image to fit in the size keeping the aspect ratio.
+func fitImage(src image.Image, size image.Point) *image.RGBA {
+	dst := image.NewRGBA(image.Rectangle{Max: size})
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	if sw == 0 || sh == 0 || size.X == 0 || size.Y == 0 {
+		return dst
+	}
+
+	// 幅と高さのうち，はみ出す方に合わせる
+	w, h := size.X, sh*size.X/sw
+	if h > size.Y {
+		w, h = sw*size.Y/sh, size.Y
+	}
+	w, h = max(w, 1), max(h, 1)
+	offset := image.Pt((size.X-w)/2, (size.Y-h)/2)
+	resample(dst, image.Rectangle{Min: offset, Max: offset.Add(image.Pt(w, h))}, src)
+
+	return dst
+}
+
+// resample scales the image into the rectangle of dst.
+// 各ピクセルは元の画像の対応する範囲の平均にする (拡大するときは最近傍)
+func resample(dst *image.RGBA, rect image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	w, h := rect.Dx(), rect.Dy()
+	if sw == 0 || sh == 0 {
+		return
+	}
+
+	for y := 0; y < h; y++ {
+		sy0 := y * sh / h
+		sy1 := max((y+1)*sh/h, sy0+1)
+		for x := 0; x < w; x++ {
+			sx0 := x * sw / w
+			sx1 := max((x+1)*sw/w, sx0+1)
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sb.Min.X+sx, sb.Min.Y+sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+
+			dst.SetRGBA(rect.Min.X+x, rect.Min.Y+y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+}
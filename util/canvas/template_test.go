@@ -0,0 +1,61 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+func TestNormalizeTemplate(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	src := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(src, src.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	b64, err := NormalizeTemplate(base64.StdEncoding.EncodeToString(buf.Bytes()), "4x4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := BoardSize("4x4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds().Size(); got != size {
+		t.Fatalf("size = %v, want %v", got, size)
+	}
+
+	// 正方形の画像は高さに合わせて中央に置き，左右の余白は透明にする
+	margin := (size.X - size.Y) / 2
+	tests := []struct {
+		p    image.Point
+		want color.Color
+	}{
+		{p: image.Pt(size.X/2, size.Y/2), want: red},
+		{p: image.Pt(margin, 0), want: red},
+		{p: image.Pt(margin-1, size.Y/2), want: color.RGBA{}},
+		{p: image.Pt(size.X-margin, size.Y/2), want: color.RGBA{}},
+	}
+	for _, tt := range tests {
+		if got := color.RGBAModel.Convert(img.At(tt.p.X, tt.p.Y)); got != tt.want {
+			t.Errorf("pixel %v = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Package errcode provides the messages of the error codes shown to the users.
+package errcode
+
+import (
+	"strings"
+
+	"github.com/21hack02win/nascalay-backend/oapi"
+)
+
+// Lang is a language of the messages.
+type Lang string
+
+const (
+	LangJa Lang = "ja"
+	LangEn Lang = "en"
+
+	DefaultLang = LangJa
+)
+
+var messages = map[oapi.ErrorCode]map[Lang]string{
+	oapi.ErrorCodeINVALIDBODY: {
+		LangJa: "送信された内容が正しくありません",
+		LangEn: "The request is invalid",
+	},
+	oapi.ErrorCodeUNKNOWNEVENT: {
+		LangJa: "不明な操作です",
+		LangEn: "Unknown operation",
+	},
+	oapi.ErrorCodeUNAUTHORIZED: {
+		LangJa: "ホストだけができる操作です",
+		LangEn: "Only the host can do this",
+	},
+	oapi.ErrorCodeWRONGPHASE: {
+		LangJa: "いまはその操作はできません",
+		LangEn: "You cannot do this now",
+	},
+	oapi.ErrorCodeNOTFOUND: {
+		LangJa: "見つかりませんでした",
+		LangEn: "Not found",
+	},
+	oapi.ErrorCodeALREADYEXISTS: {
+		LangJa: "すでに送信されています",
+		LangEn: "Already sent",
+	},
+	oapi.ErrorCodeDUPLICATEODAI: {
+		LangJa: "同じお題がすでにあります",
+		LangEn: "The same odai already exists",
+	},
+	oapi.ErrorCodeNOTENOUGHMEMBERS: {
+		LangJa: "ゲームを始めるには人数が足りません",
+		LangEn: "Not enough members to start the game",
+	},
+	oapi.ErrorCodeROOMFULL: {
+		LangJa: "ルームが満員です",
+		LangEn: "The room is full",
+	},
+	oapi.ErrorCodeINVALIDOPTION: {
+		LangJa: "ゲームの設定が正しくありません",
+		LangEn: "Invalid game option",
+	},
+	oapi.ErrorCodeUNBALANCEDTEAMS: {
+		LangJa: "チームの人数をそろえてください",
+		LangEn: "The teams must have the same number of members",
+	},
+	oapi.ErrorCodeTEAMSINRELAYMODE: {
+		LangJa: "リレーモードではチーム戦はできません",
+		LangEn: "Teams are not supported in relay mode",
+	},
+	oapi.ErrorCodeROUNDSREMAINING: {
+		LangJa: "まだラウンドが残っています",
+		LangEn: "Some rounds are remaining",
+	},
+	oapi.ErrorCodeUNSUPPORTEDFEATURE: {
+		LangJa: "お使いのクライアントはこの機能に対応していません",
+		LangEn: "Your client does not support this feature",
+	},
+	oapi.ErrorCodeGAMEPAUSED: {
+		LangJa: "ゲームが一時停止中です",
+		LangEn: "The game is paused",
+	},
+	oapi.ErrorCodeINVALIDIMAGEURL: {
+		LangJa: "画像のURLが正しくないか，有効期限が切れています",
+		LangEn: "The image URL is invalid or expired",
+	},
+	oapi.ErrorCodeINVALIDIMAGE: {
+		LangJa: "画像を読み込めませんでした",
+		LangEn: "The image could not be read",
+	},
+	oapi.ErrorCodeUNSUPPORTEDIMAGEFORMAT: {
+		LangJa: "この形式の画像は使えません",
+		LangEn: "This image format is not supported",
+	},
+	oapi.ErrorCodeIMAGETOOLARGE: {
+		LangJa: "画像が大きすぎます",
+		LangEn: "The image is too large",
+	},
+	oapi.ErrorCodeSERVERCLOSING: {
+		LangJa: "サーバーがメンテナンス中です",
+		LangEn: "The server is under maintenance",
+	},
+	oapi.ErrorCodeINTERNALERROR: {
+		LangJa: "サーバーでエラーが発生しました",
+		LangEn: "An error occurred on the server",
+	},
+}
+
+// Message returns the message of the code in the language.
+func Message(code oapi.ErrorCode, lang Lang) string {
+	m, ok := messages[code]
+	if !ok {
+		m = messages[oapi.ErrorCodeINTERNALERROR]
+	}
+
+	if msg, ok := m[lang]; ok {
+		return msg
+	}
+
+	return m[DefaultLang]
+}
+
+// LangOf chooses the language from the Accept-Language header.
+// q値は見ずに，対応している最初の言語を使う
+func LangOf(acceptLanguage string) Lang {
+	for _, tag := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ = strings.Cut(strings.TrimSpace(tag), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+
+		switch Lang(primary) {
+		case LangJa, LangEn:
+			return Lang(primary)
+		}
+	}
+
+	return DefaultLang
+}
@@ -0,0 +1,415 @@
+// Package msgpack encodes and decodes MessagePack (https://msgpack.org) values.
+//
+// JSON と同じ形の値 (nil, bool, 数値, string, []interface{}, map[string]interface{}) に
+// バイナリ ([]byte) を加えたものだけを扱う
+package msgpack
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// maxDepth is the maximum nesting of arrays and maps.
+const maxDepth = 32
+
+var (
+	ErrUnexpectedEOF = errors.New("msgpack: unexpected end of data")
+	ErrTooDeep       = errors.New("msgpack: too deeply nested")
+	ErrTrailingData  = errors.New("msgpack: trailing data after the value")
+)
+
+// Marshal encodes v.
+// 数値は整数で表せるときは整数として，それ以外は float64 として書く
+func Marshal(v interface{}) ([]byte, error) {
+	e := &encoder{}
+	if err := e.encode(v, 0); err != nil {
+		return nil, err
+	}
+
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) encode(v interface{}, depth int) error {
+	if depth > maxDepth {
+		return ErrTooDeep
+	}
+
+	switch v := v.(type) {
+	case nil:
+		e.buf = append(e.buf, 0xc0)
+	case bool:
+		if v {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case int:
+		e.writeInt(int64(v))
+	case int64:
+		e.writeInt(v)
+	case uint64:
+		e.writeUint(v)
+	case float64:
+		e.writeFloat(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			e.writeInt(i)
+			return nil
+		}
+
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("msgpack: invalid number %q: %w", v.String(), err)
+		}
+		e.writeFloat(f)
+	case string:
+		e.writeHeader(len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		e.buf = append(e.buf, v...)
+	case []byte:
+		e.writeHeader(len(v), 0, 0, 0xc4, 0xc5, 0xc6)
+		e.buf = append(e.buf, v...)
+	case []interface{}:
+		e.writeHeader(len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, elem := range v {
+			if err := e.encode(elem, depth+1); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		// encoding/json と同じくキーの順に書く
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		e.writeHeader(len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, k := range keys {
+			if err := e.encode(k, depth+1); err != nil {
+				return err
+			}
+			if err := e.encode(v[k], depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+
+	return nil
+}
+
+// writeHeader writes the type and the length of a string, binary, array or map.
+// fix は長さを埋め込む形式の先頭 (fixLen 未満のときに使う)，8, 16, 32 は長さのバイト数ごとの形式 (0 は形式がない)
+func (e *encoder) writeHeader(n int, fix byte, fixLen int, t8, t16, t32 byte) {
+	switch {
+	case n < fixLen:
+		e.buf = append(e.buf, fix|byte(n))
+	case t8 != 0 && n <= math.MaxUint8:
+		e.buf = append(e.buf, t8, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, t16)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	default:
+		e.buf = append(e.buf, t32)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	}
+}
+
+func (e *encoder) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.writeUint(uint64(i))
+	case i >= -32:
+		e.buf = append(e.buf, byte(i))
+	case i >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(i))
+	case i >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(i))
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, uint64(i))
+	}
+}
+
+func (e *encoder) writeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf = append(e.buf, byte(u))
+	case u <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(u))
+	case u <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(u))
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, u)
+	}
+}
+
+func (e *encoder) writeFloat(f float64) {
+	e.buf = append(e.buf, 0xcb)
+	e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+// Unmarshal decodes a single value which fills data.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := NewDecoder(data)
+	v, err := d.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.More() {
+		return nil, ErrTrailingData
+	}
+
+	return v, nil
+}
+
+// Decoder decodes the values written one after another.
+// 整数は int64 (収まらないときは uint64)，マップは map[string]interface{} として返す
+type Decoder struct {
+	data []byte
+	off  int
+}
+
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// More reports whether there is another value to decode.
+func (d *Decoder) More() bool {
+	return d.off < len(d.data)
+}
+
+// Decode decodes the next value.
+func (d *Decoder) Decode() (interface{}, error) {
+	return d.decode(0)
+}
+
+func (d *Decoder) decode(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, ErrTooDeep
+	}
+
+	t, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case t <= 0x7f:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xe0 == 0xa0:
+		return d.readString(int(t & 0x1f))
+	case t&0xf0 == 0x90:
+		return d.readArray(int(t&0x0f), depth)
+	case t&0xf0 == 0x80:
+		return d.readMap(int(t&0x0f), depth)
+	}
+
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.readUint(1 << int(t-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+
+		return u, nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << int(t-0xd0)
+		u, err := d.readUint(size)
+		if err != nil {
+			return nil, err
+		}
+
+		// 符号を広げる
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, nil
+	case 0xca:
+		u, err := d.readUint(4)
+		if err != nil {
+			return nil, err
+		}
+
+		return float64(math.Float32frombits(uint32(u))), nil
+	case 0xcb:
+		u, err := d.readUint(8)
+		if err != nil {
+			return nil, err
+		}
+
+		return math.Float64frombits(u), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLen(1 << int(t-0xd9))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.readString(n)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLen(1 << int(t-0xc4))
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := d.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+
+		return append([]byte(nil), b...), nil
+	case 0xdc, 0xdd:
+		n, err := d.readLen(2 << int(t-0xdc))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.readArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.readLen(2 << int(t-0xde))
+		if err != nil {
+			return nil, err
+		}
+
+		return d.readMap(n, depth)
+	default:
+		// ext 型などは使わない
+		return nil, fmt.Errorf("msgpack: unsupported type 0x%02x", t)
+	}
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	if d.off >= len(d.data) {
+		return 0, ErrUnexpectedEOF
+	}
+
+	b := d.data[d.off]
+	d.off++
+
+	return b, nil
+}
+
+func (d *Decoder) readBytes(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.off < n {
+		return nil, ErrUnexpectedEOF
+	}
+
+	b := d.data[d.off : d.off+n]
+	d.off += n
+
+	return b, nil
+}
+
+func (d *Decoder) readUint(size int) (uint64, error) {
+	b, err := d.readBytes(size)
+	if err != nil {
+		return 0, err
+	}
+
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	default:
+		return binary.BigEndian.Uint64(b), nil
+	}
+}
+
+// readLen reads a length and checks that the rest of the data can hold it.
+// 要素は 1 バイト以上なので，残りのバイト数より長いものは不正なデータとして先に弾く
+func (d *Decoder) readLen(size int) (int, error) {
+	u, err := d.readUint(size)
+	if err != nil {
+		return 0, err
+	}
+
+	if uint64(len(d.data)-d.off) < u {
+		return 0, ErrUnexpectedEOF
+	}
+
+	return int(u), nil
+}
+
+func (d *Decoder) readString(n int) (string, error) {
+	b, err := d.readBytes(n)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (d *Decoder) readArray(n int, depth int) ([]interface{}, error) {
+	if len(d.data)-d.off < n {
+		return nil, ErrUnexpectedEOF
+	}
+
+	arr := make([]interface{}, n)
+	for i := range arr {
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+
+	return arr, nil
+}
+
+func (d *Decoder) readMap(n int, depth int) (map[string]interface{}, error) {
+	if len(d.data)-d.off < 2*n {
+		return nil, ErrUnexpectedEOF
+	}
+
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key must be a string, got %T", k)
+		}
+
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+
+	return m, nil
+}
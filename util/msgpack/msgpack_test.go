@@ -0,0 +1,109 @@
+package msgpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want []byte
+	}{
+		{name: "nil", v: nil, want: []byte{0xc0}},
+		{name: "true", v: true, want: []byte{0xc3}},
+		{name: "positive fixint", v: 5, want: []byte{0x05}},
+		{name: "negative fixint", v: -1, want: []byte{0xff}},
+		{name: "uint8", v: 200, want: []byte{0xcc, 0xc8}},
+		{name: "int16", v: -300, want: []byte{0xd1, 0xfe, 0xd4}},
+		{name: "json number", v: json.Number("1.5"), want: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{name: "fixstr", v: "abc", want: []byte{0xa3, 'a', 'b', 'c'}},
+		{name: "bin8", v: []byte{1, 2}, want: []byte{0xc4, 0x02, 0x01, 0x02}},
+		{name: "fixarray", v: []interface{}{1, "a"}, want: []byte{0x92, 0x01, 0xa1, 'a'}},
+		{name: "fixmap sorted by key", v: map[string]interface{}{"b": 2, "a": 1}, want: []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Marshal() = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	v := map[string]interface{}{
+		"type": "DRAW_SEND",
+		"body": map[string]interface{}{
+			"img":   bytes.Repeat([]byte{0x89}, 70000),
+			"text":  strings.Repeat("あ", 100),
+			"list":  []interface{}{int64(-70000), int64(1 << 40), 0.25, nil, false},
+			"empty": map[string]interface{}{},
+		},
+	}
+
+	buf, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	got, err := Unmarshal(buf)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("Unmarshal() = %v, want %v", got, v)
+	}
+}
+
+func TestDecoderMore(t *testing.T) {
+	d := NewDecoder([]byte{0x01, 0xa1, 'a'})
+
+	var got []interface{}
+	for d.More() {
+		v, err := d.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		got = append(got, v)
+	}
+
+	want := []interface{}{int64(1), "a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() = %v, want %v", got, want)
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "empty", data: nil, want: ErrUnexpectedEOF},
+		{name: "short string", data: []byte{0xa3, 'a'}, want: ErrUnexpectedEOF},
+		{name: "huge array length", data: []byte{0xdd, 0xff, 0xff, 0xff, 0xff}, want: ErrUnexpectedEOF},
+		{name: "trailing data", data: []byte{0x01, 0x02}, want: ErrTrailingData},
+		{name: "too deep", data: bytes.Repeat([]byte{0x91}, maxDepth+2), want: ErrTooDeep},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unmarshal(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Unmarshal() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Unmarshal([]byte{0x81, 0x01, 0x01}); err == nil {
+		t.Error("Unmarshal() with a non-string key should fail")
+	}
+}
@@ -0,0 +1,175 @@
+package random
+
+import (
+	"math/rand"
+
+	"github.com/21hack02win/nascalay-backend/model"
+)
+
+// AreaStrategy decides the area of a board drawn on each turn.
+type AreaStrategy interface {
+	// Areas returns the area drawn on each turn, which is a permutation of [0, cols*rows).
+	// drawers[j] は j ターン目に描く人 (len(drawers) == cols*rows)
+	Areas(rng *rand.Rand, cols, rows int, drawers []model.UserId) []int
+}
+
+var areaStrategies = map[model.AreaOrder]AreaStrategy{
+	model.AreaOrderRandom: randomAreas{},
+	model.AreaOrderRaster: rasterAreas{},
+	model.AreaOrderSpiral: spiralAreas{},
+	model.AreaOrderGrow:   growAreas{},
+	model.AreaOrderRegion: regionAreas{},
+}
+
+// AreaStrategyOf returns the strategy of the order, or the random one for an unknown order.
+func AreaStrategyOf(order model.AreaOrder) AreaStrategy {
+	if s, ok := areaStrategies[order]; ok {
+		return s
+	}
+
+	return randomAreas{}
+}
+
+type randomAreas struct{}
+
+func (randomAreas) Areas(rng *rand.Rand, cols, rows int, _ []model.UserId) []int {
+	return randIntArray(rng, cols*rows)
+}
+
+// rasterAreas fills the board row by row from the top left.
+type rasterAreas struct{}
+
+func (rasterAreas) Areas(_ *rand.Rand, cols, rows int, _ []model.UserId) []int {
+	areas := make([]int, cols*rows)
+	for i := range areas {
+		areas[i] = i
+	}
+
+	return areas
+}
+
+// spiralAreas fills the board clockwise from the top left to the center.
+type spiralAreas struct{}
+
+func (spiralAreas) Areas(_ *rand.Rand, cols, rows int, _ []model.UserId) []int {
+	areas := make([]int, 0, cols*rows)
+	top, bottom, left, right := 0, rows-1, 0, cols-1
+	for top <= bottom && left <= right {
+		for c := left; c <= right; c++ {
+			areas = append(areas, top*cols+c)
+		}
+		for r := top + 1; r <= bottom; r++ {
+			areas = append(areas, r*cols+right)
+		}
+		// 1行・1列だけ残っているときは戻らない
+		if top < bottom && left < right {
+			for c := right - 1; c >= left; c-- {
+				areas = append(areas, bottom*cols+c)
+			}
+			for r := bottom - 1; r > top; r-- {
+				areas = append(areas, r*cols+left)
+			}
+		}
+		top, bottom, left, right = top+1, bottom-1, left+1, right-1
+	}
+
+	return areas
+}
+
+// growAreas starts from the center and then picks an area next to the drawn ones at random.
+// 上下左右に隣り合うエリアを隣とみなす
+type growAreas struct{}
+
+func (growAreas) Areas(rng *rand.Rand, cols, rows int, _ []model.UserId) []int {
+	n := cols * rows
+	if n == 0 {
+		return []int{}
+	}
+
+	// 辺の長さが偶数のときは中央の2つからランダムに選ぶ
+	col := (cols - 1 + rng.Intn(2-cols%2)) / 2
+	row := (rows - 1 + rng.Intn(2-rows%2)) / 2
+
+	drawn := make([]bool, n)
+	inFrontier := make([]bool, n)
+	frontier := []int{row*cols + col}
+	inFrontier[frontier[0]] = true
+
+	areas := make([]int, 0, n)
+	for len(frontier) > 0 {
+		i := rng.Intn(len(frontier))
+		a := frontier[i]
+		frontier[i] = frontier[len(frontier)-1]
+		frontier = frontier[:len(frontier)-1]
+
+		drawn[a] = true
+		areas = append(areas, a)
+
+		for _, b := range adjacentAreas(a, cols, rows) {
+			if !drawn[b] && !inFrontier[b] {
+				inFrontier[b] = true
+				frontier = append(frontier, b)
+			}
+		}
+	}
+
+	return areas
+}
+
+func adjacentAreas(a int, cols, rows int) []int {
+	col, row := a%cols, a/cols
+	adj := make([]int, 0, 4)
+	if row > 0 {
+		adj = append(adj, a-cols)
+	}
+	if row < rows-1 {
+		adj = append(adj, a+cols)
+	}
+	if col > 0 {
+		adj = append(adj, a-1)
+	}
+	if col < cols-1 {
+		adj = append(adj, a+1)
+	}
+
+	return adj
+}
+
+// regionAreas gives each drawer a connected region with as many areas as their turns.
+//
+// ボードを行ごとに折り返す順 (左から右，次の行は右から左) に並べて区切るので，
+// 各領域はひとつながりになり，同じ人が続けて描くエリアも隣り合う
+type regionAreas struct{}
+
+func (regionAreas) Areas(rng *rand.Rand, cols, rows int, drawers []model.UserId) []int {
+	snake := make([]int, 0, cols*rows)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			if r%2 == 0 {
+				snake = append(snake, r*cols+c)
+			} else {
+				snake = append(snake, r*cols+cols-1-c)
+			}
+		}
+	}
+
+	turns := make(map[model.UserId][]int)
+	owners := make([]model.UserId, 0)
+	for j, d := range drawers {
+		if _, ok := turns[d]; !ok {
+			owners = append(owners, d)
+		}
+		turns[d] = append(turns[d], j)
+	}
+
+	areas := make([]int, len(drawers))
+	k := 0
+	for _, v := range randIntArray(rng, len(owners)) {
+		for _, j := range turns[owners[v]] {
+			areas[j] = snake[k]
+			k++
+		}
+	}
+
+	return areas
+}
@@ -0,0 +1,140 @@
+package random
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/21hack02win/nascalay-backend/model"
+	"github.com/gofrs/uuid"
+)
+
+// testDrawers returns the drawers of the turns taking turns in order like SetupMemberRoles.
+func testDrawers(members int, turns int) []model.UserId {
+	ids := make([]model.UserId, members)
+	for i := range ids {
+		ids[i] = model.UserId(uuid.Must(uuid.NewV4()))
+	}
+
+	drawers := make([]model.UserId, turns)
+	for j := range drawers {
+		drawers[j] = ids[j%members]
+	}
+
+	return drawers
+}
+
+func isAdjacent(a, b int, cols int) bool {
+	dc, dr := a%cols-b%cols, a/cols-b/cols
+	return dc*dc+dr*dr == 1
+}
+
+func TestAreaStrategies(t *testing.T) {
+	boards := []struct{ cols, rows int }{{1, 1}, {4, 4}, {5, 5}, {4, 3}, {3, 4}, {7, 1}, {1, 6}}
+
+	for order, s := range areaStrategies {
+		for _, b := range boards {
+			for seed := int64(0); seed < 20; seed++ {
+				n := b.cols * b.rows
+				got := s.Areas(rand.New(rand.NewSource(seed)), b.cols, b.rows, testDrawers(3, n))
+
+				seen := make(map[int]bool, n)
+				for _, a := range got {
+					if a < 0 || n <= a || seen[a] {
+						t.Fatalf("order %d on %dx%d: %v is not a permutation", order, b.cols, b.rows, got)
+					}
+					seen[a] = true
+				}
+				if len(got) != n {
+					t.Fatalf("order %d on %dx%d: got %d areas, want %d", order, b.cols, b.rows, len(got), n)
+				}
+			}
+		}
+	}
+}
+
+func TestAreaStrategyOrders(t *testing.T) {
+	tests := []struct {
+		name string
+		s    AreaStrategy
+		want []int
+	}{
+		{name: "raster", s: rasterAreas{}, want: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+		{name: "spiral", s: spiralAreas{}, want: []int{0, 1, 2, 3, 7, 11, 10, 9, 8, 4, 5, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.s.Areas(nil, 4, 3, testDrawers(2, 12)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Areas() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrowAreas(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		got := growAreas{}.Areas(rand.New(rand.NewSource(seed)), 5, 4, testDrawers(4, 20))
+
+		if got[0] != 7 && got[0] != 12 {
+			t.Fatalf("first area %d is not at the center", got[0])
+		}
+
+		for j := 1; j < len(got); j++ {
+			adjacent := false
+			for _, a := range got[:j] {
+				if isAdjacent(a, got[j], 5) {
+					adjacent = true
+					break
+				}
+			}
+			if !adjacent {
+				t.Fatalf("area %d of turn %d is not next to the drawn areas %v", got[j], j, got[:j])
+			}
+		}
+	}
+}
+
+func TestRegionAreas(t *testing.T) {
+	for _, members := range []int{1, 2, 3, 5} {
+		for seed := int64(0); seed < 50; seed++ {
+			drawers := testDrawers(members, 16)
+			got := regionAreas{}.Areas(rand.New(rand.NewSource(seed)), 4, 4, drawers)
+
+			regions := make(map[model.UserId][]int)
+			for j, d := range drawers {
+				regions[d] = append(regions[d], got[j])
+			}
+
+			// 同じ人が続けて描くエリアは隣り合う
+			for d, areas := range regions {
+				for k := 1; k < len(areas); k++ {
+					if !isAdjacent(areas[k-1], areas[k], 4) {
+						t.Fatalf("areas %v of %s are not connected", areas, d.UUID())
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestSetupMemberRolesAreaOrders(t *testing.T) {
+	for order := range areaStrategies {
+		for seed := int64(0); seed < 50; seed++ {
+			g := newTestGame(5, 16, seed)
+			g.Canvas.BoardName = model.BoardName4x4
+			g.AreaOrder = order
+
+			SetupMemberRoles(g, nil)
+
+			for _, o := range g.Odais {
+				areas := make(map[model.AreaId]struct{})
+				for _, d := range o.DrawerSeq {
+					areas[d.AreaId] = struct{}{}
+				}
+				if len(areas) != 16 {
+					t.Fatalf("order %d: %d areas are drawn, want 16", order, len(areas))
+				}
+			}
+		}
+	}
+}
@@ -2,71 +2,294 @@ package random
 
 import (
 	"math/rand"
-	"time"
 
 	"github.com/21hack02win/nascalay-backend/model"
 )
 
-func init() {
-	rand.Seed(int64(time.Now().Nanosecond()))
+// AnswerId, DrawerSeqを埋める
+//
+// メンバーをランダムな円順に並べ，お題の送信者から見て
+// 1つ隣を回答者，2つ以上離れた人を描く人にすることで次を保証する
+//   - 自分のお題を描かない
+//   - 回答者はそのお題を描かない
+//   - 各ターンで全員がちょうど1枚ずつ描く
+//   - 各お題を描く回数が描ける人の間で均等になる (差は高々1)
+//   - 同じお題を同じ人が連続して描かない
+//
+// ただし描ける人が2人未満になる少人数の場合は次のように緩める
+//   - 3人: 描ける人が1人しかいないので同じ人が連続して描く
+//   - 2人: 回答者以外に描ける人がいないので送信者が自分のお題を描く
+//
+// チーム戦 (g.Teams が空でない) のときは各チームが同じお題を描き，
+// 描く人と回答者はそのチームの中から選ぶ (setupTeamOdais を参照)
+//
+// 各ターンに描くエリアは g.AreaOrder の AreaStrategy で決める
+//
+// 乱数は g.Seed から生成するので，同じシードからは同じ割り当てが得られる
+func SetupMemberRoles(g *model.Game, _ []model.User) {
+	rng := rand.New(rand.NewSource(g.Seed))
+	board := areaBoard{
+		strategy: AreaStrategyOf(g.AreaOrder),
+	}
+	board.cols, board.rows = g.Canvas.Size()
+
+	if len(g.Teams) == 0 {
+		slots := make([]model.UserId, len(g.Odais))
+		for i, o := range g.Odais {
+			slots[i] = o.SenderId
+		}
+
+		setupRoles(rng, g.Odais, slots, board)
+
+		return
+	}
+
+	setupTeamOdais(rng, g)
+
+	for _, t := range g.Teams {
+		odais := make([]*model.Odai, 0, len(t.MemberIds))
+		for _, o := range g.Odais {
+			if o.TeamId == t.Id {
+				odais = append(odais, o)
+			}
+		}
+
+		setupRoles(rng, odais, teamSlots(odais, t), board)
+	}
 }
 
-// AnswerId, DrawerSeqを埋める
-func SetupMemberRoles(g *model.Game, members []model.User) {
+// areaBoard is the board on which the areas are assigned by the strategy.
+type areaBoard struct {
+	strategy   AreaStrategy
+	cols, rows int
+}
+
+// setupRoles assigns the roles of the odais to the members.
+// slots[i] は円順における i 番目のお題の送信者の位置に座る人
+func setupRoles(rng *rand.Rand, odais []*model.Odai, slots []model.UserId, board areaBoard) {
 	// n = メンバーの数 = お題の数
-	n := len(g.Odais)
-	// n * n の行列を作る
-	rect := make([][]int, n)
+	n := len(odais)
+	if n == 0 {
+		return
+	}
+
+	// order[k] 番目のお題の送信者の次に order[k+1] 番目のお題の送信者が並ぶ
+	order := randIntArray(rng, n)
+	next := make([]int, n) // お題のindex -> 円順で次のお題のindex
+	for k := 0; k < n; k++ {
+		next[order[k]] = order[(k+1)%n]
+	}
+
 	for i := 0; i < n; i++ {
-		rect[i] = make([]int, g.Canvas.AllArea)
+		odais[i].AnswererId = slots[next[i]]
 	}
-	answers := RandIntArrayAllMove(n)
+
+	allArea := board.cols * board.rows
+	offsets := drawerOffsets(rng, n, allArea)
 	for i := 0; i < n; i++ {
-		g.Odais[i].AnswererId = g.Odais[answers[i]].SenderId
-	}
-	k := 0 // 横(描く回数)
-	loop := true
-	for loop {
-		zurasu := RandIntArray(n - 1)
-		for i := 0; i < n-1; i++ {
-			if k == g.Canvas.AllArea {
-				loop = false
-				break
+		drawers := make([]model.UserId, allArea)
+		for j := 0; j < allArea; j++ {
+			drawer := i
+			for k := 0; k < offsets[j]; k++ {
+				drawer = next[drawer]
 			}
-			// 縦(お題の数)
-			for j := 0; j < n; j++ {
-				rect[j][k] = answers[(j+zurasu[i]+1)%n]
+			drawers[j] = slots[drawer]
+		}
+
+		ars := board.strategy.Areas(rng, board.cols, board.rows, drawers)
+		odais[i].DrawerSeq = make([]model.Drawer, allArea)
+		for j := 0; j < allArea; j++ {
+			odais[i].DrawerSeq[j] = model.Drawer{
+				UserId: drawers[j],
+				AreaId: model.AreaId(ars[j]),
 			}
-			k++
 		}
 	}
-	for i := 0; i < n; i++ {
-		ars := RandIntArray(g.Canvas.AllArea)
-		g.Odais[i].DrawerSeq = make([]model.Drawer, g.Canvas.AllArea)
-		for j := 0; j < g.Canvas.AllArea; j++ {
-			g.Odais[i].DrawerSeq[j] = model.Drawer{
-				UserId: g.Odais[rect[i][j]].SenderId,
-				AreaId: model.AreaId(ars[j]),
+}
+
+// setupTeamOdais replaces the odais with copies of the same prompts for each team.
+// Each team draws as many prompts as its members, picked from the teams in turn
+// so that every team wrote a similar number of the prompts.
+// お題は同じお題をチームごとに続けて並べるので，SHOWフェーズでチームの絵を見比べられる
+func setupTeamOdais(rng *rand.Rand, g *model.Game) {
+	teams := g.Teams
+
+	bySender := make(map[model.UserId]*model.Odai, len(g.Odais))
+	for _, o := range g.Odais {
+		bySender[o.SenderId] = o
+	}
+
+	// 各チームのメンバーが書いたお題をシャッフルしておく
+	written := make([][]*model.Odai, len(teams))
+	for i, t := range teams {
+		for _, v := range randIntArray(rng, len(t.MemberIds)) {
+			if o, ok := bySender[t.MemberIds[v]]; ok {
+				written[i] = append(written[i], o)
 			}
 		}
 	}
+
+	size := len(teams[0].MemberIds)
+	prompts := make([]*model.Odai, 0, size)
+	for k := 0; len(prompts) < size; k++ {
+		picked := false
+		for i := range written {
+			if len(prompts) < size && k < len(written[i]) {
+				prompts = append(prompts, written[i][k])
+				picked = true
+			}
+		}
+
+		if !picked {
+			break
+		}
+	}
+
+	odais := make([]*model.Odai, 0, len(prompts)*len(teams))
+	for _, p := range prompts {
+		for _, t := range teams {
+			odais = append(odais, &model.Odai{
+				Title:     p.Title,
+				SenderId:  p.SenderId,
+				DrawerSeq: []model.Drawer{},
+				TeamId:    t.Id,
+				Template:  p.Template,
+			})
+		}
+	}
+
+	g.Odais = odais
+}
+
+// teamSlots seats the members of the team for the odais.
+// お題を書いた人がチームにいるときはその人を送信者の位置に座らせて，自分のお題を描かない・回答しないようにする
+func teamSlots(odais []*model.Odai, t model.Team) []model.UserId {
+	slots := make([]model.UserId, len(odais))
+	seated := make(map[model.UserId]bool, len(t.MemberIds))
+	inTeam := make(map[model.UserId]bool, len(t.MemberIds))
+	for _, m := range t.MemberIds {
+		inTeam[m] = true
+	}
+
+	for i, o := range odais {
+		if inTeam[o.SenderId] && !seated[o.SenderId] {
+			slots[i] = o.SenderId
+			seated[o.SenderId] = true
+		}
+	}
+
+	rest := make([]model.UserId, 0, len(t.MemberIds))
+	for _, m := range t.MemberIds {
+		if !seated[m] {
+			rest = append(rest, m)
+		}
+	}
+
+	for i := range slots {
+		if slots[i] == (model.UserId{}) && len(rest) > 0 {
+			slots[i], rest = rest[0], rest[1:]
+		}
+	}
+
+	return slots
 }
 
-func RandIntArray(n int) []int {
+// teamSeedSalt derives the seed of the team split from g.Seed,
+// so that the teams do not follow the same random order as the roles.
+const teamSeedSalt = 0x7ea3
+
+// BalanceTeams splits the members into num teams at random.
+// The sizes of the teams differ by at most 1.
+// 乱数は g.Seed から生成するので，同じシードからは同じチーム分けが得られる
+func BalanceTeams(g *model.Game, members []model.User, num int) []model.Team {
+	rng := rand.New(rand.NewSource(g.Seed ^ teamSeedSalt))
+
+	teams := make([]model.Team, num)
+	for i := range teams {
+		teams[i] = model.Team{
+			Id:        model.TeamId(i),
+			MemberIds: []model.UserId{},
+		}
+	}
+
+	for i, v := range randIntArray(rng, len(members)) {
+		teams[i%num].MemberIds = append(teams[i%num].MemberIds, members[v].Id)
+	}
+
+	return teams
+}
+
+// drawerOffsets returns how far the drawer of each turn is from the sender in the circular order.
+// Every offset in [2, n) is used once per cycle in random order, and the same
+// offset never appears in consecutive turns.
+func drawerOffsets(rng *rand.Rand, n int, turns int) []int {
+	candidates := make([]int, 0, n)
+	for o := 2; o < n; o++ {
+		candidates = append(candidates, o)
+	}
+
+	if len(candidates) == 0 {
+		candidates = append(candidates, 0)
+	}
+
+	offsets := make([]int, 0, turns)
+	for len(offsets) < turns {
+		cycle := make([]int, len(candidates))
+		for i, v := range randIntArray(rng, len(candidates)) {
+			cycle[i] = candidates[v]
+		}
+
+		// 前のサイクルの最後と同じにならないようにする
+		if len(offsets) > 0 && len(cycle) > 1 && cycle[0] == offsets[len(offsets)-1] {
+			cycle[0], cycle[len(cycle)-1] = cycle[len(cycle)-1], cycle[0]
+		}
+
+		offsets = append(offsets, cycle...)
+	}
+
+	return offsets[:turns]
+}
+
+func randIntArray(rng *rand.Rand, n int) []int {
 	arr := make([]int, n)
 	for i := 0; i < n; i++ {
 		arr[i] = i
 	}
-	rand.Shuffle(len(arr), func(i, j int) { arr[i], arr[j] = arr[j], arr[i] })
+	rng.Shuffle(len(arr), func(i, j int) { arr[i], arr[j] = arr[j], arr[i] })
 	return arr
 }
 
-// すべての要素がindexの値と同じにならない 0~n-1 のランダムな配列を返す
-func RandIntArrayAllMove(n int) []int {
-	res := make([]int, n)
-	inx := RandIntArray(n)
+// SetupRelayChains fills Chain of each odai for the relay mode.
+// Every member takes a step of a different chain on each turn and never
+// takes a step of the chain starting from their own odai.
+// Every chain ends on an answer, so there must be model.MinRelayMembers odais at least.
+func SetupRelayChains(g *model.Game) {
+	rng := rand.New(rand.NewSource(g.Seed))
+
+	n := len(g.Odais)
+	order := randIntArray(rng, n)
+	pos := make([]int, n) // お題のindex -> 円順での位置
+	for k, i := range order {
+		pos[i] = k
+	}
+
+	steps := relayChainLength(n)
 	for i := 0; i < n; i++ {
-		res[inx[i]] = inx[(i+1)%n]
+		g.Odais[i].Chain = make([]model.RelayStep, steps)
+		for k := 0; k < steps; k++ {
+			g.Odais[i].Chain[k] = model.RelayStep{
+				UserId: g.Odais[order[(pos[i]+k+1)%n]].SenderId,
+			}
+		}
 	}
-	return res
+}
+
+// relayChainLength returns the number of the steps of each chain for n odais.
+// 自分のお題のチェーンには入らないので最大 n-1 ステップで，回答で終わるように偶数にそろえる
+func relayChainLength(n int) int {
+	if n < model.MinRelayMembers {
+		return 0
+	}
+
+	return (n - 1) / 2 * 2
 }
@@ -1,7 +1,11 @@
 package random
 
 import (
+	"fmt"
+	"math/rand"
+	"reflect"
 	"testing"
+	"testing/quick"
 
 	"github.com/21hack02win/nascalay-backend/model"
 	"github.com/gofrs/uuid"
@@ -158,3 +162,380 @@ func TestSetupMemberRoles(t *testing.T) {
 		})
 	}
 }
+
+func newTestGame(n int, allArea int, seed int64) *model.Game {
+	g := &model.Game{
+		Odais: make([]*model.Odai, n),
+		Canvas: model.Canvas{
+			AllArea: allArea,
+		},
+		Seed: seed,
+	}
+	for i := 0; i < n; i++ {
+		g.Odais[i] = &model.Odai{
+			Title:     model.OdaiTitle(fmt.Sprintf("odai%d", i)),
+			SenderId:  model.UserId(uuid.Must(uuid.NewV4())),
+			DrawerSeq: []model.Drawer{},
+		}
+	}
+	return g
+}
+
+type rolesInput struct {
+	N       int
+	AllArea int
+	Seed    int64
+}
+
+func (rolesInput) Generate(r *rand.Rand, _ int) reflect.Value {
+	return reflect.ValueOf(rolesInput{
+		N:       2 + r.Intn(19),
+		AllArea: 1 + r.Intn(30),
+		Seed:    r.Int63(),
+	})
+}
+
+func TestSetupMemberRolesProperties(t *testing.T) {
+	tests := []struct {
+		name string
+		prop func(in rolesInput) bool
+	}{
+		{
+			name: "answerer is another member and answers exactly one odai",
+			prop: func(in rolesInput) bool {
+				g := newTestGame(in.N, in.AllArea, in.Seed)
+				SetupMemberRoles(g, nil)
+
+				answered := make(map[model.UserId]int)
+				for _, o := range g.Odais {
+					if o.AnswererId == o.SenderId {
+						return false
+					}
+					answered[o.AnswererId]++
+				}
+				for _, o := range g.Odais {
+					if answered[o.SenderId] != 1 {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		{
+			name: "every member draws exactly once per turn",
+			prop: func(in rolesInput) bool {
+				g := newTestGame(in.N, in.AllArea, in.Seed)
+				SetupMemberRoles(g, nil)
+
+				for j := 0; j < in.AllArea; j++ {
+					drawers := make(map[model.UserId]struct{})
+					for _, o := range g.Odais {
+						drawers[o.DrawerSeq[j].UserId] = struct{}{}
+					}
+					if len(drawers) != in.N {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		{
+			name: "answerer never draws the odai",
+			prop: func(in rolesInput) bool {
+				g := newTestGame(in.N, in.AllArea, in.Seed)
+				SetupMemberRoles(g, nil)
+
+				for _, o := range g.Odais {
+					for _, d := range o.DrawerSeq {
+						if d.UserId == o.AnswererId {
+							return false
+						}
+					}
+				}
+				return true
+			},
+		},
+		{
+			name: "nobody draws their own odai (3 or more members)",
+			prop: func(in rolesInput) bool {
+				if in.N < 3 {
+					return true
+				}
+				g := newTestGame(in.N, in.AllArea, in.Seed)
+				SetupMemberRoles(g, nil)
+
+				for _, o := range g.Odais {
+					for _, d := range o.DrawerSeq {
+						if d.UserId == o.SenderId {
+							return false
+						}
+					}
+				}
+				return true
+			},
+		},
+		{
+			name: "drawers of an odai never repeat consecutively (4 or more members)",
+			prop: func(in rolesInput) bool {
+				if in.N < 4 {
+					return true
+				}
+				g := newTestGame(in.N, in.AllArea, in.Seed)
+				SetupMemberRoles(g, nil)
+
+				for _, o := range g.Odais {
+					for j := 1; j < len(o.DrawerSeq); j++ {
+						if o.DrawerSeq[j].UserId == o.DrawerSeq[j-1].UserId {
+							return false
+						}
+					}
+				}
+				return true
+			},
+		},
+		{
+			name: "turns of an odai are balanced between the eligible drawers",
+			prop: func(in rolesInput) bool {
+				if in.N < 3 {
+					return true
+				}
+				g := newTestGame(in.N, in.AllArea, in.Seed)
+				SetupMemberRoles(g, nil)
+
+				for _, o := range g.Odais {
+					counts := make(map[model.UserId]int)
+					for _, d := range o.DrawerSeq {
+						counts[d.UserId]++
+					}
+					lo, hi := in.AllArea, 0
+					for _, m := range g.Odais {
+						if m.SenderId == o.SenderId || m.SenderId == o.AnswererId {
+							continue
+						}
+						c := counts[m.SenderId]
+						if c < lo {
+							lo = c
+						}
+						if c > hi {
+							hi = c
+						}
+					}
+					if hi-lo > 1 {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		{
+			name: "every area is drawn exactly once",
+			prop: func(in rolesInput) bool {
+				g := newTestGame(in.N, in.AllArea, in.Seed)
+				SetupMemberRoles(g, nil)
+
+				for _, o := range g.Odais {
+					areas := make(map[model.AreaId]struct{})
+					for _, d := range o.DrawerSeq {
+						areas[d.AreaId] = struct{}{}
+					}
+					if len(areas) != in.AllArea {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		{
+			name: "same seed gives the same roles",
+			prop: func(in rolesInput) bool {
+				g1 := newTestGame(in.N, in.AllArea, in.Seed)
+				g2 := &model.Game{Canvas: g1.Canvas, Seed: in.Seed}
+				for _, o := range g1.Odais {
+					g2.Odais = append(g2.Odais, &model.Odai{Title: o.Title, SenderId: o.SenderId})
+				}
+				SetupMemberRoles(g1, nil)
+				SetupMemberRoles(g2, nil)
+
+				return reflect.DeepEqual(g1.Odais, g2.Odais)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := quick.Check(tt.prop, &quick.Config{MaxCount: 300}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSetupMemberRolesTeams(t *testing.T) {
+	tests := []struct {
+		name    string
+		teamNum int
+		size    int
+	}{
+		{name: "2 teams of 2", teamNum: 2, size: 2},
+		{name: "2 teams of 3", teamNum: 2, size: 3},
+		{name: "3 teams of 4", teamNum: 3, size: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 50; seed++ {
+				g := newTestGame(tt.teamNum*tt.size, 16, seed)
+				members := make([]model.User, len(g.Odais))
+				for i, o := range g.Odais {
+					members[i] = model.User{Id: o.SenderId}
+				}
+				g.Teams = BalanceTeams(g, members, tt.teamNum)
+
+				SetupMemberRoles(g, nil)
+
+				if len(g.Odais) != len(members) {
+					t.Fatalf("got %d odais, want %d", len(g.Odais), len(members))
+				}
+
+				teamOf := make(map[model.UserId]model.TeamId)
+				for _, team := range g.Teams {
+					for _, m := range team.MemberIds {
+						teamOf[m] = team.Id
+					}
+				}
+
+				titles := make(map[model.TeamId][]model.OdaiTitle)
+				for _, o := range g.Odais {
+					titles[o.TeamId] = append(titles[o.TeamId], o.Title)
+					if teamOf[o.AnswererId] != o.TeamId {
+						t.Fatalf("answerer of %s is not in team %d", o.Title, o.TeamId)
+					}
+					if o.AnswererId == o.SenderId {
+						t.Fatalf("sender answers own odai %s", o.Title)
+					}
+					for _, d := range o.DrawerSeq {
+						if teamOf[d.UserId] != o.TeamId {
+							t.Fatalf("drawer of %s is not in team %d", o.Title, o.TeamId)
+						}
+						if tt.size > 2 && d.UserId == o.SenderId {
+							t.Fatalf("sender draws own odai %s", o.Title)
+						}
+					}
+				}
+
+				for _, team := range g.Teams {
+					if !reflect.DeepEqual(titles[team.Id], titles[g.Teams[0].Id]) {
+						t.Fatalf("team %d has different odais: %v, %v", team.Id, titles[team.Id], titles[g.Teams[0].Id])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBalanceTeamsSeed(t *testing.T) {
+	g := newTestGame(7, 16, 42)
+	members := make([]model.User, len(g.Odais))
+	for i, o := range g.Odais {
+		members[i] = model.User{Id: o.SenderId}
+	}
+
+	want := BalanceTeams(g, members, 3)
+	if got := BalanceTeams(g, members, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("BalanceTeams() = %v with the same seed, want %v", got, want)
+	}
+
+	// 別のシードからはいずれ別のチーム分けになる
+	for seed := int64(0); seed < 50; seed++ {
+		g.Seed = seed
+		if !reflect.DeepEqual(BalanceTeams(g, members, 3), want) {
+			return
+		}
+	}
+	t.Error("BalanceTeams() ignores the seed")
+}
+
+func TestSetupRelayChains(t *testing.T) {
+	for n := 0; n <= 9; n++ {
+		t.Run(fmt.Sprintf("%d members", n), func(t *testing.T) {
+			g := newTestGame(n, 1, int64(n))
+			SetupRelayChains(g)
+
+			// 2人以下では回答で終わるチェーンを作れない
+			want := 0
+			if n >= model.MinRelayMembers {
+				want = n - 1
+				if want%2 == 1 {
+					want--
+				}
+			}
+
+			for _, o := range g.Odais {
+				if len(o.Chain) != want {
+					t.Fatalf("chain of %d steps, want %d", len(o.Chain), want)
+				}
+				if want > 0 && model.StepCount(len(o.Chain)-1).IsDraw() {
+					t.Errorf("chain ends on a drawing")
+				}
+
+				seen := map[model.UserId]bool{o.SenderId: true}
+				for k, s := range o.Chain {
+					if seen[s.UserId] {
+						t.Errorf("step %d is taken by a member who is already in the chain", k)
+					}
+					seen[s.UserId] = true
+				}
+			}
+
+			// 各ターンで全員が別々のチェーンを担当する
+			for k := 0; k < want; k++ {
+				turn := make(map[model.UserId]bool, n)
+				for _, o := range g.Odais {
+					if turn[o.Chain[k].UserId] {
+						t.Errorf("a member takes 2 steps at turn %d", k)
+					}
+					turn[o.Chain[k].UserId] = true
+				}
+			}
+		})
+	}
+}
+
+func TestRelayChainScores(t *testing.T) {
+	for _, n := range []int{3, 4} {
+		t.Run(fmt.Sprintf("%d members", n), func(t *testing.T) {
+			g := newTestGame(n, 1, 1)
+			members := make([]model.User, n)
+			for i, o := range g.Odais {
+				members[i] = model.User{Id: o.SenderId}
+			}
+			SetupRelayChains(g)
+
+			// 最初のお題だけ最後の回答が正解になる
+			for i, o := range g.Odais {
+				for k := range o.Chain {
+					if model.StepCount(k).IsDraw() {
+						continue
+					}
+					a := model.OdaiAnswer("wrong")
+					if i == 0 && k == len(o.Chain)-1 {
+						a = model.OdaiAnswer(o.Title)
+					}
+					o.Chain[k].Answer = &a
+				}
+			}
+
+			if !g.Odais[0].IsCorrect() {
+				t.Fatal("the chain answered correctly at the end is not correct")
+			}
+
+			scored := make(map[model.UserId]int)
+			for _, s := range g.MemberScores(members, len(g.Odais)) {
+				scored[s.UserId] = s.Score
+			}
+			for _, s := range g.Odais[0].Chain {
+				if scored[s.UserId] != 1 {
+					t.Errorf("member in the correct chain scored %d, want 1", scored[s.UserId])
+				}
+			}
+		})
+	}
+}
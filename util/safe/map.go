@@ -29,3 +29,22 @@ func (m *Map[K, V]) Delete(key K) {
 	defer m.mux.Unlock()
 	delete(m.m, key)
 }
+
+func (m *Map[K, V]) Range(f func(key K, value V) bool) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	for k, v := range m.m {
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+// DeleteIf deletes the value of the key if f reports true for it.
+func (m *Map[K, V]) DeleteIf(key K, f func(value V) bool) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if v, ok := m.m[key]; ok && f(v) {
+		delete(m.m, key)
+	}
+}